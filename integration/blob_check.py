@@ -0,0 +1,356 @@
+#!/usr/bin/python3
+""" Blob transactions (EIP-4844) checks: blob base fee, block blob fields and engine_getBlobs cross-checked with the transactions """
+
+import getopt
+import json
+import os
+import sys
+import time
+
+from eth_account import Account
+
+from rpc_helpers import BLOB, RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, get_next_test_number, \
+    print_range_usage, print_target_usage, send_transaction, to_int
+from run_tests import get_jwt_auth, get_jwt_secret
+
+DEFAULT_COUNT = 32
+DEFAULT_TIMEOUT = 60
+POLL_INTERVAL = 1
+GAS_PER_BLOB = 131072
+BLOB_SIZE = 131072
+CELLS_PER_EXT_BLOB = 128
+VERSIONED_HASH_VERSION_KZG = "0x01"
+MIN_BLOB_BASE_FEE = 1
+# blob schedule of the forks: target blob gas per block and base fee update fraction
+BLOB_SCHEDULE = {
+    "cancun": (3 * GAS_PER_BLOB, 3338477),
+    "prague": (6 * GAS_PER_BLOB, 5007716),
+}
+
+
+def fake_exponential(factor: int, numerator: int, denominator: int):
+    """ return the approximation of factor * e ** (numerator / denominator) as specified by EIP-4844
+    """
+    i = 1
+    output = 0
+    numerator_accum = factor * denominator
+    while numerator_accum > 0:
+        output = output + numerator_accum
+        numerator_accum = (numerator_accum * numerator) // (denominator * i)
+        i = i + 1
+    return output // denominator
+
+
+def get_excess_blob_gas(parent, target_blob_gas: int):
+    """ return the excess blob gas of the block following parent
+    """
+    return max(to_int(parent.get("excessBlobGas")) + to_int(parent.get("blobGasUsed")) - target_blob_gas, 0)
+
+
+def get_blob_base_fees(excess_blob_gas: int):
+    """ return the blob base fees of the excess blob gas per fork
+    """
+    return {fork: fake_exponential(MIN_BLOB_BASE_FEE, excess_blob_gas, fraction) for fork, (_, fraction) in BLOB_SCHEDULE.items()}
+
+
+def check_blob_base_fee(target: str):
+    """ check eth_blobBaseFee against the excess blob gas of the block following the latest one, return the mismatch
+        or empty string
+    """
+    blob_base_fee = call_daemon(target, "eth_blobBaseFee", [])
+    latest = call_daemon(target, "eth_getBlockByNumber", ["latest", False])
+    if not isinstance(blob_base_fee, str) or not isinstance(latest, dict):
+        return "eth_blobBaseFee or latest block not available"
+    for target_blob_gas, fraction in BLOB_SCHEDULE.values():
+        if to_int(blob_base_fee) == fake_exponential(MIN_BLOB_BASE_FEE, get_excess_blob_gas(latest, target_blob_gas), fraction):
+            return ""
+    return f"eth_blobBaseFee {to_int(blob_base_fee)} not derived from the excess blob gas of the latest block"
+
+
+def check_versioned_hashes(versioned_hashes):
+    """ return the malformed versioned hash (KZG version, 32 bytes) or empty string
+    """
+    for versioned_hash in versioned_hashes:
+        if not isinstance(versioned_hash, str) or len(versioned_hash) != 66 or not versioned_hash.startswith(VERSIONED_HASH_VERSION_KZG):
+            return str(versioned_hash)
+    return ""
+
+
+def check_blobs(engine_target: str, jwt_auth: str, version: str, versioned_hashes):
+    """ check the engine_getBlobs response of the versioned hashes (blob and proofs of each one, null if not in the
+        blob pool), return the number of served blobs and the mismatch or empty string
+    """
+    blobs = call_daemon(engine_target, "engine_getBlobsV" + version, [versioned_hashes], jwt_auth)
+    if blobs is None and version == "2":
+        # all or nothing: null if any blob is missing
+        return 0, ""
+    if not isinstance(blobs, list) or len(blobs) != len(versioned_hashes):
+        return 0, f"engine_getBlobsV{version} returned {json.dumps(blobs)[:80]} for {len(versioned_hashes)} hashes"
+    served = 0
+    for index, blob in enumerate(blobs):
+        if blob is None:
+            if version == "2":
+                return 0, f"engine_getBlobsV2 null blob {index} in non null response"
+            continue
+        if not isinstance(blob.get("blob"), str) or len(blob["blob"]) != 2 + 2 * BLOB_SIZE:
+            return served, f"engine_getBlobsV{version} blob {index} size"
+        proofs = [blob.get("proof")] if version == "1" else blob.get("proofs")
+        if not isinstance(proofs, list) or len(proofs) != (1 if version == "1" else CELLS_PER_EXT_BLOB) or \
+                any(not isinstance(proof, str) or len(proof) != 2 + 2 * 48 for proof in proofs):
+            return served, f"engine_getBlobsV{version} blob {index} proofs"
+        served = served + 1
+    return served, ""
+
+
+def check_blob_transaction(target: str, transaction, excess_blob_gas: int):
+    """ check the blob transaction of the block against eth_getTransactionByHash and its receipt (blob gas used and
+        price), return the mismatch or empty string
+    """
+    versioned_hashes = transaction.get("blobVersionedHashes") or []
+    if len(versioned_hashes) == 0:
+        return f"transaction {transaction.get('hash')} without blob versioned hashes"
+    malformed_hash = check_versioned_hashes(versioned_hashes)
+    if malformed_hash != "":
+        return f"transaction {transaction.get('hash')} malformed versioned hash {malformed_hash}"
+    by_hash = call_daemon(target, "eth_getTransactionByHash", [transaction.get("hash")])
+    if not isinstance(by_hash, dict) or by_hash.get("blobVersionedHashes") != versioned_hashes:
+        return f"transaction {transaction.get('hash')} blob versioned hashes differ by hash"
+    receipt = call_daemon(target, "eth_getTransactionReceipt", [transaction.get("hash")])
+    if not isinstance(receipt, dict):
+        return f"transaction {transaction.get('hash')} receipt not available"
+    if to_int(receipt.get("blobGasUsed")) != GAS_PER_BLOB * len(versioned_hashes):
+        return f"transaction {transaction.get('hash')} receipt blobGasUsed {to_int(receipt.get('blobGasUsed'))}"
+    if to_int(receipt.get("blobGasPrice")) not in get_blob_base_fees(excess_blob_gas).values():
+        return f"transaction {transaction.get('hash')} receipt blobGasPrice {to_int(receipt.get('blobGasPrice'))}"
+    return ""
+
+
+def check_block(target: str, block_number: int):
+    """ check the blob fields of the block (blob gas used by its blob transactions, excess blob gas following the
+        parent, parent beacon block root), return the block, its blob transactions and the mismatch or empty string
+    """
+    block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), True])
+    parent = call_daemon(target, "eth_getBlockByNumber", [hex(block_number - 1), False])
+    if not isinstance(block, dict) or not isinstance(parent, dict):
+        return block, [], "block not available"
+    for field in ("blobGasUsed", "excessBlobGas", "parentBeaconBlockRoot"):
+        if field not in block:
+            return block, [], field + " missing"
+    blob_transactions = [transaction for transaction in block.get("transactions", [])
+                         if isinstance(transaction, dict) and transaction.get("type") == "0x3"]
+    blob_gas_used = GAS_PER_BLOB * sum(len(transaction.get("blobVersionedHashes") or []) for transaction in blob_transactions)
+    if to_int(block["blobGasUsed"]) != blob_gas_used:
+        return block, blob_transactions, f"blobGasUsed {to_int(block['blobGasUsed'])} instead of {blob_gas_used}"
+    # the parent of the first Cancun block has no blob fields i.e. excess zero
+    expected_excess = [get_excess_blob_gas(parent, target_blob_gas) for target_blob_gas, _ in BLOB_SCHEDULE.values()]
+    if to_int(block["excessBlobGas"]) not in expected_excess:
+        return block, blob_transactions, f"excessBlobGas {to_int(block['excessBlobGas'])} not following the parent"
+    for transaction in blob_transactions:
+        mismatch = check_blob_transaction(target, transaction, to_int(block["excessBlobGas"]))
+        if mismatch != "":
+            return block, blob_transactions, mismatch
+    return block, blob_transactions, ""
+
+
+def submit_blob_transaction(target: str, private_key: str, timeout: int):
+    """ submit a blob self transfer on the devnet, return its hash, its versioned hashes while pending, its block
+        number once mined (None if not within timeout) and the error or empty string
+    """
+    address = Account.from_key(private_key).address
+    chain_id = to_int(call_daemon(target, "eth_chainId", []))
+    nonce = to_int(call_daemon(target, "eth_getTransactionCount", [address, "pending"]))
+    tx_hash, error = send_transaction(target, private_key, BLOB, chain_id, nonce, address)
+    if tx_hash is None:
+        return None, [], None, "eth_sendRawTransaction " + error
+    pending = call_daemon(target, "eth_getTransactionByHash", [tx_hash])
+    versioned_hashes = (pending or {}).get("blobVersionedHashes") or []
+    deadline = time.time() + timeout
+    while time.time() < deadline:
+        receipt = call_daemon(target, "eth_getTransactionReceipt", [tx_hash])
+        if isinstance(receipt, dict):
+            return tx_hash, versioned_hashes, to_int(receipt.get("blockNumber")), ""
+        time.sleep(POLL_INTERVAL)
+    return tx_hash, versioned_hashes, None, ""
+
+
+def write_test(test_dir: str, description: str, request, response=None, expect=None):
+    """ write the test as the next one of the test directory (golden response or assertions only)
+    """
+    test = {"test": {"description": description}, "request": request}
+    if expect is not None:
+        test["test"]["expect"] = expect
+    if response is not None:
+        test["response"] = response
+    os.makedirs(test_dir, exist_ok=True)
+    test_file = f"{test_dir}/test_{get_next_test_number(test_dir):02d}.json"
+    with open(test_file, 'w', encoding='utf8') as file:
+        file.write(json.dumps([test], indent=4) + "\n")
+    print(f"{test_file}: {description}")
+
+
+def generate_tests(target: str, net: str, blocks):
+    """ generate the tests of the blob blocks and transactions with the responses of target as golden, plus the
+        eth_blobBaseFee assertion
+    """
+    write_test("./" + net + "/eth_blobBaseFee", "blob base fee at least the minimum",
+               {"jsonrpc": "2.0", "method": "eth_blobBaseFee", "params": [], "id": 1},
+               expect=[{"path": "result", "gte": hex(MIN_BLOB_BASE_FEE)}])
+    for block, blob_transactions in blocks:
+        request = {"jsonrpc": "2.0", "method": "eth_getBlockByNumber", "params": [block["number"], True], "id": 1}
+        write_test("./" + net + "/eth_getBlockByNumber", f"block {to_int(block['number'])} with {len(blob_transactions)} blob transactions",
+                   request, {"jsonrpc": "2.0", "id": 1, "result": block})
+        for transaction in blob_transactions:
+            request = {"jsonrpc": "2.0", "method": "eth_getTransactionByHash", "params": [transaction["hash"]], "id": 1}
+            write_test("./" + net + "/eth_getTransactionByHash", "blob transaction of block " + str(to_int(block["number"])),
+                       request, {"jsonrpc": "2.0", "id": 1, "result": call_daemon(target, "eth_getTransactionByHash", [transaction["hash"]])})
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Check the blob transactions (EIP-4844) of a block range: eth_blobBaseFee, block blob fields, blob transactions")
+    print("by hash and receipt, engine_getBlobs against the versioned hashes; optionally submit a blob transaction on a")
+    print("devnet and generate the tests of the blob blocks")
+    print("")
+    print("-h print this help")
+    print("-b blockchain of the generated tests [default: goerly]")
+    print_target_usage()
+    print("-e port where the Engine API is located (e.g. 8551) [default: 8551]")
+    print("-k <file> authentication token file of the Engine API, enables the engine_getBlobs checks")
+    print("-V <versions> engine_getBlobs versions to check (e.g. 1,2) [default: 1]")
+    print_range_usage(DEFAULT_COUNT)
+    print("-K <private_key> submit a blob transaction on the devnet, checking engine_getBlobs while pending and its block once mined")
+    print("-T <secs> timeout waiting the submitted transaction to be mined [default: " + str(DEFAULT_TIMEOUT) + "]")
+    print("-g generate the tests of the checked blob blocks and transactions into the blockchain directory")
+    print("-v print the outcome of each block")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, check the blob base fee, the blocks of the range and the submitted transaction if any
+    """
+    net = "goerly"
+    options = ScriptOptions(DEFAULT_COUNT)
+    engine_port = 8551
+    jwt_secret = ""
+    versions = ["1"]
+    private_key = ""
+    timeout = DEFAULT_TIMEOUT
+    generate = False
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hb:" + TARGET_OPTIONS + RANGE_OPTIONS + "e:k:V:K:T:gv")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-b":
+                net = optarg
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-e":
+                engine_port = int(optarg)
+            elif option == "-k":
+                jwt_secret = get_jwt_secret(optarg)
+                if jwt_secret == "":
+                    print("secret file not found")
+                    sys.exit(-1)
+            elif option == "-V":
+                versions = optarg.split(",")
+            elif option == "-K":
+                private_key = optarg
+            elif option == "-T":
+                timeout = int(optarg)
+            elif option == "-g":
+                generate = True
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    engine_target = options.get_target(engine_port)
+    jwt_auth = get_jwt_auth(jwt_secret)
+    failed = 0
+    mismatch = check_blob_base_fee(target)
+    if mismatch != "":
+        print(f"eth_blobBaseFee: Failed ({mismatch})")
+        failed = failed + 1
+    elif verbose:
+        print("eth_blobBaseFee: OK")
+
+    block_numbers = []
+    if private_key != "":
+        tx_hash, versioned_hashes, block_number, error = submit_blob_transaction(target, private_key, timeout)
+        if error != "":
+            print(f"blob transaction: Failed ({error})")
+            failed = failed + 1
+        else:
+            for version in versions if jwt_secret != "" else []:
+                served, mismatch = check_blobs(engine_target, jwt_auth, version, versioned_hashes)
+                if mismatch == "" and served < len(versioned_hashes):
+                    mismatch = f"{served} of {len(versioned_hashes)} blobs served while pending"
+                if mismatch != "":
+                    print(f"blob transaction {tx_hash} engine_getBlobsV{version}: Failed ({mismatch})")
+                    failed = failed + 1
+            if block_number is None:
+                print(f"blob transaction {tx_hash}: Failed (not mined within {timeout} secs)")
+                failed = failed + 1
+            else:
+                print(f"blob transaction {tx_hash}: mined in block {block_number}")
+                block_numbers.append(block_number)
+    # the latest blocks by default only if no transaction submitted
+    if options.start_block >= 0 or len(block_numbers) == 0:
+        start_block, count = options.get_block_range(min_block=1)
+        block_numbers = block_numbers + [block_number for block_number in range(start_block, start_block + count)
+                                         if block_number not in block_numbers]
+
+    blob_blocks = []
+    served_blobs = 0
+    total_blobs = 0
+    for block_number in block_numbers:
+        block, blob_transactions, mismatch = check_block(target, block_number)
+        if mismatch == "" and jwt_secret != "":
+            for transaction in blob_transactions:
+                for version in versions:
+                    served, mismatch = check_blobs(engine_target, jwt_auth, version, transaction["blobVersionedHashes"])
+                    served_blobs = served_blobs + served
+                    total_blobs = total_blobs + len(transaction["blobVersionedHashes"])
+                    if mismatch != "":
+                        break
+                if mismatch != "":
+                    break
+        if mismatch != "":
+            print(f"block {block_number}: Failed ({mismatch})")
+            failed = failed + 1
+            continue
+        if verbose:
+            print(f"block {block_number}: OK ({len(blob_transactions)} blob transactions)")
+        if len(blob_transactions) > 0:
+            blob_blocks.append((block, blob_transactions))
+    print(f"Number of blob blocks:   {len(blob_blocks)}")
+    if jwt_secret != "":
+        # blobs of the mined transactions are usually no longer in the blob pool
+        print(f"Number of served blobs:  {served_blobs}/{total_blobs}")
+    print(f"Number of failed checks: {failed}")
+    if generate:
+        generate_tests(target, net, blob_blocks)
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
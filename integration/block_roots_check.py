@@ -0,0 +1,171 @@
+#!/usr/bin/python3
+""" Recompute the transactions, receipts and withdrawals roots of the blocks and compare them with the block headers """
+
+import getopt
+import sys
+
+from merkle_trie import get_trie_root
+from rlp_codec import LEGACY_TYPE, encode_transaction, encode_uint, rlp_encode
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, follow_blocks, print_range_usage, \
+    print_target_usage, to_bytes
+
+DEFAULT_COUNT = 16
+DEFAULT_POLL_INTERVAL = 2
+TRANSACTIONS_ROOT = "transactionsRoot"
+RECEIPTS_ROOT = "receiptsRoot"
+WITHDRAWALS_ROOT = "withdrawalsRoot"
+ROOTS = [TRANSACTIONS_ROOT, RECEIPTS_ROOT, WITHDRAWALS_ROOT]
+
+
+def encode_receipt(receipt):
+    """ return the consensus encoding of the JSON receipt: status (or post-state root before Byzantium), cumulative gas used,
+        logs bloom and logs, prefixed by the type if typed
+    """
+    outcome = to_bytes(receipt["root"]) if "status" not in receipt else encode_uint(int(receipt["status"], 16))
+    logs = [[to_bytes(log["address"]), [to_bytes(topic) for topic in log["topics"]], to_bytes(log["data"])]
+            for log in receipt.get("logs") or []]
+    encoded = rlp_encode([outcome, encode_uint(int(receipt["cumulativeGasUsed"], 16)), to_bytes(receipt["logsBloom"]), logs])
+    transaction_type = int(receipt.get("type", "0x0"), 16)
+    return encoded if transaction_type == LEGACY_TYPE else bytes([transaction_type]) + encoded
+
+
+def encode_withdrawal(withdrawal):
+    """ return the consensus encoding of the JSON withdrawal
+    """
+    return rlp_encode([int(withdrawal["index"], 16), int(withdrawal["validatorIndex"], 16), to_bytes(withdrawal["address"]),
+                       int(withdrawal["amount"], 16)])
+
+
+def compare_root(block, root: str, items):
+    """ compare the root of the header with the one of the trie of the encoded items, return the mismatch or empty string
+    """
+    computed = "0x" + get_trie_root(items).hex()
+    if str(block.get(root)).lower() != computed:
+        return f"{root} {block.get(root)} instead of {computed} ({len(items)} items)"
+    return ""
+
+
+def check_block(target: str, block_number: int, roots):
+    """ recompute the selected roots of the block from the transactions of the full block, the receipts of
+        eth_getBlockReceipts and the withdrawals (post-Shanghai), return the mismatch or empty string
+    """
+    block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), True])
+    if not isinstance(block, dict):
+        return "block not available"
+    if TRANSACTIONS_ROOT in roots:
+        transactions = []
+        for index, transaction in enumerate(block.get("transactions", [])):
+            try:
+                transactions.append(encode_transaction(transaction))
+            except (ValueError, KeyError, TypeError) as error:
+                return f"transaction {index} {transaction.get('hash')} not encodable: {error}"
+        mismatch = compare_root(block, TRANSACTIONS_ROOT, transactions)
+        if mismatch != "":
+            return mismatch
+    if RECEIPTS_ROOT in roots:
+        # by hash, so that the receipts are the ones of the header even across a reorg
+        receipts = call_daemon(target, "eth_getBlockReceipts", [block["hash"]])
+        if not isinstance(receipts, list):
+            return "eth_getBlockReceipts failed"
+        try:
+            mismatch = compare_root(block, RECEIPTS_ROOT, [encode_receipt(receipt) for receipt in receipts])
+        except (ValueError, KeyError, TypeError) as error:
+            return f"receipts not encodable: {error}"
+        if mismatch != "":
+            return mismatch
+    if WITHDRAWALS_ROOT in roots and WITHDRAWALS_ROOT in block:
+        # post-Shanghai only
+        if not isinstance(block.get("withdrawals"), list):
+            return "withdrawals missing with withdrawalsRoot"
+        try:
+            mismatch = compare_root(block, WITHDRAWALS_ROOT, [encode_withdrawal(withdrawal) for withdrawal in block["withdrawals"]])
+        except (ValueError, KeyError, TypeError) as error:
+            return f"withdrawals not encodable: {error}"
+        if mismatch != "":
+            return mismatch
+    return ""
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Recompute the transactionsRoot (RLP encoding of the transactions of any type of the full block), the receiptsRoot")
+    print("(receipts of eth_getBlockReceipts) and the withdrawalsRoot (post-Shanghai) of each block of a range or, following the")
+    print("chain, of each new block and compare them with the ones of the header")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-r <roots> roots checked, comma separated (e.g. transactionsRoot,withdrawalsRoot) [default: " + ",".join(ROOTS) + "]")
+    print("-f follow the chain checking each new block until interrupted (after the range if any)")
+    print("-i <secs> polling interval of the new blocks [default: " + str(DEFAULT_POLL_INTERVAL) + "]")
+    print("-v print the outcome of each block")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and check the blocks of the range, then the new ones if following the chain
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    roots = ROOTS
+    follow = False
+    poll_interval = DEFAULT_POLL_INTERVAL
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "r:fi:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-r":
+                roots = optarg.split(",")
+                if any(root not in ROOTS for root in roots):
+                    print("unknown root in: " + optarg)
+                    sys.exit(-1)
+            elif option == "-f":
+                follow = True
+            elif option == "-i":
+                poll_interval = float(optarg)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range(follow)
+    checked = 0
+    failed = 0
+    try:
+        for block_number in follow_blocks(target, start_block, count, follow, poll_interval):
+            mismatch = check_block(target, block_number, roots)
+            checked = checked + 1
+            if mismatch != "":
+                print(f"block {block_number}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"block {block_number}: OK")
+    except KeyboardInterrupt:
+        print("")
+    print(f"Number of checked blocks: {checked}")
+    print(f"Number of failed checks:  {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
@@ -0,0 +1,85 @@
+#!/usr/bin/python3
+""" Remove the stale run-id-stamped results directories of the chains beyond the results retention """
+
+import getopt
+import os
+import sys
+
+from run_tests import parse_retention, prune_results
+
+
+#
+# usage
+#
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Remove the run-id-stamped results directories (as written by run_tests.py --results-retention) of the chains older")
+    print("than the age or beyond the newest runs, e.g. from a cron job on shared test servers; other files are left untouched")
+    print("")
+    print("-h print this help")
+    print("-b blockchain, comma-separated list [default: goerly,mainnet]")
+    print("-r <7d|10runs> results retention: max age of the runs (e.g. 7d, 12h) or number of newest runs kept")
+    print("-d <dir> results directory name in the chain directories [default: results]")
+    print("-n dry run, just print the stale runs")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and remove the stale results of the chains
+    """
+    nets = "goerly,mainnet"
+    retention = None
+    results_dir_name = "results"
+    dry_run = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hb:r:d:n")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-b":
+                nets = optarg
+            elif option == "-r":
+                try:
+                    retention = parse_retention(optarg)
+                except ValueError:
+                    print("invalid results retention: " + optarg)
+                    sys.exit(-1)
+            elif option == "-d":
+                results_dir_name = optarg
+            elif option == "-n":
+                dry_run = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+    if retention is None:
+        print("results retention (-r) required")
+        usage(argv)
+        sys.exit(-1)
+
+    removed = 0
+    for net in nets.split(","):
+        results_dir = os.path.join(net, results_dir_name)
+        for run_id in prune_results(results_dir, *retention, dry_run=dry_run):
+            print(("stale run " if dry_run else "removed run ") + os.path.join(results_dir, run_id))
+            removed = removed + 1
+    print(f"Number of {'stale' if dry_run else 'removed'} runs: {removed}")
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
@@ -0,0 +1,179 @@
+#!/usr/bin/python3
+""" Report the test coverage of the methods exposed by the RpcDaemon """
+
+import getopt
+import json
+import os
+import sys
+
+from rpc_helpers import TARGET_OPTIONS, ScriptOptions, call_daemon, print_target_usage
+from run_tests import load_test_file
+
+MARKDOWN = "md"
+JSON = "json"
+
+
+def get_exposed_methods(target: str):
+    """ return the exposed namespaces and methods, the latter from OpenRPC discovery (rpc.discover) if supported
+    """
+    modules = call_daemon(target, "rpc_modules", [])
+    namespaces = sorted(modules.keys()) if isinstance(modules, dict) else []
+    discovery = call_daemon(target, "rpc.discover", [])
+    methods = []
+    if isinstance(discovery, dict) and isinstance(discovery.get("methods"), list):
+        methods = sorted(method["name"] for method in discovery["methods"] if isinstance(method, dict) and "name" in method)
+    return namespaces, methods
+
+
+def get_param_kind(param):
+    """ classify the parameter value for the parameter space heuristics
+    """
+    if isinstance(param, str):
+        if param in ("latest", "earliest", "pending", "safe", "finalized"):
+            return param
+        if param.startswith("0x"):
+            return {66: "hash", 42: "address"}.get(len(param), "hex")
+        return "string"
+    if isinstance(param, bool):
+        return "bool"
+    if isinstance(param, (int, float)):
+        return "number"
+    if isinstance(param, dict):
+        return "object"
+    if isinstance(param, list):
+        return "array"
+    return "null"
+
+
+def scan_corpus(json_dir: str):
+    """ return method -> (tests, distinct parameter signatures) for the tests of the corpus
+    """
+    coverage = {}
+    for api_file in sorted(os.listdir(json_dir)):
+        test_dir = json_dir + api_file
+        if not os.path.isdir(test_dir) or api_file == "results":
+            continue
+        for test_name in sorted(os.listdir(test_dir)):
+            try:
+                jsonrpc_commands = load_test_file(test_dir + "/" + test_name)
+            except (OSError, ValueError):
+                continue
+            for json_rpc in jsonrpc_commands:
+                request = json_rpc.get("request")
+                for single_request in (request if isinstance(request, list) else [request]):
+                    if not isinstance(single_request, dict) or "method" not in single_request:
+                        continue
+                    tests, signatures = coverage.setdefault(single_request["method"], (set(), set()))
+                    tests.add(api_file + "/" + test_name)
+                    params = single_request.get("params", [])
+                    signatures.add(",".join(get_param_kind(param) for param in (params if isinstance(params, list) else [params])))
+    return {method: (len(tests), len(signatures)) for method, (tests, signatures) in coverage.items()}
+
+
+def build_report(namespaces, methods, coverage):
+    """ return the coverage report as dictionary
+    """
+    exposed = methods if len(methods) > 0 else sorted(method for method in coverage if method.split("_")[0] in namespaces)
+    tested = [method for method in exposed if method in coverage]
+    return {
+        "namespaces": [{"namespace": namespace, "tests": sum(tests for method, (tests, _) in coverage.items()
+                                                             if method.split("_")[0] == namespace)}
+                       for namespace in namespaces],
+        "methods": [{"method": method, "tests": coverage.get(method, (0, 0))[0],
+                     "param_signatures": coverage.get(method, (0, 0))[1]} for method in exposed],
+        "untested": [method for method in exposed if method not in coverage],
+        "coverage": round(100 * len(tested) / len(exposed), 2) if len(exposed) > 0 else 0,
+        "discovery": len(methods) > 0,
+    }
+
+
+def to_markdown(report):
+    """ return the coverage report as markdown
+    """
+    lines = ["# RPC test coverage", ""]
+    if not report["discovery"]:
+        lines.append("Method list not discoverable (no rpc.discover): only the tested methods of the exposed namespaces are listed.")
+        lines.append("")
+    lines.append(f"Method coverage: {report['coverage']}%")
+    lines = lines + ["", "| Namespace | Tests |", "|---|---|"]
+    lines = lines + [f"| {item['namespace']} | {item['tests']} |" for item in report["namespaces"]]
+    lines = lines + ["", "| Method | Tests | Param signatures |", "|---|---|---|"]
+    lines = lines + [f"| {item['method']} | {item['tests']} | {item['param_signatures']} |" for item in report["methods"]]
+    if len(report["untested"]) > 0:
+        lines = lines + ["", "## Methods with zero tests", ""] + ["- " + method for method in report["untested"]]
+    return "\n".join(lines) + "\n"
+
+
+#
+# usage
+#
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Report which methods exposed by the RpcDaemon have tests, how many tests and parameter signatures")
+    print("")
+    print("-h print this help")
+    print("-b blockchain [default: goerly]")
+    print_target_usage()
+    print("-f <format>: report format md or json [default: md]")
+    print("-o <file>: write the report into file [default: print it]")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and print the coverage report
+    """
+    net = "goerly"
+    options = ScriptOptions()
+    report_format = MARKDOWN
+    output_file = ""
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hb:" + TARGET_OPTIONS + "f:o:")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-b":
+                net = optarg
+            elif options.parse_target(option, optarg):
+                continue
+            elif option == "-f":
+                report_format = optarg
+                if report_format not in (MARKDOWN, JSON):
+                    print("unsupported format: " + report_format)
+                    sys.exit(-1)
+            elif option == "-o":
+                output_file = optarg
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    namespaces, methods = get_exposed_methods(options.get_target())
+    if len(namespaces) == 0 and len(methods) == 0:
+        print("RpcDaemon at " + options.get_target() + " exposes no method (rpc_modules failed)")
+        sys.exit(1)
+    report = build_report(namespaces, methods, scan_corpus("./" + net + "/"))
+    output = to_markdown(report) if report_format == MARKDOWN else json.dumps(report, indent=4) + "\n"
+    if output_file != "":
+        with open(output_file, 'w', encoding='utf8') as file:
+            file.write(output)
+    else:
+        print(output, end="")
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
@@ -0,0 +1,178 @@
+#!/usr/bin/python3
+""" Run one integration test interactively: request, response, expected response, colored diff and timing breakdown """
+
+import difflib
+import json
+import os
+import shlex
+import subprocess
+import sys
+import tempfile
+import time
+
+from run_tests import Config, ResponseAlternatives, align_for_comparison, get_curl_command, get_jwt_auth, get_target, \
+    load_test_commands, parse_json_stream, select_alternative
+
+# curl write-out of the timing breakdown on stderr (keeping stdout for the response)
+TIMING_OPTIONS = ''' --write-out "%{stderr}%{time_namelookup} %{time_connect} %{time_appconnect} %{time_starttransfer} %{time_total}"'''
+TIMING_NAMES = ["dns", "connect", "tls", "first byte", "total"]
+COLOR_RED = "\033[31m"
+COLOR_GREEN = "\033[32m"
+COLOR_CYAN = "\033[36m"
+COLOR_RESET = "\033[0m"
+
+
+def get_method(request):
+    """ return the method of the request, of the first request if batch """
+    if isinstance(request, list):
+        return get_method(request[0]) if len(request) > 0 else ""
+    return request.get("method", "") if isinstance(request, dict) else ""
+
+
+def send(config, request):
+    """ send the request to the daemon under test, return the response (None if not JSON), the timings in secs of the
+        request phases and the parsing time
+    """
+    target = config.scheme + get_target(config.daemon_under_test, get_method(request), config.infura_url, config.daemon_on_host,
+                                        config.daemon_on_port)
+    cmd = get_curl_command(config, get_jwt_auth(config.jwt_secret), ''' --data-binary @- ''', target, TIMING_OPTIONS)
+    process = subprocess.run(shlex.split(cmd), input=json.dumps(request), stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+                             universal_newlines=True, check=False)
+    timings = [float(timing) for timing in process.stderr.split()[-len(TIMING_NAMES):]] if process.returncode == 0 else []
+    parse_start_time = time.time()
+    try:
+        response = parse_json_stream(process.stdout)
+    except json.decoder.JSONDecodeError:
+        response = None
+    return response, timings, time.time() - parse_start_time
+
+
+def print_diff(expected_response, response, colored: bool):
+    """ print the unified diff of the pretty-printed expected response and response, colored if requested """
+    expected_lines = json.dumps(expected_response, indent=2, sort_keys=True).splitlines()
+    response_lines = json.dumps(response, indent=2, sort_keys=True).splitlines()
+    for line in difflib.unified_diff(expected_lines, response_lines, "expected", "response", lineterm=""):
+        if colored and line.startswith("-") and not line.startswith("---"):
+            line = COLOR_RED + line + COLOR_RESET
+        elif colored and line.startswith("+") and not line.startswith("+++"):
+            line = COLOR_GREEN + line + COLOR_RESET
+        elif colored and line.startswith("@@"):
+            line = COLOR_CYAN + line + COLOR_RESET
+        print(line)
+
+
+def run_request(config, request, expected_response, colored: bool):
+    """ send the request and print request, response, expected response (if any), diff and timings """
+    print("Request:")
+    print(json.dumps(request, indent=2))
+    response, timings, parse_time = send(config, request)
+    print("Response:")
+    print(json.dumps(response, indent=2) if response is not None else "(not JSON or no response)")
+    if expected_response is not None:
+        method = get_method(request)
+        if isinstance(expected_response, ResponseAlternatives):
+            expected_response = select_alternative(config, response, expected_response, method)
+        aligned_response, aligned_expected_response = align_for_comparison(config, response, expected_response, method)
+        print("Expected response:")
+        print(json.dumps(expected_response, indent=2))
+        if aligned_response == aligned_expected_response:
+            print("Outcome: OK")
+        else:
+            print("Outcome: Failed, diff (aligned as compared by run_tests.py):")
+            print_diff(aligned_expected_response, aligned_response, colored)
+    if len(timings) == len(TIMING_NAMES):
+        print("Timing: " + ", ".join(f"{name} {timing * 1000:.1f} ms" for name, timing in zip(TIMING_NAMES, timings)) +
+              f", parsing {parse_time * 1000:.1f} ms")
+    else:
+        print("Timing: not available (request failed)")
+
+
+def edit_request(request):
+    """ return the request edited in $EDITOR through a temp file, None if not valid JSON """
+    with tempfile.NamedTemporaryFile('w', suffix=".json", delete=False, encoding='utf8') as request_file:
+        request_file.write(json.dumps(request, indent=2) + "\n")
+    try:
+        subprocess.run([os.environ.get("EDITOR", "vi"), request_file.name], check=False)
+        with open(request_file.name, encoding='utf8') as edited_file:
+            return json.load(edited_file)
+    except json.decoder.JSONDecodeError as err:
+        print("invalid request: " + str(err))
+        return None
+    finally:
+        os.remove(request_file.name)
+
+
+def read_request():
+    """ return the request read from stdin up to an empty line, None if not valid JSON """
+    print("Request JSON (end with an empty line):")
+    lines = []
+    for line in sys.stdin:
+        if line.strip() == "":
+            break
+        lines.append(line)
+    try:
+        return json.loads("".join(lines))
+    except json.decoder.JSONDecodeError as err:
+        print("invalid request: " + str(err))
+        return None
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + " [run_tests.py options] <test>:")
+    print("")
+    print("Run one test (e.g. eth_call/test_20.json, eth_call/test_01.json#2 for a case of parametrized test) against the daemon")
+    print("under test configured by the run_tests.py options (e.g. -b mainnet -H 10.10.2.3 -p 8545 -k jwt.hex), printing")
+    print("request, response, expected response, colored diff and timing breakdown of each request, then offering to re-send")
+    print("the request edited in $EDITOR or read from stdin")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, run the test and loop over the user commands
+    """
+    if len(argv) < 2 or argv[-1].startswith("-"):
+        usage(argv)
+        sys.exit(-1)
+    test_file = argv[-1]
+    config = Config(argv[:-1])
+    colored = sys.stdout.isatty()
+    try:
+        jsonrpc_commands = load_test_commands(config, test_file)
+    except (FileNotFoundError, NotADirectoryError):
+        print("test not found: " + config.json_dir + test_file)
+        sys.exit(-1)
+
+    for json_rpc in jsonrpc_commands:
+        request = json_rpc["request"]
+        expected_response = ResponseAlternatives.get(request, json_rpc.get("response"))
+        run_request(config, request, expected_response, colored)
+        while True:
+            if not sys.stdin.isatty():
+                break
+            choice = input("[r]esend, [e]dit in $EDITOR, [s]tdin request, [n]ext request, [q]uit: ").strip()
+            if choice == "r":
+                run_request(config, request, expected_response, colored)
+            elif choice in ("e", "s"):
+                edited_request = edit_request(request) if choice == "e" else read_request()
+                if edited_request is not None:
+                    request = edited_request
+                    run_request(config, request, expected_response, colored)
+            elif choice == "n":
+                break
+            elif choice == "q":
+                return
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    try:
+        main(sys.argv)
+    except (KeyboardInterrupt, EOFError):
+        print("")
+    sys.exit(0)
@@ -0,0 +1,118 @@
+#!/usr/bin/python3
+""" Compare two results directories of previous runs (e.g. two daemon versions) without any running daemon """
+
+import getopt
+import json
+import os
+import sys
+
+DIFF_SUFFIX = "-diff.json"
+FIXED = "fixed"
+NEW_FAILURE = "new failure"
+DIFF_CHANGED = "diff changed"
+STILL_FAILED = "still failed"
+
+
+def scan_results(results_dir: str):
+    """ return the failed tests of the results directory (i.e. the tests having non-empty diff) -> diff content
+    """
+    failed_tests = {}
+    for dir_path, _, file_names in os.walk(results_dir):
+        for file_name in file_names:
+            if not file_name.endswith(DIFF_SUFFIX):
+                continue
+            diff_file = os.path.join(dir_path, file_name)
+            if os.stat(diff_file).st_size == 0:
+                continue
+            with open(diff_file, encoding='utf8', errors='replace') as file:
+                test_name = os.path.relpath(diff_file, results_dir)[:-len(DIFF_SUFFIX)].rstrip(".")
+                failed_tests[test_name] = file.read()
+    return failed_tests
+
+
+def compare_results(failed_tests_a, failed_tests_b):
+    """ return the tests whose status changed or whose diff changed from the first results to the second one
+        as list of (test name, change), sorted by test name
+    """
+    changes = []
+    for test_name in sorted(set(failed_tests_a) | set(failed_tests_b)):
+        if test_name not in failed_tests_b:
+            changes.append((test_name, FIXED))
+        elif test_name not in failed_tests_a:
+            changes.append((test_name, NEW_FAILURE))
+        elif failed_tests_a[test_name] != failed_tests_b[test_name]:
+            changes.append((test_name, DIFF_CHANGED))
+        else:
+            changes.append((test_name, STILL_FAILED))
+    return changes
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + " [options] <results dir A> <results dir B>:")
+    print("")
+    print("Report the tests that changed status (fixed, new failure) or whose diff changed from the results directory A to B")
+    print("(e.g. mainnet/results of the nightly runs of two daemon versions)")
+    print("")
+    print("-h print this help")
+    print("-a report also the tests failed with the same diff")
+    print("-j print the report as JSON")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and print the changes between the results directories
+    """
+    all_failures = False
+    json_report = False
+
+    try:
+        opts, args = getopt.getopt(argv[1:], "haj")
+        for option, _ in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-a":
+                all_failures = True
+            elif option == "-j":
+                json_report = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+    if len(args) != 2:
+        usage(argv)
+        sys.exit(-1)
+    for results_dir in args:
+        if not os.path.isdir(results_dir):
+            print("results directory not found: " + results_dir)
+            sys.exit(-1)
+
+    changes = compare_results(scan_results(args[0]), scan_results(args[1]))
+    if not all_failures:
+        changes = [(test_name, change) for test_name, change in changes if change != STILL_FAILED]
+    if json_report:
+        print(json.dumps([{"test": test_name, "change": change} for test_name, change in changes], indent=4))
+    else:
+        for test_name, change in changes:
+            print(f"{test_name.ljust(60)} {change}")
+        for change_type in (FIXED, NEW_FAILURE, DIFF_CHANGED) + ((STILL_FAILED,) if all_failures else ()):
+            count = len([change for _, change in changes if change == change_type])
+            print(f"Number of {change_type} tests:".ljust(30) + f"{count}")
+    if any(change in (NEW_FAILURE, DIFF_CHANGED) for _, change in changes):
+        sys.exit(1)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
@@ -0,0 +1,187 @@
+#!/usr/bin/python3
+""" Generate eth_call/debug_traceCall tests with state and block overrides permutations, goldens from a reference node """
+
+import getopt
+import json
+import os
+import sys
+
+from rpc_helpers import TARGET_OPTIONS, ScriptOptions, get_next_test_number, post_request, print_target_usage
+
+ETH_CALL = "eth_call"
+DEBUG_TRACE_CALL = "debug_traceCall"
+OVERRIDE_BALANCE = "0x56bc75e2d63100000"
+OVERRIDE_STORAGE_VALUE = "0x" + "0" * 63 + "1"
+STORAGE_SLOT_0 = "0x" + "0" * 64
+BLOCK_TIME = 12
+
+
+def get_state_overrides(contract: str, sender: str):
+    """ return the state overrides permutations as (description, state overrides or None)
+    """
+    return [
+        ("no state override", None),
+        ("sender balance override", {sender: {"balance": OVERRIDE_BALANCE}}),
+        ("sender nonce override", {sender: {"nonce": "0x2a"}}),
+        ("contract storage slot 0 diff override", {contract: {"stateDiff": {STORAGE_SLOT_0: OVERRIDE_STORAGE_VALUE}}}),
+        ("contract storage replaced by slot 0 only", {contract: {"state": {STORAGE_SLOT_0: OVERRIDE_STORAGE_VALUE}}}),
+        ("contract code removed", {contract: {"code": "0x"}}),
+    ]
+
+
+def get_block_overrides(block: int, timestamp: int):
+    """ return the block overrides permutations as (description, block overrides or None)
+    """
+    return [
+        ("no block override", None),
+        ("next block number", {"number": hex(block + 1)}),
+        ("next block time", {"time": hex(timestamp + BLOCK_TIME)}),
+        ("zero base fee", {"baseFee": "0x0"}),
+        ("custom coinbase and gas limit", {"coinbase": "0x" + "00" * 19 + "01", "gasLimit": hex(30000000)}),
+    ]
+
+
+def build_request(method: str, call, block: int, state_overrides, block_overrides, tracer: str):
+    """ return the eth_call or debug_traceCall request applying the overrides if any
+    """
+    params = [call, hex(block)]
+    if method == ETH_CALL:
+        if state_overrides is not None or block_overrides is not None:
+            params.append(state_overrides if state_overrides is not None else {})
+        if block_overrides is not None:
+            params.append(block_overrides)
+    else:
+        trace_config = {}
+        if tracer != "":
+            trace_config["tracer"] = tracer
+        if state_overrides is not None:
+            trace_config["stateOverrides"] = state_overrides
+        if block_overrides is not None:
+            trace_config["blockOverrides"] = block_overrides
+        params.append(trace_config)
+    return {"jsonrpc": "2.0", "method": method, "params": params, "id": 1}
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Generate eth_call and debug_traceCall tests calling the contract at the block with the permutations of state")
+    print("overrides and block overrides, capturing the expected responses from the reference node")
+    print("")
+    print("-h print this help")
+    print("-b blockchain [default: goerly]")
+    print_target_usage("reference node")
+    print("-c <address> target contract address")
+    print("-n <block> block number of the calls")
+    print("-d <data> call data [default: 0x]")
+    print("-f <address> sender address [default: zero address]")
+    print("-m <methods> methods of the generated tests [default: eth_call,debug_traceCall]")
+    print("-t <tracer> tracer of debug_traceCall (e.g. callTracer) [default: struct logger]")
+    print("-D dry run: print the tests instead of writing them")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, capture the responses of the override permutations and write the tests
+    """
+    net = "goerly"
+    options = ScriptOptions()
+    contract = ""
+    block = -1
+    data = "0x"
+    sender = "0x" + "00" * 20
+    methods = [ETH_CALL, DEBUG_TRACE_CALL]
+    tracer = ""
+    dry_run = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hb:" + TARGET_OPTIONS + "c:n:d:f:m:t:D")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-b":
+                net = optarg
+            elif options.parse_target(option, optarg):
+                continue
+            elif option == "-c":
+                contract = optarg
+            elif option == "-n":
+                block = int(optarg, 0)
+            elif option == "-d":
+                data = optarg
+            elif option == "-f":
+                sender = optarg
+            elif option == "-m":
+                methods = optarg.split(",")
+                for method in methods:
+                    if method not in (ETH_CALL, DEBUG_TRACE_CALL):
+                        print("unsupported method: " + method)
+                        sys.exit(-1)
+            elif option == "-t":
+                tracer = optarg
+            elif option == "-D":
+                dry_run = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+    if contract == "" or block < 0:
+        print("contract address (-c) and block number (-n) required")
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    header = post_request(target, {"jsonrpc": "2.0", "method": "eth_getBlockByNumber", "params": [hex(block), False], "id": 1})
+    if not isinstance(header, dict) or not isinstance(header.get("result"), dict):
+        print("block " + str(block) + " not found on reference node at " + target)
+        sys.exit(1)
+    timestamp = int(header["result"]["timestamp"], 16)
+    call = {"from": sender, "to": contract, "data": data}
+
+    generated_tests = 0
+    for method in methods:
+        test_dir = "./" + net + "/" + method
+        test_number = get_next_test_number(test_dir)
+        for state_description, state_overrides in get_state_overrides(contract, sender):
+            for block_description, block_overrides in get_block_overrides(block, timestamp):
+                if state_overrides is None and block_overrides is None:
+                    continue
+                request = build_request(method, call, block, state_overrides, block_overrides, tracer)
+                response = post_request(target, request)
+                if response is None:
+                    print(f"{method} {state_description}, {block_description}: bad json format on rsp, skipped")
+                    continue
+                test = [{
+                    "test": {"description": f"{state_description}, {block_description}"},
+                    "request": request,
+                    "response": response,
+                }]
+                test_file = f"{test_dir}/test_{test_number:02d}.json"
+                if dry_run:
+                    print(test_file)
+                    print(json.dumps(test, indent=4))
+                else:
+                    os.makedirs(test_dir, exist_ok=True)
+                    with open(test_file, 'w', encoding='utf8') as file:
+                        file.write(json.dumps(test, indent=4) + "\n")
+                    print(f"{test_file}: {state_description}, {block_description}")
+                test_number = test_number + 1
+                generated_tests = generated_tests + 1
+    print(f"Number of generated tests: {generated_tests}")
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
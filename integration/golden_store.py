@@ -0,0 +1,214 @@
+#!/usr/bin/python3
+""" Pack the expected responses of the integration tests into the content-addressed golden store and unpack them back """
+
+import getopt
+import json
+import os
+import shutil
+import sys
+import tempfile
+
+from run_tests import DEFAULT_GOLDEN_STORE_DIR, GOLDEN_REFERENCE, GoldenStore
+
+DEFAULT_MIN_SIZE = 1024
+PACK = "pack"
+UNPACK = "unpack"
+GC = "gc"
+
+
+def get_test_files(nets):
+    """ return the plain JSON test files of the chains (archived tests not packed: already compressed)
+    """
+    test_files = []
+    for net in nets:
+        for api_name in sorted(os.listdir(net)):
+            test_dir = os.path.join(net, api_name)
+            if not os.path.isdir(test_dir) or api_name == "results":
+                continue
+            for test_name in sorted(os.listdir(test_dir)):
+                if test_name.endswith(".json"):
+                    test_files.append(os.path.join(test_dir, test_name))
+    return test_files
+
+
+def pack_value(value, golden_store: GoldenStore, min_size: int):
+    """ return the value with its sub-objects (innermost first, so that blobs share their sub-objects too) and the value
+        itself replaced by blob references if their canonical JSON is at least min_size bytes
+    """
+    if isinstance(value, dict):
+        value = {key: pack_value(item, golden_store, min_size) for key, item in value.items()}
+    elif isinstance(value, list):
+        value = [pack_value(item, golden_store, min_size) for item in value]
+    if len(json.dumps(value, separators=(",", ":"))) < min_size:
+        return value
+    return golden_store.add(value)
+
+
+def pack_commands(jsonrpc_commands, golden_store: GoldenStore, min_size: int):
+    """ return the JSON RPC commands with the expected responses (also of the cases of parametrized tests) packed
+    """
+    packed_commands = []
+    for json_rpc in jsonrpc_commands:
+        json_rpc = dict(json_rpc)
+        if "response" in json_rpc:
+            json_rpc["response"] = pack_value(json_rpc["response"], golden_store, min_size)
+        if "cases" in json_rpc:
+            json_rpc["cases"] = [dict(case, response=pack_value(case["response"], golden_store, min_size))
+                                 if "response" in case else case for case in json_rpc["cases"]]
+        packed_commands.append(json_rpc)
+    return packed_commands
+
+
+def get_references(value, references):
+    """ collect the blob hashes referenced by the value """
+    if GoldenStore.is_reference(value):
+        references.add(value[GOLDEN_REFERENCE])
+    elif isinstance(value, dict):
+        for item in value.values():
+            get_references(item, references)
+    elif isinstance(value, list):
+        for item in value:
+            get_references(item, references)
+
+
+def collect_garbage(test_files, golden_store: GoldenStore, dry_run: bool):
+    """ remove the blobs not referenced by the test files nor by the referenced blobs, return the removed blob count
+    """
+    pending = set()
+    for test_file in test_files:
+        with open(test_file, 'rb') as json_file:
+            get_references(json.load(json_file), pending)
+    referenced = set()
+    while len(pending) > 0:
+        blob_hash = pending.pop()
+        referenced.add(blob_hash)
+        blob_references = set()
+        with open(golden_store.get_blob_filename(blob_hash), 'rb') as blob_file:
+            get_references(json.load(blob_file), blob_references)
+        pending.update(blob_references - referenced)
+    removed = 0
+    for blob_dir in sorted(os.listdir(golden_store.directory)):
+        for blob_name in sorted(os.listdir(os.path.join(golden_store.directory, blob_dir))):
+            if blob_name[:-len(".json")] not in referenced:
+                print("unreferenced blob " + os.path.join(golden_store.directory, blob_dir, blob_name))
+                if not dry_run:
+                    os.remove(os.path.join(golden_store.directory, blob_dir, blob_name))
+                removed = removed + 1
+        if not dry_run and len(os.listdir(os.path.join(golden_store.directory, blob_dir))) == 0:
+            shutil.rmtree(os.path.join(golden_store.directory, blob_dir))
+    return removed
+
+
+def get_store_size(directory: str):
+    """ return the number of blobs and their total size in the store directory """
+    count = 0
+    size = 0
+    for root, _, files in os.walk(directory):
+        for file_name in files:
+            count = count + 1
+            size = size + os.stat(os.path.join(root, file_name)).st_size
+    return count, size
+
+
+#
+# usage
+#
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Pack the expected responses of the JSON test files into the content-addressed golden store (test files")
+    print("referencing blobs by hash, identical responses and sub-objects stored once), unpack them or remove unreferenced blobs")
+    print("")
+    print("-h print this help")
+    print("-b blockchain, comma-separated list [default: goerly,mainnet]")
+    print("-a <action>: pack, unpack or gc (unreferenced blobs removal, run on all the chains) [default: pack]")
+    print("-d <dir> golden store directory [default: " + DEFAULT_GOLDEN_STORE_DIR + "]")
+    print("-s <bytes> min size of the canonical JSON of the values stored as blobs [default: " + str(DEFAULT_MIN_SIZE) + "]")
+    print("-n dry run, just print the changes")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and pack, unpack or collect the garbage of the golden store
+    """
+    nets = "goerly,mainnet"
+    action = PACK
+    directory = DEFAULT_GOLDEN_STORE_DIR
+    min_size = DEFAULT_MIN_SIZE
+    dry_run = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hb:a:d:s:n")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-b":
+                nets = optarg
+            elif option == "-a":
+                action = optarg
+                if action not in (PACK, UNPACK, GC):
+                    print("unsupported action: " + action)
+                    sys.exit(-1)
+            elif option == "-d":
+                directory = optarg
+            elif option == "-s":
+                min_size = int(optarg)
+            elif option == "-n":
+                dry_run = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    golden_store = GoldenStore(directory)
+    # with dry run the blobs are written into a scratch store
+    blob_store = GoldenStore(tempfile.mkdtemp()) if dry_run and action == PACK else golden_store
+    test_files = get_test_files(nets.split(","))
+    if action == GC:
+        if os.path.isdir(directory):
+            removed = collect_garbage(test_files, golden_store, dry_run)
+            print(f"Number of removed blobs: {removed}")
+        return
+
+    total_size = 0
+    total_new_size = 0
+    for test_file in test_files:
+        with open(test_file, 'rb') as json_file:
+            buff = json_file.read()
+        if action == UNPACK and b'"' + GOLDEN_REFERENCE.encode() + b'"' not in buff:
+            continue
+        # packing is idempotent: the test file is resolved before
+        jsonrpc_commands = golden_store.resolve(json.loads(buff))
+        if action == PACK:
+            jsonrpc_commands = pack_commands(jsonrpc_commands, blob_store, min_size)
+            if not any(GOLDEN_REFERENCE in json.dumps(json_rpc) for json_rpc in jsonrpc_commands):
+                continue
+        new_buff = (json.dumps(jsonrpc_commands, indent=4) + "\n").encode()
+        total_size = total_size + len(buff)
+        total_new_size = total_new_size + len(new_buff)
+        print(f"{test_file} ({len(buff)} -> {len(new_buff)} bytes)")
+        if not dry_run:
+            with open(test_file, 'wb') as json_file:
+                json_file.write(new_buff)
+    blob_count, store_size = get_store_size(blob_store.directory)
+    if blob_store is not golden_store:
+        shutil.rmtree(blob_store.directory)
+    print(f"Test files size: {total_size} -> {total_new_size} bytes")
+    print(f"Golden store:    {blob_count} blobs, {store_size} bytes")
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
@@ -0,0 +1,145 @@
+#!/usr/bin/python3
+""" Send a JSON-RPC request over the IPC socket of the daemon, as curl does over HTTP for run_tests.py (ipc transport) """
+
+import getopt
+import json
+import re
+import socket
+import sys
+import time
+
+# curl exit codes of the failures, classified the same way by run_tests.py
+CURL_INIT_EXIT_CODE = 2
+CURL_CONNECT_EXIT_CODE = 7
+CURL_TIMEOUT_EXIT_CODE = 28
+CURL_RECV_EXIT_CODE = 56
+RECV_SIZE = 1024 * 1024
+WRITE_OUT_PATTERN = re.compile(r"%\{(\w+)\}")
+
+
+def read_response(sock):
+    """ return the bytes of the JSON value read from the socket (no length framing: read until it parses, the large
+        responses in many chunks), raise ConnectionError if closed before
+    """
+    response = b""
+    while True:
+        chunk = sock.recv(RECV_SIZE)
+        if chunk == b"":
+            raise ConnectionError("connection closed before the end of the response")
+        response = response + chunk
+        # attempt to parse only when the value may be complete
+        if response.rstrip()[-1:] not in (b"}", b"]"):
+            continue
+        try:
+            json.loads(response)
+            return response
+        except ValueError:
+            continue
+
+
+def write_out(write_out_format: str, variables):
+    """ write the curl --write-out format with the variables of the request, %{stderr} and %{stdout} switching output """
+    output = sys.stdout
+    position = 0
+    for match in WRITE_OUT_PATTERN.finditer(write_out_format):
+        output.write(write_out_format[position:match.start()])
+        position = match.end()
+        if match.group(1) in ("stderr", "stdout"):
+            output.flush()
+            output = sys.stderr if match.group(1) == "stderr" else sys.stdout
+        else:
+            output.write(str(variables.get(match.group(1), "")))
+    output.write(write_out_format[position:])
+    output.flush()
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + " --ipc-path <path> [--data <request>|--data-binary @-|@<file>] [options]:", file=sys.stderr)
+    print("", file=sys.stderr)
+    print("Send the JSON-RPC request over the IPC socket, the response on stdout, with the curl options used by run_tests.py:",
+          file=sys.stderr)
+    print("--output <file>, --write-out <format> (http_code 200 once answered, size_* and time_* variables), --max-time <secs>",
+          file=sys.stderr)
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, send the request and write the response as curl does
+    """
+    ipc_path = ""
+    request = None
+    output_file = ""
+    write_out_format = ""
+    max_time = None
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "", ["ipc-path=", "data=", "data-binary=", "output=", "write-out=", "max-time="])
+        for option, optarg in opts:
+            if option == "--ipc-path":
+                ipc_path = optarg
+            elif option == "--data":
+                request = optarg.encode()
+            elif option == "--data-binary":
+                if optarg == "@-":
+                    request = sys.stdin.buffer.read()
+                elif optarg.startswith("@"):
+                    with open(optarg[1:], 'rb') as request_file:
+                        request = request_file.read()
+                else:
+                    request = optarg.encode()
+            elif option == "--output":
+                output_file = optarg
+            elif option == "--write-out":
+                write_out_format = optarg
+            elif option == "--max-time":
+                max_time = float(optarg)
+    except (getopt.GetoptError, ValueError, OSError) as err:
+        print(err, file=sys.stderr)
+        usage(argv)
+        sys.exit(CURL_INIT_EXIT_CODE)
+    if ipc_path == "" or request is None:
+        usage(argv)
+        sys.exit(CURL_INIT_EXIT_CODE)
+
+    variables = {"http_code": "000", "size_request": 0, "size_upload": len(request), "size_header": 0, "size_download": 0,
+                 "time_namelookup": 0, "time_connect": 0, "time_appconnect": 0, "time_starttransfer": 0, "time_total": 0}
+    start_time = time.time()
+    exit_code = 0
+    try:
+        with socket.socket(socket.AF_UNIX, socket.SOCK_STREAM) as sock:
+            sock.settimeout(max_time)
+            sock.connect(ipc_path)
+            variables["time_connect"] = time.time() - start_time
+            sock.sendall(request)
+            response = read_response(sock)
+    except TimeoutError:
+        exit_code = CURL_TIMEOUT_EXIT_CODE
+    except (FileNotFoundError, ConnectionRefusedError):
+        exit_code = CURL_CONNECT_EXIT_CODE
+    except OSError:
+        exit_code = CURL_RECV_EXIT_CODE
+    variables["time_total"] = time.time() - start_time
+    if exit_code == 0:
+        variables["http_code"] = "200"
+        variables["size_download"] = len(response)
+        variables["time_starttransfer"] = variables["time_total"]
+        if output_file != "":
+            with open(output_file, 'wb') as response_file:
+                response_file.write(response)
+        else:
+            sys.stdout.buffer.write(response)
+            sys.stdout.flush()
+    if write_out_format != "":
+        write_out(write_out_format, variables)
+    sys.exit(exit_code)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
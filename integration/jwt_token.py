@@ -0,0 +1,107 @@
+#!/usr/bin/python3
+""" Generate JWT tokens for the Engine API with arbitrary claims, e.g. to debug authentication issues """
+
+import getopt
+import json
+import sys
+
+from run_tests import get_jwt_secret, get_jwt_token
+
+ALGORITHMS = ["HS256", "HS384", "HS512", "none"]
+
+
+def parse_claim(claim: str):
+    """ parse the claim name=value, the value as JSON if valid (e.g. number) else as string
+    """
+    name, _, value = claim.partition("=")
+    try:
+        return name, json.loads(value)
+    except json.decoder.JSONDecodeError:
+        return name, value
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Generate a JWT token for the Engine API signed by the secret, with custom issued at skew, expiration, algorithm")
+    print("and claims")
+    print("")
+    print("-h print this help")
+    print("-k <file> authentication token file (secret)")
+    print("-s <hex> raw hex secret (e.g. 0x7365637265742d6b6579...)")
+    print("-i <secs> issued at (iat) skew from now, negative in the past [default: 0]")
+    print("-e <secs> expiration (exp) after secs from now [default: no exp claim]")
+    print("-a <alg> signing algorithm " + "/".join(ALGORITHMS) + " [default: HS256]")
+    print("-c <name=value> additional claim (e.g. id=node-1), repeatable")
+    print("-H print the token as curl authorization header")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and print the token
+    """
+    jwt_secret = ""
+    iat_skew = 0
+    expires_in = None
+    algorithm = "HS256"
+    claims = {}
+    curl_header = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hk:s:i:e:a:c:H")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-k":
+                jwt_secret = get_jwt_secret(optarg)
+                if jwt_secret == "":
+                    print("secret file not found")
+                    sys.exit(-1)
+            elif option == "-s":
+                jwt_secret = optarg
+            elif option == "-i":
+                iat_skew = int(optarg)
+            elif option == "-e":
+                expires_in = int(optarg)
+            elif option == "-a":
+                if optarg not in ALGORITHMS:
+                    print("unsupported algorithm: " + optarg)
+                    sys.exit(-1)
+                algorithm = optarg
+            elif option == "-c":
+                name, value = parse_claim(optarg)
+                claims[name] = value
+            elif option == "-H":
+                curl_header = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+    if jwt_secret == "" and algorithm != "none":
+        print("secret required (-k or -s)")
+        usage(argv)
+        sys.exit(-1)
+
+    try:
+        token = get_jwt_token(jwt_secret.strip(), iat_skew, expires_in, algorithm, claims)
+    except ValueError:
+        print("invalid hex secret")
+        sys.exit(-1)
+    print("-H \"Authorization: Bearer " + token + "\"" if curl_header else token)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
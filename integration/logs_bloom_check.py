@@ -0,0 +1,165 @@
+#!/usr/bin/python3
+""" Verify the logs bloom of the block headers and of the receipts against the logs of eth_getBlockReceipts """
+
+import getopt
+import sys
+
+from web3 import Web3
+
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, follow_blocks, print_range_usage, \
+    print_target_usage
+
+DEFAULT_COUNT = 16
+DEFAULT_POLL_INTERVAL = 2
+BLOOM_BITS = 2048
+
+
+def get_log_bloom(log):
+    """ return the bloom (as int, bit i of the big endian 256 bytes) of the address and the topics of the log: for each of
+        them the 3 bits given by the low 11 bits of the first 3 byte pairs of its keccak
+    """
+    bloom = 0
+    for value in [log.get("address", "0x")] + (log.get("topics") or []):
+        digest = bytes(Web3.keccak(hexstr=value))
+        for index in (0, 2, 4):
+            bloom = bloom | (1 << (int.from_bytes(digest[index:index + 2], "big") % BLOOM_BITS))
+    return bloom
+
+
+def to_bloom(value):
+    """ return the bloom of the hex logsBloom field, None if missing or not of 256 bytes
+    """
+    if not isinstance(value, str) or len(value) != 2 + BLOOM_BITS // 4:
+        return None
+    return int(value, 16)
+
+
+def find_missing_log(logs, bloom: int):
+    """ return the description of the first log whose bits are not all set in the bloom, empty string if none
+    """
+    for log in logs:
+        log_bloom = get_log_bloom(log)
+        if log_bloom & bloom != log_bloom:
+            return f"log {int(log.get('logIndex', '0x0'), 16)} of {log.get('address')} not in bloom"
+    return ""
+
+
+def check_bloom(logs, bloom: int):
+    """ compare the bloom with the one recomputed from the logs, return the mismatch pinpointing the offending log or the
+        extra bits, empty string if equal
+    """
+    expected = 0
+    for log in logs:
+        expected = expected | get_log_bloom(log)
+    if bloom == expected:
+        return ""
+    missing = find_missing_log(logs, bloom)
+    if missing != "":
+        return missing
+    extra = bloom & ~expected
+    return f"{bin(extra).count('1')} bits set not matching any log (first bit {(extra & -extra).bit_length() - 1})"
+
+
+def check_block(target: str, block_number: int):
+    """ check the logs bloom of each receipt and of the header against the logs of the receipts, return the mismatch or
+        empty string
+    """
+    block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+    if not isinstance(block, dict):
+        return "block not available"
+    # by hash, so that the receipts are the ones of the header even across a reorg
+    receipts = call_daemon(target, "eth_getBlockReceipts", [block["hash"]])
+    if not isinstance(receipts, list):
+        return "eth_getBlockReceipts failed"
+    header_bloom = to_bloom(block.get("logsBloom"))
+    if header_bloom is None:
+        return f"header logsBloom {block.get('logsBloom')} malformed"
+    block_logs = []
+    for receipt in receipts:
+        logs = receipt.get("logs") or []
+        receipt_bloom = to_bloom(receipt.get("logsBloom"))
+        if receipt_bloom is None:
+            return f"receipt of tx {receipt.get('transactionHash')} logsBloom {receipt.get('logsBloom')} malformed"
+        mismatch = check_bloom(logs, receipt_bloom)
+        if mismatch != "":
+            return f"receipt of tx {receipt.get('transactionHash')}: {mismatch}"
+        block_logs = block_logs + logs
+    mismatch = check_bloom(block_logs, header_bloom)
+    return f"header: {mismatch}" if mismatch != "" else ""
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Recompute the logs bloom of each receipt of eth_getBlockReceipts and of each block header from the logs, for each block")
+    print("of a range or, following the chain, for each new block: the offending log (or the extra bits) is pinpointed")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-f follow the chain checking each new block until interrupted (after the range if any)")
+    print("-i <secs> polling interval of the new blocks [default: " + str(DEFAULT_POLL_INTERVAL) + "]")
+    print("-v print the outcome of each block")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and check the blocks of the range, then the new ones if following the chain
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    follow = False
+    poll_interval = DEFAULT_POLL_INTERVAL
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "fi:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-f":
+                follow = True
+            elif option == "-i":
+                poll_interval = float(optarg)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range(follow)
+    checked = 0
+    failed = 0
+    try:
+        for block_number in follow_blocks(target, start_block, count, follow, poll_interval):
+            mismatch = check_block(target, block_number)
+            checked = checked + 1
+            if mismatch != "":
+                print(f"block {block_number}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"block {block_number}: OK")
+    except KeyboardInterrupt:
+        print("")
+    print(f"Number of checked blocks: {checked}")
+    print(f"Number of failed checks:  {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
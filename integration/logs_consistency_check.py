@@ -0,0 +1,137 @@
+#!/usr/bin/python3
+""" Cross-check eth_getLogs by block hash against the logs of eth_getBlockReceipts, following the new blocks """
+
+import getopt
+import sys
+
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, follow_blocks, print_range_usage, \
+    print_target_usage
+
+DEFAULT_COUNT = 16
+DEFAULT_POLL_INTERVAL = 2
+LOG_FIELDS = ["address", "topics", "data", "logIndex", "transactionIndex", "transactionHash", "blockHash", "blockNumber", "removed"]
+
+
+def normalize_log(log):
+    """ return the log fields compared, hex values lower case to be compared regardless of the letter case
+    """
+    normalized = {}
+    for field in LOG_FIELDS:
+        value = log.get(field)
+        if isinstance(value, str):
+            value = value.lower()
+        elif isinstance(value, list):
+            value = [item.lower() if isinstance(item, str) else item for item in value]
+        normalized[field] = value
+    return normalized
+
+
+def compare_logs(logs, receipt_logs):
+    """ compare the logs of eth_getLogs with the ones of the receipts in block order, return the first mismatch
+        (count, ordering, indices, topics or other field) or empty string
+    """
+    if len(logs) != len(receipt_logs):
+        return f"{len(logs)} logs instead of {len(receipt_logs)} in receipts"
+    for position, (log, receipt_log) in enumerate(zip(logs, receipt_logs)):
+        log = normalize_log(log)
+        receipt_log = normalize_log(receipt_log)
+        if log["logIndex"] != receipt_log["logIndex"]:
+            return f"log {position} logIndex {log['logIndex']} vs {receipt_log['logIndex']} (ordering or indices)"
+        for field in LOG_FIELDS:
+            if log[field] != receipt_log[field]:
+                return f"log {position} (logIndex {receipt_log['logIndex']}) {field} {log[field]} vs {receipt_log[field]}"
+    return ""
+
+
+def check_block(target: str, block_number: int):
+    """ fetch the logs of the block by hash with both methods and compare them, return the mismatch or empty string
+    """
+    block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+    if not isinstance(block, dict):
+        return "block not available"
+    # by hash, so that both methods see the same block even across a reorg
+    logs = call_daemon(target, "eth_getLogs", [{"blockHash": block["hash"]}])
+    receipts = call_daemon(target, "eth_getBlockReceipts", [block["hash"]])
+    if not isinstance(logs, list):
+        return "eth_getLogs failed"
+    if not isinstance(receipts, list):
+        return "eth_getBlockReceipts failed"
+    receipt_logs = [log for receipt in receipts for log in receipt.get("logs") or []]
+    return compare_logs(logs, receipt_logs)
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Cross-check the logs of eth_getLogs (by block hash) and eth_getBlockReceipts for each block of a range or, following")
+    print("the chain, for each new block: count, ordering, indices, topics and the other log fields must be identical")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-f follow the chain checking each new block until interrupted (after the range if any)")
+    print("-i <secs> polling interval of the new blocks [default: " + str(DEFAULT_POLL_INTERVAL) + "]")
+    print("-v print the outcome of each block")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and check the blocks of the range, then the new ones if following the chain
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    follow = False
+    poll_interval = DEFAULT_POLL_INTERVAL
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "fi:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-f":
+                follow = True
+            elif option == "-i":
+                poll_interval = float(optarg)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range(follow)
+    checked = 0
+    failed = 0
+    try:
+        for block_number in follow_blocks(target, start_block, count, follow, poll_interval):
+            mismatch = check_block(target, block_number)
+            checked = checked + 1
+            if mismatch != "":
+                print(f"block {block_number}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"block {block_number}: OK")
+    except KeyboardInterrupt:
+        print("")
+    print(f"Number of checked blocks: {checked}")
+    print(f"Number of failed checks:  {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
@@ -0,0 +1,130 @@
+""" Merkle Patricia trie root of the ordered lists of the block (transactions, receipts, withdrawals) and walk of the proofs of the
+    state and storage tries (eth_getProof), shared by the checkers
+"""
+
+from web3 import Web3
+
+from rlp_codec import rlp_decode, rlp_encode
+
+# root of the empty trie, i.e. keccak of the RLP empty string
+EMPTY_TRIE_ROOT = bytes.fromhex("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+
+def to_nibbles(key: bytes):
+    """ return the key as list of nibbles, high nibble first
+    """
+    return [nibble for byte in key for nibble in (byte >> 4, byte & 0x0f)]
+
+
+def encode_path(nibbles, leaf: bool):
+    """ return the hex prefix encoding of the path of a leaf or extension node
+    """
+    flag = 2 if leaf else 0
+    if len(nibbles) % 2 == 1:
+        nibbles = [flag + 1] + list(nibbles)
+    else:
+        nibbles = [flag, 0] + list(nibbles)
+    return bytes(nibbles[index] << 4 | nibbles[index + 1] for index in range(0, len(nibbles), 2))
+
+
+def decode_path(encoded: bytes):
+    """ return the nibbles of the hex prefix encoded path and whether it is the one of a leaf node
+    """
+    nibbles = to_nibbles(encoded)
+    if len(nibbles) == 0 or nibbles[0] > 3:
+        raise ValueError(f"path flag of {encoded.hex()}")
+    return nibbles[1 if nibbles[0] % 2 == 1 else 2:], nibbles[0] >= 2
+
+
+def get_reference(node):
+    """ return the reference of the node in its parent: the node itself if its encoding is shorter than 32 bytes, its hash
+        otherwise
+    """
+    encoded = rlp_encode(node)
+    return node if len(encoded) < 32 else bytes(Web3.keccak(encoded))
+
+
+def build_node(entries):
+    """ return the node (RLP item) of the trie of the entries (nibbles of the key, value), not empty and of distinct keys
+    """
+    if len(entries) == 1:
+        return [encode_path(entries[0][0], True), entries[0][1]]
+    prefix_length = 0
+    while all(len(nibbles) > prefix_length and nibbles[prefix_length] == entries[0][0][prefix_length] for nibbles, _ in entries):
+        prefix_length = prefix_length + 1
+    if prefix_length > 0:
+        child = build_node([(nibbles[prefix_length:], value) for nibbles, value in entries])
+        return [encode_path(entries[0][0][:prefix_length], False), get_reference(child)]
+    branch = [b""] * 17
+    for nibble in range(16):
+        children = [(nibbles[1:], value) for nibbles, value in entries if len(nibbles) > 0 and nibbles[0] == nibble]
+        if len(children) > 0:
+            branch[nibble] = get_reference(build_node(children))
+    for nibbles, value in entries:
+        if len(nibbles) == 0:
+            branch[16] = value
+    return branch
+
+
+def get_trie_root(items):
+    """ return the root of the trie of the encoded items keyed by the RLP of their index, as the ordered lists of the block
+    """
+    if len(items) == 0:
+        return EMPTY_TRIE_ROOT
+    entries = [(to_nibbles(rlp_encode(index)), item) for index, item in enumerate(items)]
+    return bytes(Web3.keccak(rlp_encode(build_node(entries))))
+
+
+def get_proof_value(root: bytes, key: bytes, proof):
+    """ return the value of the key of the secure trie (path given by the keccak of the key) proven by the nodes of the proof
+        from the root, None if the proof shows the key absent, raise ValueError if the proof is not valid
+    """
+    if root == EMPTY_TRIE_ROOT and len(proof) == 0:
+        return None
+    nibbles = to_nibbles(bytes(Web3.keccak(key)))
+    position = 0
+    reference = root
+    used = 0
+    while True:
+        if isinstance(reference, list):
+            # node embedded in its parent
+            node = reference
+        elif reference == b"":
+            # empty slot of a branch: the key is not in the trie
+            value = None
+            break
+        else:
+            if used >= len(proof):
+                raise ValueError(f"proof truncated after {used} nodes")
+            if bytes(Web3.keccak(proof[used])) != reference:
+                raise ValueError(f"node {used} hash not matching the reference {reference.hex()}")
+            node = rlp_decode(proof[used])
+            used = used + 1
+            if node == b"" and used == 1:
+                # root node of the empty trie
+                value = None
+                break
+        if not isinstance(node, list) or len(node) not in (2, 17):
+            raise ValueError(f"node {used - 1} malformed")
+        if len(node) == 17:
+            if position == len(nibbles):
+                value = node[16] if node[16] != b"" else None
+                break
+            reference = node[nibbles[position]]
+            position = position + 1
+            continue
+        path, leaf = decode_path(node[0])
+        if nibbles[position:position + len(path)] != path:
+            # diverging path: the key is not in the trie
+            value = None
+            break
+        position = position + len(path)
+        if leaf:
+            if position != len(nibbles):
+                raise ValueError(f"leaf at nibble {position} of {len(nibbles)}")
+            value = node[1]
+            break
+        reference = node[1]
+    if used != len(proof):
+        raise ValueError(f"{len(proof) - used} nodes beyond the proven path")
+    return value
@@ -0,0 +1,141 @@
+#!/usr/bin/python3
+""" Recompress the archived (.tar, .tar.gz, .tar.zst) test files of the integration test suite """
+
+import getopt
+import gzip
+import os
+import subprocess
+import sys
+
+ZSTD = "zst"
+TAR = "tar"
+ARCHIVE_EXTENSIONS = (".tar.zst", ".tar.gz", ".tar")
+
+
+def get_archive_extension(file_name: str):
+    """ return the archive extension of file_name or empty string if not archive
+    """
+    for ext in ARCHIVE_EXTENSIONS:
+        if file_name.endswith(ext):
+            return ext
+    return ""
+
+
+def read_tar(file_name: str, ext: str):
+    """ return the uncompressed tar content of the archive
+    """
+    if ext == ".tar.gz":
+        with gzip.open(file_name, 'rb') as zipped_file:
+            return zipped_file.read()
+    if ext == ".tar.zst":
+        process = subprocess.run(["zstd", "-d", "-c", "-q", file_name], stdout=subprocess.PIPE, check=True)
+        return process.stdout
+    with open(file_name, 'rb') as tar_file:
+        return tar_file.read()
+
+
+def write_archive(file_name: str, buff: bytes, to_format: str, level: int):
+    """ write the tar content into file_name compressed as requested
+    """
+    if to_format == ZSTD:
+        subprocess.run(["zstd", "-q", "-f", "-" + str(level), "-o", file_name], input=buff, check=True)
+    else:
+        with open(file_name, 'wb') as tar_file:
+            tar_file.write(buff)
+
+
+def migrate(file_name: str, to_format: str, level: int, dry_run: bool):
+    """ recompress one archive, return the pair of sizes before and after
+    """
+    ext = get_archive_extension(file_name)
+    new_file_name = file_name[:-len(ext)] + (".tar.zst" if to_format == ZSTD else ".tar")
+    if new_file_name == file_name:
+        return 0, 0
+    size = os.stat(file_name).st_size
+    if dry_run:
+        print(f"{file_name} -> {new_file_name}")
+        return size, size
+    buff = read_tar(file_name, ext)
+    write_archive(new_file_name, buff, to_format, level)
+    os.remove(file_name)
+    new_size = os.stat(new_file_name).st_size
+    print(f"{file_name} -> {new_file_name} ({size} -> {new_size} bytes)")
+    return size, new_size
+
+
+#
+# usage
+#
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Recompress the archived test files (.tar, .tar.gz, .tar.zst) of the integration test suite")
+    print("")
+    print("-h print this help")
+    print("-b blockchain, comma-separated list [default: goerly,mainnet]")
+    print("-t <format>: target format zst or tar [default: zst]")
+    print("-l <level>: zstd compression level [default: 19]")
+    print("-n dry run, just print the files to be recompressed")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and recompress archives
+    """
+    nets = "goerly,mainnet"
+    to_format = ZSTD
+    level = 19
+    dry_run = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "hb:t:l:n", ["to="])
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif option == "-b":
+                nets = optarg
+            elif option in ("-t", "--to"):
+                to_format = optarg
+                if to_format not in (ZSTD, TAR):
+                    print("unsupported format: " + to_format)
+                    sys.exit(-1)
+            elif option == "-l":
+                level = int(optarg)
+            elif option == "-n":
+                dry_run = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    total_size = 0
+    total_new_size = 0
+    for net in nets.split(","):
+        json_dir = "./" + net + "/"
+        for api_file in sorted(os.listdir(json_dir)):
+            test_dir = json_dir + api_file
+            if not os.path.isdir(test_dir):
+                continue
+            for test_name in sorted(os.listdir(test_dir)):
+                if get_archive_extension(test_name) != "":
+                    size, new_size = migrate(test_dir + "/" + test_name, to_format, level, dry_run)
+                    total_size = total_size + size
+                    total_new_size = total_new_size + new_size
+    print(f"Total size: {total_size} -> {total_new_size} bytes")
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
@@ -0,0 +1,129 @@
+#!/usr/bin/python3
+""" Scaffold a new integration test: next test number of the API, metadata skeleton and expected response captured from a node """
+
+import json
+import os
+import re
+import shlex
+import subprocess
+import sys
+
+from run_tests import INFURA, Config, get_curl_command, get_jwt_auth, get_target
+
+FROM_REFERENCE = "reference"
+FROM_TARGET = "target"
+# options of this script, the others are run_tests.py options
+NEW_TEST_OPTIONS = ["--api", "--params", "--from", "--description", "--tags"]
+TEST_NAME_PATTERN = re.compile(r"^test_(\d+)\.")
+
+
+def split_options(argv):
+    """ return the options of this script (option -> value) and the command line of the run_tests.py options
+    """
+    options = {}
+    command_line = argv[:1]
+    args = iter(argv[1:])
+    for arg in args:
+        option, _, value = arg.partition("=")
+        if option in NEW_TEST_OPTIONS:
+            options[option] = value if "=" in arg else next(args, "")
+        else:
+            command_line.append(arg)
+    return options, command_line
+
+
+def get_next_test_file(api_dir: str):
+    """ return the path of the test following the last one of the API directory (any format, e.g. test_07.tar) numbered
+        with the same zero padding, test_01.json if none
+    """
+    numbers = [match.group(1) for match in map(TEST_NAME_PATTERN.match, os.listdir(api_dir) if os.path.isdir(api_dir) else [])
+               if match is not None]
+    width = max((len(number) for number in numbers), default=2)
+    return os.path.join(api_dir, f"test_{max((int(number) for number in numbers), default=0) + 1:0{width}d}.json")
+
+
+def send(config, request, from_node: str):
+    """ send the request to the reference (or the daemon under test), return the response, None if not JSON
+    """
+    method = request["method"]
+    if from_node == FROM_REFERENCE:
+        target = get_target(config.daemon_as_reference, method, config.infura_url, config.daemon_on_host, config.daemon_on_port)
+        if config.daemon_as_reference != INFURA:
+            target = config.scheme + target
+    else:
+        target = config.scheme + get_target(config.daemon_under_test, method, config.infura_url, config.daemon_on_host,
+                                            config.daemon_on_port)
+    print("Request sent to " + from_node + " " + target)
+    cmd = get_curl_command(config, get_jwt_auth(config.jwt_secret), ''' --data-binary @- ''', target,
+                           reference=from_node == FROM_REFERENCE)
+    process = subprocess.run(shlex.split(cmd), input=json.dumps(request), stdout=subprocess.PIPE, universal_newlines=True,
+                             check=False)
+    try:
+        return json.loads(process.stdout)
+    except json.decoder.JSONDecodeError:
+        return None
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + " [run_tests.py options] --api <method> --params <JSON array> [options]:")
+    print("")
+    print("Create the next test file of the API (e.g. mainnet/eth_feeHistory/test_05.json) with the metadata skeleton, the")
+    print("request and the response of the reference configured by the run_tests.py options (e.g. -b mainnet -H 10.10.2.3 -k")
+    print("jwt.hex, -i <infura_url>, --reference-header) as expected response")
+    print("")
+    print("--api <method> method of the request, the test is added to its API directory (e.g. eth_feeHistory)")
+    print("--params <JSON array> params of the request (e.g. '[\"0x4\", \"latest\", [25, 75]]')")
+    print("--from <node> node answering the expected response: reference, target (daemon under test) [default: reference]")
+    print("--description <text> description in the test metadata [default: empty, to be filled]")
+    print("--tags <list> tags in the test metadata (e.g.: cancun,receipts)")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, capture the response and write the new test file
+    """
+    options, command_line = split_options(argv)
+    if "--api" not in options or "--params" not in options:
+        usage(argv)
+        sys.exit(-1)
+    from_node = options.get("--from", FROM_REFERENCE)
+    if from_node not in (FROM_REFERENCE, FROM_TARGET):
+        print("invalid node: " + from_node)
+        sys.exit(-1)
+    try:
+        params = json.loads(options["--params"])
+    except json.decoder.JSONDecodeError as err:
+        print("invalid params: " + str(err))
+        sys.exit(-1)
+    if not isinstance(params, list):
+        print("invalid params: JSON array expected")
+        sys.exit(-1)
+    config = Config(command_line)
+
+    request = {"jsonrpc": "2.0", "method": options["--api"], "params": params, "id": 1}
+    response = send(config, request, from_node)
+    if response is None:
+        print("no JSON response from " + from_node + ": test not created")
+        sys.exit(1)
+    if isinstance(response, dict) and "error" in response:
+        print("Error response captured (negative test): " + json.dumps(response["error"]))
+    metadata = {"description": options.get("--description", "")}
+    if options.get("--tags", "") != "":
+        metadata["tags"] = options["--tags"].split(",")
+    test_file = get_next_test_file(os.path.join(config.json_dir, options["--api"]))
+    os.makedirs(os.path.dirname(test_file), exist_ok=True)
+    with open(test_file, 'w', encoding='utf8') as json_file:
+        json_file.write(json.dumps([{"test": metadata, "request": request, "response": response}], indent=4) + "\n")
+    print("Test created: " + test_file)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
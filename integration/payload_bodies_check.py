@@ -0,0 +1,132 @@
+#!/usr/bin/python3
+""" Cross-check engine_getPayloadBodiesByRange bodies against the blocks served by eth_getBlockByNumber """
+
+import getopt
+import sys
+
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, print_range_usage, print_target_usage
+from run_tests import get_jwt_auth, get_jwt_secret
+
+DEFAULT_COUNT = 32
+
+
+def normalize_withdrawals(withdrawals):
+    """ return the withdrawals with lower case hex fields, to be compared regardless of the letter case
+    """
+    if not isinstance(withdrawals, list):
+        return withdrawals
+    return [{key: value.lower() if isinstance(value, str) else value for key, value in withdrawal.items()}
+            if isinstance(withdrawal, dict) else withdrawal for withdrawal in withdrawals]
+
+
+def check_body(target: str, block_number: int, body):
+    """ compare the payload body with the block transactions (raw encoding) and withdrawals, return the mismatch
+        or empty string
+    """
+    block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+    if block is None:
+        return "" if body is None else "body of unknown block"
+    if body is None:
+        return "missing body"
+    transactions = body.get("transactions") or []
+    if len(transactions) != len(block.get("transactions", [])):
+        return f"{len(transactions)} transactions instead of {len(block.get('transactions', []))}"
+    for index, transaction in enumerate(transactions):
+        raw_transaction = call_daemon(target, "eth_getRawTransactionByBlockNumberAndIndex", [hex(block_number), hex(index)])
+        if not isinstance(raw_transaction, str) or raw_transaction.lower() != str(transaction).lower():
+            return f"transaction {index} differs"
+    if normalize_withdrawals(body.get("withdrawals")) != normalize_withdrawals(block.get("withdrawals")):
+        return "withdrawals differ"
+    return ""
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Cross-check the engine_getPayloadBodiesByRange bodies of a block range with the blocks returned by")
+    print("eth_getBlockByNumber (transaction lists as raw transactions and withdrawals)")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print("-e port where the Engine API is located (e.g. 8551) [default: 8551]")
+    print("-k <file> authentication token file of the Engine API")
+    print_range_usage(DEFAULT_COUNT, False)
+    print("-V <versions> engine_getPayloadBodiesByRange versions to check (e.g. 1,2) [default: 1]")
+    print("-v print the outcome of each block")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, request the payload bodies and compare them block by block
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    engine_port = 8551
+    jwt_secret = ""
+    versions = ["1"]
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "e:k:V:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-e":
+                engine_port = int(optarg)
+            elif option == "-k":
+                jwt_secret = get_jwt_secret(optarg)
+                if jwt_secret == "":
+                    print("secret file not found")
+                    sys.exit(-1)
+            elif option == "-V":
+                versions = optarg.split(",")
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+    if options.start_block < 0:
+        print("first block of the range (-s) required")
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    engine_target = options.get_target(engine_port)
+    start_block, count = options.get_block_range()
+    failed = 0
+    for version in versions:
+        method = "engine_getPayloadBodiesByRangeV" + version
+        bodies = call_daemon(engine_target, method, [hex(start_block), hex(count)], get_jwt_auth(jwt_secret))
+        if not isinstance(bodies, list):
+            print(f"{method} failed")
+            failed = failed + 1
+            continue
+        # trailing unavailable blocks may be omitted
+        bodies = bodies + [None] * (count - len(bodies))
+        for block_number, body in zip(range(start_block, start_block + count), bodies):
+            mismatch = check_body(target, block_number, body)
+            if mismatch != "":
+                print(f"{method} block {block_number}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"{method} block {block_number}: OK")
+    print(f"Number of failed checks: {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
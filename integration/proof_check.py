@@ -0,0 +1,176 @@
+#!/usr/bin/python3
+""" Verify the account and storage proofs of eth_getProof against the state root of the block header """
+
+import getopt
+import sys
+
+from merkle_trie import EMPTY_TRIE_ROOT, get_proof_value
+from rlp_codec import rlp_decode, rlp_encode
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, print_range_usage, print_target_usage, \
+    sample_transactions, to_bytes
+
+DEFAULT_COUNT = 4
+DEFAULT_SAMPLE = 4
+# code hash of the accounts without code, i.e. keccak of the empty string
+EMPTY_CODE_HASH = "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"
+ACCOUNT_FIELDS = ["nonce", "balance", "storageHash", "codeHash"]
+
+
+def sample_accounts(block, sample: int):
+    """ return the accounts (address -> storage slots) of the transactions sampled in the full block: sender and recipient,
+        the latter with its slot 0 and the slots of the access list
+    """
+    accounts = {}
+    for transaction in sample_transactions(block.get("transactions", []), sample):
+        accounts.setdefault(transaction["from"].lower(), [])
+        if transaction.get("to") is None:
+            continue
+        slots = accounts.setdefault(transaction["to"].lower(), [])
+        for entry in [{"address": transaction["to"], "storageKeys": ["0x" + "00" * 32]}] + (transaction.get("accessList") or []):
+            if entry["address"].lower() == transaction["to"].lower():
+                slots.extend(key.lower() for key in entry["storageKeys"] if key.lower() not in slots)
+    return accounts
+
+
+def check_account_proof(state_root: bytes, address: str, proof):
+    """ walk the account proof from the state root and compare the proven account with the fields of eth_getProof,
+        return the mismatch or empty string
+    """
+    try:
+        value = get_proof_value(state_root, to_bytes(address), [to_bytes(node) for node in proof["accountProof"]])
+    except ValueError as error:
+        return f"account proof: {error}"
+    fields = [int(proof["nonce"], 16), int(proof["balance"], 16), to_bytes(proof["storageHash"]), to_bytes(proof["codeHash"])]
+    if value is None:
+        # absent account: empty one
+        if fields != [0, 0, EMPTY_TRIE_ROOT, to_bytes(EMPTY_CODE_HASH)]:
+            return "account proven absent but not empty"
+        return ""
+    if value != rlp_encode(fields):
+        try:
+            proven = rlp_decode(value)
+        except ValueError as error:
+            return f"account proof: leaf value {error}"
+        for field, proven_value, proof_value in zip(ACCOUNT_FIELDS, proven, rlp_decode(rlp_encode(fields))):
+            if proven_value != proof_value:
+                return f"{field} {proof[field]} instead of proven 0x{proven_value.hex()}"
+        return "account proof: leaf value not an account"
+    return ""
+
+
+def check_storage_proof(storage_root: bytes, storage_proof):
+    """ walk the storage proof from the storage root and compare the proven value with the one of eth_getProof, return
+        the mismatch or empty string
+    """
+    slot = int(storage_proof["key"], 16).to_bytes(32, "big")
+    try:
+        value = get_proof_value(storage_root, slot, [to_bytes(node) for node in storage_proof["proof"]])
+        proven = 0 if value is None else int.from_bytes(rlp_decode(value), "big")
+    except ValueError as error:
+        return f"storage proof of slot {storage_proof['key']}: {error}"
+    if proven != int(storage_proof["value"], 16):
+        return f"slot {storage_proof['key']} value {storage_proof['value']} instead of proven {hex(proven)}"
+    return ""
+
+
+def check_account(target: str, block, address: str, slots):
+    """ check the proofs of the account and of its storage slots at the block, the balance and nonce with eth_getBalance and
+        eth_getTransactionCount, return the mismatch or empty string
+    """
+    proof = call_daemon(target, "eth_getProof", [address, slots, block["number"]])
+    if not isinstance(proof, dict):
+        return "eth_getProof failed"
+    mismatch = check_account_proof(to_bytes(block["stateRoot"]), address, proof)
+    if mismatch != "":
+        return mismatch
+    for method, field in (("eth_getBalance", "balance"), ("eth_getTransactionCount", "nonce")):
+        value = call_daemon(target, method, [address, block["number"]])
+        if not isinstance(value, str) or int(value, 16) != int(proof[field], 16):
+            return f"{method} {value} instead of {field} {proof[field]}"
+    storage_proofs = proof.get("storageProof") or []
+    if len(storage_proofs) != len(slots):
+        return f"{len(storage_proofs)} storage proofs instead of {len(slots)}"
+    for storage_proof in storage_proofs:
+        mismatch = check_storage_proof(to_bytes(proof["storageHash"]), storage_proof)
+        if mismatch != "":
+            return mismatch
+    return ""
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Verify eth_getProof locally for the accounts sampled in a block range (senders and recipients of the sampled")
+    print("transactions, the storage slot 0 and the access list slots of the recipients): walk the account proof from the")
+    print("stateRoot of the header and the storage proofs from the storageHash, compare the proven values with the returned ones")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-S <count> transactions sampled per block [default: " + str(DEFAULT_SAMPLE) + "]")
+    print("-v print the outcome of each account")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, sample the accounts of the range and verify their proofs
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    sample = DEFAULT_SAMPLE
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "S:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-S":
+                sample = int(optarg)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range()
+    accounts = 0
+    slots = 0
+    failed = 0
+    for block_number in range(start_block, start_block + count):
+        block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), True])
+        if not isinstance(block, dict):
+            print(f"block {block_number}: Failed (block not available)")
+            failed = failed + 1
+            continue
+        for address, account_slots in sample_accounts(block, sample).items():
+            mismatch = check_account(target, block, address, account_slots)
+            accounts = accounts + 1
+            slots = slots + len(account_slots)
+            if mismatch != "":
+                print(f"block {block_number} account {address}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"block {block_number} account {address} ({len(account_slots)} slots): OK")
+    print(f"Number of checked accounts: {accounts} ({slots} storage slots)")
+    print(f"Number of failed checks:    {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
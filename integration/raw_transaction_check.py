@@ -0,0 +1,174 @@
+#!/usr/bin/python3
+""" Validate the raw transactions of eth_getRawTransaction* by RLP round trip, hash and fields of eth_getTransactionByHash """
+
+import getopt
+import sys
+
+from web3 import Web3
+
+from rlp_codec import AUTHORIZATION_FIELDS, DATA_FIELDS, LEGACY_FIELDS, LEGACY_TYPE, TRANSACTION_FIELDS, \
+    decode_transaction_envelope, encode_transaction_envelope
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, print_range_usage, print_target_usage, \
+    sample_transactions
+
+DEFAULT_COUNT = 16
+DEFAULT_SAMPLE = 4
+
+
+def to_json_value(field: str, value):
+    """ return the decoded RLP value in the terms of the JSON transaction: quantity as int, data as lower case hex,
+        access list and authorization list as lists of objects
+    """
+    if field == "accessList":
+        return [{"address": "0x" + entry[0].hex(), "storageKeys": ["0x" + key.hex() for key in entry[1]]} for entry in value]
+    if field == "authorizationList":
+        return [{name: to_json_value(name, item) for name, item in zip(AUTHORIZATION_FIELDS, entry)} for entry in value]
+    if field == "blobVersionedHashes":
+        return ["0x" + blob_hash.hex() for blob_hash in value]
+    if field in DATA_FIELDS:
+        return "0x" + value.hex() if field != "to" or len(value) > 0 else None
+    return int.from_bytes(value, "big")
+
+
+def decode_transaction(raw: bytes):
+    """ return the type, the RLP items and the fields of the raw transaction (legacy or typed), raise ValueError if malformed
+        or of unsupported type
+    """
+    transaction_type, items = decode_transaction_envelope(raw)
+    names = LEGACY_FIELDS if transaction_type == LEGACY_TYPE else TRANSACTION_FIELDS[transaction_type]
+    fields = {name: to_json_value(name, item) for name, item in zip(names, items)}
+    if transaction_type == LEGACY_TYPE and fields["v"] >= 35:
+        # EIP-155 replay protected
+        fields["chainId"] = (fields["v"] - 35) // 2
+    return transaction_type, items, fields
+
+
+def normalize_json_value(field: str, value):
+    """ return the field of the JSON transaction in the terms of the decoded one (quantity as int, data lower case)
+    """
+    if value is None:
+        return None
+    if field == "accessList":
+        return [{"address": entry["address"].lower(), "storageKeys": [key.lower() for key in entry["storageKeys"]]} for entry in value]
+    if field == "authorizationList":
+        return [{name: normalize_json_value(name, entry.get(name)) for name in AUTHORIZATION_FIELDS} for entry in value]
+    if field == "blobVersionedHashes":
+        return [blob_hash.lower() for blob_hash in value]
+    if field in DATA_FIELDS:
+        return value.lower()
+    return int(value, 16)
+
+
+def check_transaction(target: str, tx_hash: str, block_number: int, index: int):
+    """ check the raw transaction by hash and by block number and index: RLP round trip, hash and fields of the JSON
+        transaction, return the type and the mismatch or empty string
+    """
+    raw_hex = call_daemon(target, "eth_getRawTransactionByHash", [tx_hash])
+    if not isinstance(raw_hex, str):
+        return None, "eth_getRawTransactionByHash failed"
+    raw_by_index = call_daemon(target, "eth_getRawTransactionByBlockNumberAndIndex", [hex(block_number), hex(index)])
+    if not isinstance(raw_by_index, str) or raw_by_index.lower() != raw_hex.lower():
+        return None, "eth_getRawTransactionByBlockNumberAndIndex differs from eth_getRawTransactionByHash"
+    raw = bytes.fromhex(raw_hex[2:])
+    try:
+        transaction_type, items, fields = decode_transaction(raw)
+    except ValueError as error:
+        return None, "decoding: " + str(error)
+    if encode_transaction_envelope(transaction_type, items) != raw:
+        return transaction_type, "RLP round trip differs (non canonical encoding)"
+    if Web3.keccak(raw).hex().removeprefix("0x") != tx_hash.lower().removeprefix("0x"):
+        return transaction_type, f"hash {Web3.keccak(raw).hex()} instead of {tx_hash}"
+    transaction = call_daemon(target, "eth_getTransactionByHash", [tx_hash])
+    if not isinstance(transaction, dict):
+        return transaction_type, "eth_getTransactionByHash failed"
+    if int(transaction.get("type", "0x0"), 16) != transaction_type:
+        return transaction_type, f"type {transaction.get('type')} instead of {hex(transaction_type)}"
+    for field, value in fields.items():
+        # yParity of typed transactions may be given as v only
+        json_field = "v" if field == "yParity" and "yParity" not in transaction else field
+        if field == "chainId" and "chainId" not in transaction and transaction_type == LEGACY_TYPE:
+            continue
+        json_value = normalize_json_value(field, transaction.get(json_field))
+        if json_value != value:
+            return transaction_type, f"{field} {transaction.get(json_field)} instead of {hex(value) if isinstance(value, int) else value}"
+    return transaction_type, ""
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Validate the raw transactions sampled in a block range without golden files: decode the raw transaction of")
+    print("eth_getRawTransactionByHash and ByBlockNumberAndIndex (legacy, 2930, 1559, 4844, 7702), re-encode it, recompute the hash")
+    print("and compare the decoded fields with the ones of eth_getTransactionByHash")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-S <count> transactions sampled per block [default: " + str(DEFAULT_SAMPLE) + "]")
+    print("-v print the outcome of each transaction")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, sample the transactions of the range and validate their raw encoding
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    sample = DEFAULT_SAMPLE
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "S:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-S":
+                sample = int(optarg)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range()
+    checked = {}
+    failed = 0
+    for block_number in range(start_block, start_block + count):
+        block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+        if not isinstance(block, dict):
+            print(f"block {block_number}: Failed (block not available)")
+            failed = failed + 1
+            continue
+        transactions = block.get("transactions", [])
+        for tx_hash in sample_transactions(transactions, sample):
+            transaction_type, mismatch = check_transaction(target, tx_hash, block_number, transactions.index(tx_hash))
+            type_name = "unknown" if transaction_type is None else hex(transaction_type)
+            checked[type_name] = checked.get(type_name, 0) + 1
+            if mismatch != "":
+                print(f"block {block_number} tx {tx_hash} type {type_name}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"block {block_number} tx {tx_hash} type {type_name}: OK")
+    print(f"Number of checked transactions: {sum(checked.values())} "
+          f"({', '.join(f'type {name}: {number}' for name, number in sorted(checked.items()))})")
+    print(f"Number of failed checks:        {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
@@ -0,0 +1,287 @@
+#!/usr/bin/python3
+""" Reorg test on a devnet: builds two competing blocks by the Engine API and checks canonical chain, logs and removed logs """
+
+import getopt
+import json
+import os
+import sys
+import time
+
+from eth_account import Account
+from websockets.exceptions import ConnectionClosed, WebSocketException
+from websockets.sync.client import connect
+
+from rpc_helpers import TARGET_OPTIONS, ScriptOptions, call_daemon, check, get_dynamic_fees, print_target_usage, \
+    submit_transaction, to_int
+from run_tests import get_jwt_auth, get_jwt_secret
+
+DEFAULT_ENGINE_VERSION = 3
+PAYLOAD_BUILD_TIME = 1
+NOTIFICATION_TIMEOUT = 5
+# init code emitting an empty LOG0 from the constructor: PUSH1 0, PUSH1 0, LOG0, STOP
+LOG_INIT_CODE = "0x60006000a000"
+DEPLOY_GAS = 100000
+ZERO_HASH = "0x" + "00" * 32
+FEE_RECIPIENTS = {"A": "0x" + "00" * 19 + "0a", "B": "0x" + "00" * 19 + "0b"}
+
+
+def receive_message(websocket, timeout: float):
+    """ return the next JSON message within timeout secs (pings answered by the client), None on timeout or close """
+    try:
+        return json.loads(websocket.recv(timeout=max(timeout, 0)))
+    except (TimeoutError, ConnectionClosed):
+        return None
+
+
+def subscribe_logs(websocket):
+    """ return the id of the subscription to all the logs, None on error """
+    websocket.send(json.dumps({"jsonrpc": "2.0", "method": "eth_subscribe", "params": ["logs", {}], "id": 1}))
+    while True:
+        message = receive_message(websocket, NOTIFICATION_TIMEOUT)
+        if message is None:
+            return None
+        if message.get("id") == 1:
+            return message.get("result")
+
+
+def find_log(logs, tx_hash: str, block_hash: str, removed: bool):
+    """ return True if the logs include the one of the transaction in the block, removed or not as given """
+    return any(isinstance(log, dict) and str(log.get("transactionHash")).lower() == tx_hash.lower() and
+               str(log.get("blockHash")).lower() == block_hash.lower() and bool(log.get("removed", False)) == removed
+               for log in logs or [])
+
+
+def wait_subscription_log(websocket, subscription: str, tx_hash: str, block_hash: str, removed: bool):
+    """ return True if the log of the transaction in the block is notified by the subscription within the timeout """
+    deadline = time.time() + NOTIFICATION_TIMEOUT
+    while time.time() < deadline:
+        message = receive_message(websocket, deadline - time.time())
+        if message is None:
+            return False
+        params = message.get("params") or {}
+        if params.get("subscription") == subscription and find_log([params.get("result")], tx_hash, block_hash, removed):
+            return True
+    return False
+
+
+def wait_filter_log(target: str, filter_id: str, tx_hash: str, block_hash: str, removed: bool):
+    """ return True if the log of the transaction in the block is returned by the filter changes within the timeout """
+    deadline = time.time() + NOTIFICATION_TIMEOUT
+    while True:
+        if find_log(call_daemon(target, "eth_getFilterChanges", [filter_id]), tx_hash, block_hash, removed):
+            return True
+        if time.time() >= deadline:
+            return False
+        time.sleep(1)
+
+
+def send_log_transaction(target: str, private_key: str):
+    """ sign and submit the contract creation emitting a log, return its hash or the error """
+    address = Account.from_key(private_key).address
+    transaction = {"chainId": to_int(call_daemon(target, "eth_chainId", [])),
+                   "nonce": to_int(call_daemon(target, "eth_getTransactionCount", [address, "pending"])),
+                   "value": 0, "gas": DEPLOY_GAS, "data": LOG_INIT_CODE}
+    transaction.update(get_dynamic_fees(target))
+    return submit_transaction(target, private_key, transaction)
+
+
+def build_payload(engine_target: str, jwt_secret: str, version: int, parent, fee_recipient: str):
+    """ build the payload on the parent block by forkchoiceUpdated with payload attributes and getPayload, return the
+        payload envelope and its parent beacon block root, None and the error on failure
+    """
+    attributes = {"timestamp": hex(max(to_int(parent["timestamp"]) + 1, int(time.time()))), "prevRandao": "0x" + os.urandom(32).hex(),
+                  "suggestedFeeRecipient": fee_recipient, "withdrawals": []}
+    if version >= 3:
+        attributes["parentBeaconBlockRoot"] = "0x" + os.urandom(32).hex()
+    fork_choice_state = {"headBlockHash": parent["hash"], "safeBlockHash": ZERO_HASH, "finalizedBlockHash": ZERO_HASH}
+    method = "engine_forkchoiceUpdatedV" + str(min(version, 3))
+    result = call_daemon(engine_target, method, [fork_choice_state, attributes], get_jwt_auth(jwt_secret))
+    payload_id = result.get("payloadId") if isinstance(result, dict) else None
+    if payload_id is None:
+        return None, None, method + " returned no payload id"
+    time.sleep(PAYLOAD_BUILD_TIME)
+    envelope = call_daemon(engine_target, "engine_getPayloadV" + str(version), [payload_id], get_jwt_auth(jwt_secret))
+    if not isinstance(envelope, dict) or "executionPayload" not in envelope:
+        return None, None, "engine_getPayloadV" + str(version) + " failed"
+    return envelope, attributes.get("parentBeaconBlockRoot"), ""
+
+
+def import_payload(engine_target: str, jwt_secret: str, version: int, envelope, parent_beacon_block_root: str):
+    """ import the built payload by newPayload without making it canonical, return the payload status """
+    params = [envelope["executionPayload"]]
+    if version >= 3:
+        # no blob transactions
+        params = params + [[], parent_beacon_block_root]
+    if version >= 4:
+        params.append(envelope.get("executionRequests", []))
+    status = call_daemon(engine_target, "engine_newPayloadV" + str(version), params, get_jwt_auth(jwt_secret))
+    return status.get("status") if isinstance(status, dict) else None
+
+
+def set_head(engine_target: str, jwt_secret: str, version: int, block_hash: str):
+    """ make the block canonical by forkchoiceUpdated, return the payload status """
+    fork_choice_state = {"headBlockHash": block_hash, "safeBlockHash": ZERO_HASH, "finalizedBlockHash": ZERO_HASH}
+    result = call_daemon(engine_target, "engine_forkchoiceUpdatedV" + str(min(version, 3)), [fork_choice_state, None],
+                         get_jwt_auth(jwt_secret))
+    return (result.get("payloadStatus") or {}).get("status") if isinstance(result, dict) else None
+
+
+def check_canonical(target: str, block_number: int, block_hash: str, other_hash: str, tx_hash: str, included: bool):
+    """ check the canonical block at the height, the logs and the receipt of the transaction (included or not in the block)
+        and that nothing of the other block is served anymore, return the number of failed checks
+    """
+    failed = 0
+    block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+    canonical_hash = block.get("hash") if isinstance(block, dict) else None
+    failed += check(f"eth_getBlockByNumber {block_number} canonical hash", str(canonical_hash).lower() == block_hash.lower(),
+                    f"({canonical_hash})")
+    logs = call_daemon(target, "eth_getLogs", [{"fromBlock": hex(block_number), "toBlock": hex(block_number)}])
+    failed += check(f"eth_getLogs {block_number} {'with' if included else 'without'} the log of the transaction",
+                    isinstance(logs, list) and find_log(logs, tx_hash, block_hash, False) == included)
+    failed += check(f"eth_getLogs {block_number} without the logs of the non canonical block",
+                    isinstance(logs, list) and not any(str(log.get("blockHash")).lower() == other_hash.lower() for log in logs))
+    receipt = call_daemon(target, "eth_getTransactionReceipt", [tx_hash])
+    receipt_hash = receipt.get("blockHash") if isinstance(receipt, dict) else None
+    failed += check("eth_getTransactionReceipt " + ("in the canonical block" if included else "not mined"),
+                    str(receipt_hash).lower() == block_hash.lower() if included else receipt_hash is None, f"({receipt_hash})")
+    return failed
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Reorg test on a devnet driven by this script as consensus client: builds by the Engine API two competing blocks on")
+    print("the head, A including a transaction emitting a log and B without it, then makes canonical A, B and A again checking")
+    print("eth_getBlockByNumber canonical hash, eth_getLogs, eth_getTransactionReceipt and the removed logs notified by the")
+    print("eth_newFilter filter and by the eth_subscribe logs subscription")
+    print("")
+    print("-h print this help")
+    print_target_usage("node")
+    print("-e port of the Engine API (e.g. 8551) [default: 8551]")
+    print("-k authentication token file of the Engine API")
+    print("-K <private key> hex private key of the funded devnet account")
+    print("-V <version> Engine API version: 2 (Shanghai), 3 (Cancun), 4 (Prague) [default: " + str(DEFAULT_ENGINE_VERSION) + "]")
+    print("-w <port> WebSocket port of the logs subscription (e.g. 8546) [default: 0 i.e. subscription not checked]")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, build the competing blocks and check the node across the reorgs
+    """
+    options = ScriptOptions()
+    engine_port = 8551
+    jwt_secret = ""
+    private_key = ""
+    version = DEFAULT_ENGINE_VERSION
+    ws_port = 0
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + "e:k:K:V:w:")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg):
+                continue
+            elif option == "-e":
+                engine_port = int(optarg)
+            elif option == "-k":
+                jwt_secret = get_jwt_secret(optarg)
+                if jwt_secret == "":
+                    print("secret file not found")
+                    sys.exit(-1)
+            elif option == "-K":
+                private_key = optarg
+            elif option == "-V":
+                version = int(optarg)
+                if version not in (2, 3, 4):
+                    print("unsupported Engine API version: " + optarg)
+                    sys.exit(-1)
+            elif option == "-w":
+                ws_port = int(optarg)
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+    if private_key == "" or jwt_secret == "":
+        print("private key (-K) and authentication token file (-k) required")
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    engine_target = options.get_target(engine_port)
+    head = call_daemon(target, "eth_getBlockByNumber", ["latest", False])
+    if not isinstance(head, dict):
+        print("latest block not available on " + target)
+        sys.exit(1)
+    block_number = to_int(head["number"]) + 1
+    print(f"head {to_int(head['number'])} {head['hash']}, competing blocks at {block_number}")
+
+    failed = 0
+    websocket = None
+    subscription = None
+    if ws_port > 0:
+        try:
+            websocket = connect("ws://" + options.get_target(ws_port), open_timeout=NOTIFICATION_TIMEOUT, max_size=None)
+            subscription = subscribe_logs(websocket)
+        except (OSError, ValueError, WebSocketException) as err:
+            print("WebSocket " + options.get_target(ws_port) + ": " + str(err))
+        failed += check("eth_subscribe logs", subscription is not None)
+    filter_id = call_daemon(target, "eth_newFilter", [{}])
+    failed += check("eth_newFilter", isinstance(filter_id, str))
+
+    # B built first with the transaction not yet in the pool, both built on the head while it is canonical
+    blocks = {}
+    for branch in ("B", "A"):
+        if branch == "A":
+            tx_hash, error = send_log_transaction(target, private_key)
+            failed += check("eth_sendRawTransaction (contract creation emitting a log)", tx_hash is not None, error)
+            if tx_hash is None:
+                sys.exit(1)
+        envelope, parent_beacon_block_root, error = build_payload(engine_target, jwt_secret, version, head, FEE_RECIPIENTS[branch])
+        failed += check(f"block {branch} built", envelope is not None, error)
+        if envelope is None:
+            sys.exit(1)
+        blocks[branch] = envelope["executionPayload"]
+        transactions = len(blocks[branch].get("transactions", []))
+        failed += check(f"block {branch} {'with' if branch == 'A' else 'without'} the transaction",
+                        transactions > 0 if branch == "A" else transactions == 0, f"({transactions} transactions)")
+        status = import_payload(engine_target, jwt_secret, version, envelope, parent_beacon_block_root)
+        failed += check(f"engine_newPayloadV{version} block {branch} {blocks[branch]['blockHash']}", status in ("VALID", "ACCEPTED"),
+                        f"({status})")
+
+    # A canonical, then reorg to B removing the log, then reorg back to A
+    for branch, other_branch in (("A", "B"), ("B", "A"), ("A", "B")):
+        block_hash = blocks[branch]["blockHash"]
+        print(f"head set to block {branch} {block_hash}")
+        status = set_head(engine_target, jwt_secret, version, block_hash)
+        failed += check(f"engine_forkchoiceUpdatedV{min(version, 3)} head block {branch}", status == "VALID", f"({status})")
+        failed += check_canonical(target, block_number, block_hash, blocks[other_branch]["blockHash"], tx_hash, branch == "A")
+        log_block_hash = blocks["A"]["blockHash"]
+        removed = branch == "B"
+        if isinstance(filter_id, str):
+            failed += check(f"eth_getFilterChanges log of block A {'removed' if removed else 'added'}",
+                            wait_filter_log(target, filter_id, tx_hash, log_block_hash, removed))
+        if subscription is not None:
+            failed += check(f"eth_subscription log of block A {'removed' if removed else 'added'}",
+                            wait_subscription_log(websocket, subscription, tx_hash, log_block_hash, removed))
+    if websocket is not None:
+        websocket.close()
+
+    print(f"Number of failed checks: {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
@@ -0,0 +1,143 @@
+""" RLP encoding and decoding shared by the checkers, with the envelopes of the typed transactions (EIP-2718) """
+
+LEGACY_TYPE = 0x00
+LEGACY_FIELDS = ["nonce", "gasPrice", "gas", "to", "value", "input", "v", "r", "s"]
+TRANSACTION_FIELDS = {
+    0x01: ["chainId", "nonce", "gasPrice", "gas", "to", "value", "input", "accessList", "yParity", "r", "s"],
+    0x02: ["chainId", "nonce", "maxPriorityFeePerGas", "maxFeePerGas", "gas", "to", "value", "input", "accessList", "yParity", "r",
+           "s"],
+    0x03: ["chainId", "nonce", "maxPriorityFeePerGas", "maxFeePerGas", "gas", "to", "value", "input", "accessList",
+           "maxFeePerBlobGas", "blobVersionedHashes", "yParity", "r", "s"],
+    0x04: ["chainId", "nonce", "maxPriorityFeePerGas", "maxFeePerGas", "gas", "to", "value", "input", "accessList",
+           "authorizationList", "yParity", "r", "s"],
+}
+AUTHORIZATION_FIELDS = ["chainId", "address", "nonce", "yParity", "r", "s"]
+# transaction fields given as data in JSON, the other ones (but the lists) are quantities
+DATA_FIELDS = ["to", "input", "address"]
+
+
+def encode_uint(value: int):
+    """ return the minimal big endian bytes of the unsigned integer (empty for zero), as RLP encodes the quantities
+    """
+    if value < 0:
+        raise ValueError(f"negative quantity {value}")
+    return value.to_bytes((value.bit_length() + 7) // 8, "big")
+
+
+def rlp_encode(item):
+    """ return the canonical RLP encoding of the item: bytes, unsigned integer or list of items
+    """
+    if isinstance(item, int):
+        item = encode_uint(item)
+    if isinstance(item, list):
+        payload = b"".join(rlp_encode(element) for element in item)
+        offset = 0xc0
+    elif len(item) == 1 and item[0] < 0x80:
+        return bytes(item)
+    else:
+        payload = bytes(item)
+        offset = 0x80
+    if len(payload) < 56:
+        return bytes([offset + len(payload)]) + payload
+    size = encode_uint(len(payload))
+    return bytes([offset + 55 + len(size)]) + size + payload
+
+
+def rlp_decode_item(buff: bytes, offset: int):
+    """ return the RLP item (bytes or list) at offset and the offset following it, raise ValueError if malformed
+    """
+    if offset >= len(buff):
+        raise ValueError("truncated")
+    prefix = buff[offset]
+    if prefix < 0x80:
+        return buff[offset:offset + 1], offset + 1
+    if prefix < 0xb8:
+        start, length = offset + 1, prefix - 0x80
+    elif prefix < 0xc0:
+        size = prefix - 0xb7
+        start, length = offset + 1 + size, int.from_bytes(buff[offset + 1:offset + 1 + size], "big")
+    elif prefix < 0xf8:
+        start, length = offset + 1, prefix - 0xc0
+    else:
+        size = prefix - 0xf7
+        start, length = offset + 1 + size, int.from_bytes(buff[offset + 1:offset + 1 + size], "big")
+    end = start + length
+    if end > len(buff):
+        raise ValueError("truncated")
+    if prefix < 0xc0:
+        return buff[start:end], end
+    items = []
+    while start < end:
+        item, start = rlp_decode_item(buff, start)
+        items.append(item)
+    if start != end:
+        raise ValueError("list length mismatch")
+    return items, end
+
+
+def rlp_decode(buff: bytes):
+    """ return the RLP item of the whole buffer, raise ValueError if malformed or followed by trailing bytes
+    """
+    item, offset = rlp_decode_item(buff, 0)
+    if offset != len(buff):
+        raise ValueError("trailing bytes")
+    return item
+
+
+def decode_transaction_envelope(raw: bytes):
+    """ return the type and the RLP items of the raw transaction (legacy or typed), raise ValueError if malformed or of
+        unsupported type
+    """
+    if len(raw) == 0:
+        raise ValueError("empty raw transaction")
+    if raw[0] >= 0xc0:
+        transaction_type, names, payload = LEGACY_TYPE, LEGACY_FIELDS, raw
+    elif raw[0] in TRANSACTION_FIELDS:
+        transaction_type, names, payload = raw[0], TRANSACTION_FIELDS[raw[0]], raw[1:]
+    else:
+        raise ValueError(f"unsupported type {hex(raw[0])}")
+    items = rlp_decode(payload)
+    if not isinstance(items, list) or len(items) != len(names):
+        raise ValueError(f"{len(items)} fields instead of {len(names)}")
+    return transaction_type, items
+
+
+def encode_transaction_envelope(transaction_type: int, items):
+    """ return the raw transaction of the RLP items: the RLP list, prefixed by the type if typed
+    """
+    if transaction_type == LEGACY_TYPE:
+        return rlp_encode(items)
+    return bytes([transaction_type]) + rlp_encode(items)
+
+
+def from_json_value(field: str, value):
+    """ return the RLP item of the field of the JSON transaction
+    """
+    if field == "accessList":
+        return [[bytes.fromhex(entry["address"][2:]), [bytes.fromhex(key[2:]) for key in entry["storageKeys"]]] for entry in value]
+    if field == "authorizationList":
+        return [[from_json_value(name, entry.get(name, entry.get("v")) if name == "yParity" else entry[name])
+                 for name in AUTHORIZATION_FIELDS] for entry in value]
+    if field == "blobVersionedHashes":
+        return [bytes.fromhex(blob_hash[2:]) for blob_hash in value]
+    if field in DATA_FIELDS:
+        return b"" if value is None else bytes.fromhex(value[2:])
+    return encode_uint(int(value, 16))
+
+
+def encode_transaction(transaction):
+    """ return the raw transaction of the JSON transaction (eth_getTransactionByHash, full block), raise ValueError if of
+        unsupported type or lacking a field
+    """
+    transaction_type = int(transaction.get("type", "0x0"), 16)
+    if transaction_type != LEGACY_TYPE and transaction_type not in TRANSACTION_FIELDS:
+        raise ValueError(f"unsupported type {hex(transaction_type)}")
+    names = LEGACY_FIELDS if transaction_type == LEGACY_TYPE else TRANSACTION_FIELDS[transaction_type]
+    items = []
+    for name in names:
+        # yParity of typed transactions may be given as v only
+        json_name = "v" if name == "yParity" and "yParity" not in transaction else name
+        if json_name not in transaction and name != "to":
+            raise ValueError(f"missing {name}")
+        items.append(from_json_value(name, transaction.get(json_name)))
+    return encode_transaction_envelope(transaction_type, items)
@@ -0,0 +1,224 @@
+""" JSON-RPC calls, devnet transactions and command line options shared by the standalone scripts (checkers, devnet tests and
+    test generators)
+"""
+
+import json
+import os
+import shlex
+import subprocess
+import sys
+import time
+
+DEFAULT_HOST = "localhost"
+DEFAULT_PORT = 8545
+# short options of the node (-H, -p) and of the block range (-s, -n), to be included in the ones of the scripts
+TARGET_OPTIONS = "H:p:"
+RANGE_OPTIONS = "s:n:"
+LEGACY = "legacy"
+EIP1559 = "1559"
+BLOB = "blob"
+TX_TYPES = {LEGACY: "0x0", EIP1559: "0x2", BLOB: "0x3"}
+TRANSFER_GAS = 21000
+BLOB_SIZE = 131072
+
+
+def post_request(target: str, request, jwt_auth: str = ""):
+    """ return the response of the JSON-RPC request (single or batch) sent to target, None on error
+    """
+    cmd = '''curl --silent -X POST -H "Content-Type: application/json" ''' + jwt_auth + ''' --data-binary @- ''' + target
+    process = subprocess.run(shlex.split(cmd), input=json.dumps(request), stdout=subprocess.PIPE, universal_newlines=True,
+                             check=False)
+    try:
+        return json.loads(process.stdout)
+    except json.decoder.JSONDecodeError:
+        return None
+
+
+def call_rpc(target: str, method: str, params, jwt_auth: str = ""):
+    """ return the response of the method called on target, None on error
+    """
+    return post_request(target, {"jsonrpc": "2.0", "method": method, "params": params, "id": 1}, jwt_auth)
+
+
+def call_daemon(target: str, method: str, params, jwt_auth: str = ""):
+    """ return the result of the method called on target, None on error
+    """
+    response = call_rpc(target, method, params, jwt_auth)
+    return response.get("result") if isinstance(response, dict) else None
+
+
+def to_int(quantity):
+    """ return the hex quantity as int, 0 if missing
+    """
+    return int(quantity, 16) if isinstance(quantity, str) else 0
+
+
+def to_bytes(data: str):
+    """ return the bytes of the hex data
+    """
+    return bytes.fromhex(data[2:])
+
+
+def check(name: str, condition: bool, detail: str = ""):
+    """ print the outcome of the check, return 0 if satisfied otherwise 1
+    """
+    print(f"{name.ljust(70)} {'OK' if condition else 'Failed'} {detail}".rstrip())
+    return 0 if condition else 1
+
+
+def sample_transactions(transactions, sample: int):
+    """ return up to sample transactions evenly spaced in the block (first and last included)
+    """
+    if len(transactions) <= sample:
+        return transactions
+    if sample == 1:
+        return transactions[:1]
+    return [transactions[index * (len(transactions) - 1) // (sample - 1)] for index in range(sample)]
+
+
+def get_latest_block(target: str):
+    """ return the latest block number, -1 if not available
+    """
+    latest = call_daemon(target, "eth_blockNumber", [])
+    return int(latest, 16) if isinstance(latest, str) else -1
+
+
+def follow_blocks(target: str, start_block: int, count: int, follow: bool, poll_interval: float):
+    """ yield the blocks of the range then, if following the chain, each new block until interrupted
+    """
+    block_number = start_block
+    while True:
+        if block_number >= start_block + count:
+            if not follow:
+                return
+            if block_number > get_latest_block(target):
+                time.sleep(poll_interval)
+                continue
+        yield block_number
+        block_number = block_number + 1
+
+
+def get_next_test_number(test_dir: str):
+    """ return the number following the last test in the directory
+    """
+    numbers = [0]
+    if os.path.isdir(test_dir):
+        for test_name in os.listdir(test_dir):
+            try:
+                numbers.append(int(test_name.split(".")[0].split("_")[1]))
+            except (IndexError, ValueError):
+                continue
+    return max(numbers) + 1
+
+
+def build_transaction(target: str, tx_type: str, chain_id: int, nonce: int, address: str):
+    """ return the fields of the zero value self transfer of the given type, fees doubling the current ones
+    """
+    transaction = {"chainId": chain_id, "nonce": nonce, "to": address, "value": 0, "gas": TRANSFER_GAS}
+    if tx_type == LEGACY:
+        transaction["gasPrice"] = 2 * to_int(call_daemon(target, "eth_gasPrice", []))
+        return transaction
+    transaction.update(get_dynamic_fees(target))
+    if tx_type == BLOB:
+        transaction["maxFeePerBlobGas"] = max(2 * to_int(call_daemon(target, "eth_blobBaseFee", [])), 1)
+    return transaction
+
+
+def get_dynamic_fees(target: str):
+    """ return the fee fields of a dynamic fee transaction, max fee doubling the base fee of the latest block
+    """
+    priority_fee = to_int(call_daemon(target, "eth_maxPriorityFeePerGas", []))
+    base_fee = to_int((call_daemon(target, "eth_getBlockByNumber", ["latest", False]) or {}).get("baseFeePerGas"))
+    return {"maxPriorityFeePerGas": priority_fee, "maxFeePerGas": 2 * base_fee + priority_fee}
+
+
+def submit_transaction(target: str, private_key: str, transaction, blobs=None):
+    """ sign and submit the transaction (with its blobs if any), return its hash or the error
+    """
+    # eth_account needed only by the scripts submitting transactions
+    from eth_account import Account  # pylint: disable=import-outside-toplevel
+    if blobs is not None:
+        signed = Account.sign_transaction(transaction, private_key, blobs=blobs)
+    else:
+        signed = Account.sign_transaction(transaction, private_key)
+    raw_transaction = getattr(signed, "raw_transaction", None) or signed.rawTransaction
+    response = call_rpc(target, "eth_sendRawTransaction", ["0x" + bytes(raw_transaction).hex()])
+    if not isinstance(response, dict) or "result" not in response:
+        return None, str(response.get("error") if isinstance(response, dict) else response)
+    return response["result"], ""
+
+
+def send_transaction(target: str, private_key: str, tx_type: str, chain_id: int, nonce: int, address: str):
+    """ sign and submit the zero value self transfer of the given type, return its hash or the error
+    """
+    transaction = build_transaction(target, tx_type, chain_id, nonce, address)
+    return submit_transaction(target, private_key, transaction, [b"\0" * BLOB_SIZE] if tx_type == BLOB else None)
+
+
+class ScriptOptions:
+    """ node (-H, -p) and block range (-s, -n) options common to the scripts
+    """
+
+    def __init__(self, count: int = 0):
+        self.host = DEFAULT_HOST
+        self.port = DEFAULT_PORT
+        self.start_block = -1
+        self.count = count
+
+    def parse_target(self, option: str, optarg: str):
+        """ set the node option, return False if not a node option
+        """
+        if option == "-H":
+            self.host = optarg
+        elif option == "-p":
+            self.port = int(optarg)
+        else:
+            return False
+        return True
+
+    def parse_range(self, option: str, optarg: str):
+        """ set the block range option, return False if not a block range option
+        """
+        if option == "-s":
+            self.start_block = int(optarg, 0)
+        elif option == "-n":
+            self.count = int(optarg)
+        else:
+            return False
+        return True
+
+    def get_target(self, port: int = 0):
+        """ return the address of the node, on the given port if any (e.g. the Engine API one)
+        """
+        return self.host + ":" + str(port if port > 0 else self.port)
+
+    def get_block_range(self, follow: bool = False, min_block: int = 0):
+        """ return the first block and the number of blocks of the range: the latest blocks if the first one is not given,
+            none (but the new ones) if following the chain, exit if the latest block is not available when needed
+        """
+        if self.start_block >= 0 and not follow:
+            return self.start_block, self.count
+        latest_block = get_latest_block(self.get_target())
+        if latest_block < 0:
+            print("latest block not available on " + self.get_target())
+            sys.exit(1)
+        if self.start_block >= 0:
+            return self.start_block, self.count
+        if follow:
+            return latest_block + 1, 0
+        start_block = max(latest_block - self.count + 1, min_block)
+        return start_block, latest_block - start_block + 1
+
+
+def print_target_usage(node: str = "RpcDaemon"):
+    """ print the usage of the node options
+    """
+    print("-H host where the " + node + " is located (e.g. 10.10.2.3) [default: " + DEFAULT_HOST + "]")
+    print("-p port where the " + node + " is located (e.g. 8545) [default: " + str(DEFAULT_PORT) + "]")
+
+
+def print_range_usage(count: int, latest_by_default: bool = True):
+    """ print the usage of the block range options
+    """
+    print("-s <block> first block of the range" + (" [default: latest blocks]" if latest_by_default else ""))
+    print("-n <count> number of blocks of the range [default: " + str(count) + "]")
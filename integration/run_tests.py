@@ -2,23 +2,156 @@
 """ Run the JSON RPC API curl commands as integration tests """
 
 from datetime import datetime
+import atexit
+import csv
 import getopt
 import gzip
+import hashlib
 import json
+import math
+import operator
+import re
 import os
+import random
 import shlex
 import shutil
+import signal
 import subprocess
 import sys
 import tarfile
+import threading
 import time
+import traceback
 import pytz
 import jwt
+import yaml
 
 SILK = "silk"
 RPCDAEMON = "rpcdaemon"
 INFURA = "infura"
 
+# container name suffixed by the runner pid, so that concurrent runs on the same host don't remove each other's container
+DOCKER_CONTAINER_NAME = "rpc-tests-node-" + str(os.getpid())
+DOCKER_DATADIR = "/home/erigon/.local/share/erigon"
+DOCKER_JWT_FILE = "/home/erigon/jwt.hex"
+DOCKER_READY_TIMEOUT = 120
+# pre-flight check of the daemons before the run: max time of each request, polling interval waiting for readiness
+PREFLIGHT_REQUEST_TIMEOUT = 10
+PREFLIGHT_POLL_INTERVAL = 2
+DAEMON_LOG_DOCKER_PREFIX = "docker:"
+DAEMON_LOG_DOCKER_NODE = "docker"
+DAEMON_LOG_PRINTED_LINES = 5
+DAEMON_LOG_ERROR_MARKERS = ("EROR", "ERROR", "CRIT", "panic", "WARN")
+
+DEFAULT_SLOW_FACTOR = 3.0
+DEFAULT_GOLDEN_CACHE_SIZE = 1024
+DEFAULT_GOLDEN_STORE_DIR = "./goldens/"
+GOLDEN_REFERENCE = "$golden"
+DEFAULT_CHECKPOINT_EVERY = 50
+CASE_SEPARATOR = "#"
+DEFAULT_WAIT_TIMEOUT = 60
+WAIT_POLL_INTERVAL = 1
+DIFF_SAMPLE_VALUE_SIZE = 200
+KEEP_ARTIFACTS_ALL = "all"
+KEEP_ARTIFACTS_FAILED = "failed"
+KEEP_ARTIFACTS_NONE = "none"
+UNIQUE_IDS_ALL = "all"
+# diff strategies: in process comparison escalating to the external tools only when needed, or always the external tools
+DIFF_STRATEGY_AUTO = "auto"
+DIFF_STRATEGY_EXTERNAL = "external"
+DIFF_TOOL_PYTHON = "python"
+DIFF_TOOL_JSON_DIFF = "json-diff"
+DIFF_TOOL_JSON_PATCH = "json-patch-jsondiff"
+# problems of the response compression check (--compression-check)
+COMPRESSION_NOT_APPLIED = "not compressed"
+COMPRESSION_UNEXPECTED_ENCODING = "unexpected encoding"
+COMPRESSION_CORRUPTED = "corrupted"
+COMPRESSION_TRANSPORT = "transport error"
+COMPRESSION_PROBLEMS = [COMPRESSION_NOT_APPLIED, COMPRESSION_UNEXPECTED_ENCODING, COMPRESSION_CORRUPTED, COMPRESSION_TRANSPORT]
+# curl write-out of the HTTP status on stderr, to classify the failures and back off the rate limited reference requests
+HTTP_STATUS_OPTIONS = ''' --write-out "%{stderr}%{http_code}"'''
+REFERENCE_MAX_RETRIES = 5
+REFERENCE_BACKOFF_BASE = 1
+REFERENCE_BACKOFF_MAX = 30
+# curl write-out of the HTTP status and the byte sizes on stderr (keeping stdout for the response)
+BYTE_METRICS_FIELDS = " %{size_request} %{size_upload} %{size_header} %{size_download}"
+CONNECTION_METRICS_FIELDS = " %{num_connects} %{time_namelookup} %{time_connect} %{time_appconnect} %{time_pretransfer} " \
+                            "%{time_starttransfer} %{time_total}"
+# failure classes (buckets) of the failed tests, tagged on the failed lines and counted in the summary
+FAILURE_TRANSPORT = "transport error"
+FAILURE_TIMEOUT = "timeout"
+FAILURE_HTTP_STATUS = "HTTP status"
+FAILURE_INVALID_ENVELOPE = "invalid JSON-RPC envelope"
+FAILURE_ERROR_CODE = "error code mismatch"
+FAILURE_RESULT = "result mismatch"
+FAILURE_PIPELINE = "pipeline phase"
+FAILURE_LATENCY = "latency"
+# failure classes of the daemon not reachable or not answering, not of the response content
+TRANSPORT_FAILURE_CLASSES = [FAILURE_TRANSPORT, FAILURE_TIMEOUT, FAILURE_HTTP_STATUS]
+# exit codes of the run, content failures prevailing on transport ones (a reachable daemon answering wrongly)
+EXIT_SUCCESS = 0
+EXIT_CONTENT_FAILURES = 1
+EXIT_TRANSPORT_FAILURES = 2
+EXIT_INTERNAL_ERROR = 3
+EXIT_CONFIG_ERROR = 255
+# file options forwarded to the chain sessions of a multi-chain run with the chain name appended (e.g.: timings_mainnet.json)
+CHAIN_FILE_OPTIONS = ["--save-timings", "--csv-report", "--checkpoint", "--resume", "--perf-history", "--quarantine-flaky",
+                      "--record-fixtures", "--fixtures"]
+# credential options kept out of the child argv of a multi-chain run (visible in the process list) and masked by --print-config
+CREDENTIAL_OPTIONS = ["--header", "--reference-header", "--basic-auth", "--reference-basic-auth"]
+# environment variable passing the credential options (JSON list of [option, value]) to the chain sessions
+CREDENTIAL_OPTIONS_ENV = "RPC_TESTS_CREDENTIAL_OPTIONS"
+EXIT_CODE_PRIORITY = [EXIT_SUCCESS, EXIT_TRANSPORT_FAILURES, EXIT_CONTENT_FAILURES, EXIT_INTERNAL_ERROR, EXIT_CONFIG_ERROR]
+FAILURE_MANIFEST_FILE = "failures.json"
+# run-id-stamped results directories (--results-retention), the latest run linked as results/latest
+RESULTS_RUN_ID_FORMAT = "%Y%m%d-%H%M%S"
+RESULTS_RUN_ID_PATTERN = re.compile(r"^\d{8}-\d{6}(-\d+)?$")
+RESULTS_LATEST_LINK = "latest"
+LATENCY_MODE_FAIL = "fail"
+LATENCY_MODE_WARN = "warn"
+CURL_TIMEOUT_EXIT_CODE = 28
+# transports of the requests to the daemon under test, IPC by the curl stand-in over the Unix socket
+TRANSPORT_HTTP = "http"
+TRANSPORT_IPC = "ipc"
+IPC_CLIENT = os.path.join(os.path.dirname(os.path.abspath(__file__)), "ipc_client.py")
+# block tags resolved against the head, pinned to the recorded height in fixture mode
+BLOCK_TAGS = ["latest", "pending", "safe", "finalized"]
+FIXTURE_PINNING_SKIP = "skip"
+FIXTURE_PINNING_REPIN = "repin"
+# test selection outcomes: not selected tests are silently left out, skipped ones are reported
+SELECTION_RUN = "run"
+SELECTION_NOT_SELECTED = "not selected"
+SELECTION_SKIPPED = "skipped"
+SELECTION_HEAD_SENSITIVE = "skipped head sensitive"
+SELECTION_RESUMED = "resumed"
+SELECTION_DEPENDENCY_NOT_PASSED = "skipped dependency not passed"
+SHUTDOWN_TIMEOUT = 10
+WEBHOOK_MAX_FAILED_TESTS = 20
+# OpenTelemetry trace of the run (--otlp-endpoint) exported as OTLP/HTTP JSON in batches of spans
+OTLP_TRACES_PATH = "/v1/traces"
+OTLP_BATCH_SIZE = 512
+OTLP_SERVICE_NAME = "rpc-tests"
+OTLP_SPAN_KIND_INTERNAL = 1
+OTLP_STATUS_OK = 1
+OTLP_STATUS_ERROR = 2
+ERROR_MESSAGE_EXACT = "exact"
+ERROR_MESSAGE_PREFIX = "prefix"
+ERROR_MESSAGE_REGEX = "regex"
+ERROR_MESSAGE_IGNORE = "ignore"
+# comparison policies of the namespaces (--namespace-policy)
+COMPARISON_EXACT = "exact"
+COMPARISON_ERRORS_ONLY = "errors-only"
+# numeric equivalence (--numeric-equivalence) of the hex quantities and the numbers of all the methods
+NUMERIC_EQUIVALENCE_ALL = "all"
+
+# invalid JWT authentication cases sent to engine_ endpoints in auth-test mode, all expected to get HTTP 401
+AUTH_TEST_NO_TOKEN = "no token"
+AUTH_TEST_EXPIRED_IAT = "expired iat"
+AUTH_TEST_WRONG_SECRET = "wrong secret"
+AUTH_TEST_WRONG_ALGORITHM = "wrong algorithm"
+AUTH_TEST_CASES = [AUTH_TEST_NO_TOKEN, AUTH_TEST_EXPIRED_IAT, AUTH_TEST_WRONG_SECRET, AUTH_TEST_WRONG_ALGORITHM]
+AUTH_TEST_IAT_SKEW = 120
+
 tests_with_big_json = [
 ]
 
@@ -110,6 +243,193 @@ tests_not_compared_message = [
 tests_message_lower_case = [
 ]
 
+# methods answering about the head without block parameter, i.e. not re-pinnable to the fixtures height
+methods_on_head = [
+    "eth_blockNumber",
+    "eth_gasPrice",
+    "eth_maxPriorityFeePerGas",
+    "eth_blobBaseFee",
+    "eth_syncing",
+]
+
+# result arrays compared regardless of order, sorted by the listed object fields
+methods_with_unordered_result = {
+    "eth_getLogs": ("blockHash", "logIndex"),
+}
+
+# comparison policy by namespace (exact if not listed): errors-only verifies the JSON-RPC envelope, the result or error
+# presence and the error but not the result content, environment specific (e.g. node info, peers, client version)
+namespace_comparison_policies = {
+    "admin_": COMPARISON_ERRORS_ONLY,
+    "net_": COMPARISON_ERRORS_ONLY,
+    "web3_": COMPARISON_ERRORS_ONLY,
+}
+
+# normalization (--normalize): quantity fields whose leading zeros are stripped ("result" for the whole result)
+methods_with_quantity_fields = {
+    "eth_blockNumber": ("result",),
+    "eth_chainId": ("result",),
+    "eth_gasPrice": ("result",),
+    "eth_maxPriorityFeePerGas": ("result",),
+    "eth_blobBaseFee": ("result",),
+    "eth_estimateGas": ("result",),
+    "eth_getBalance": ("result",),
+    "eth_getTransactionCount": ("result",),
+    "eth_getBlockTransactionCountByHash": ("result",),
+    "eth_getBlockTransactionCountByNumber": ("result",),
+    "eth_getUncleCountByBlockHash": ("result",),
+    "eth_getUncleCountByBlockNumber": ("result",),
+    "eth_getBlockByHash": ("number", "gasUsed", "gasLimit", "timestamp", "size", "difficulty", "totalDifficulty",
+                           "baseFeePerGas", "blobGasUsed", "excessBlobGas", "blockNumber", "transactionIndex", "gas",
+                           "gasPrice", "maxFeePerGas", "maxPriorityFeePerGas", "value", "v", "chainId", "type", "index"),
+    "eth_getBlockByNumber": ("number", "gasUsed", "gasLimit", "timestamp", "size", "difficulty", "totalDifficulty",
+                             "baseFeePerGas", "blobGasUsed", "excessBlobGas", "blockNumber", "transactionIndex", "gas",
+                             "gasPrice", "maxFeePerGas", "maxPriorityFeePerGas", "value", "v", "chainId", "type", "index"),
+    "eth_getTransactionByHash": ("blockNumber", "transactionIndex", "gas", "gasPrice", "maxFeePerGas",
+                                 "maxPriorityFeePerGas", "value", "nonce", "v", "chainId", "type"),
+    "eth_getTransactionReceipt": ("blockNumber", "transactionIndex", "cumulativeGasUsed", "gasUsed", "effectiveGasPrice",
+                                  "blobGasUsed", "blobGasPrice", "logIndex", "status", "type"),
+    "eth_getBlockReceipts": ("blockNumber", "transactionIndex", "cumulativeGasUsed", "gasUsed", "effectiveGasPrice",
+                             "blobGasUsed", "blobGasPrice", "logIndex", "status", "type"),
+    "eth_getLogs": ("blockNumber", "transactionIndex", "logIndex"),
+    "eth_feeHistory": ("oldestBlock", "baseFeePerGas", "baseFeePerBlobGas"),
+}
+
+
+# operators of the test assertions ("expect" in test metadata), hex quantities are compared as numbers
+expect_operators = {
+    "eq": operator.eq,
+    "ne": operator.ne,
+    "gt": operator.gt,
+    "gte": operator.ge,
+    "lt": operator.lt,
+    "lte": operator.le,
+}
+
+
+# capabilities of the reference clients other than Erigon: namespaces not supported (skipped) and result fields
+# differing by client (not compared) per method
+client_profiles = {
+    "geth": {
+        "skip_namespaces": ["erigon_", "ots_", "trace_", "parity_", "bor_"],
+        "ignored_fields": {
+            "eth_getBlockByHash": ["totalDifficulty"],
+            "eth_getBlockByNumber": ["totalDifficulty"],
+            "eth_getUncleByBlockHashAndIndex": ["totalDifficulty"],
+            "eth_getUncleByBlockNumberAndIndex": ["totalDifficulty"],
+        },
+    },
+    "nethermind": {
+        "skip_namespaces": ["erigon_", "ots_", "bor_"],
+        "ignored_fields": {
+            "eth_getBlockByHash": ["author"],
+            "eth_getBlockByNumber": ["author"],
+            "eth_getUncleByBlockHashAndIndex": ["author"],
+            "eth_getUncleByBlockNumberAndIndex": ["author"],
+        },
+    },
+}
+
+
+def detect_client(config, target: str, reference: bool = False):
+    """ return the client name (lower case e.g. geth) from web3_clientVersion (e.g. Geth/v1.14.8-stable/linux-amd64/go1.22.6)
+        called on target, empty string on error
+    """
+    request = json.dumps({"jsonrpc": "2.0", "method": "web3_clientVersion", "params": [], "id": 1})
+    cmd = get_curl_command(config, "", ''' --data \'''' + request + '''\' ''', target, reference=reference)
+    process = subprocess.run(shlex.split(cmd), stdout=subprocess.PIPE, universal_newlines=True, check=False)
+    try:
+        client_version = json.loads(process.stdout).get("result")
+    except (json.decoder.JSONDecodeError, AttributeError):
+        return ""
+    return client_version.split("/")[0].lower() if isinstance(client_version, str) else ""
+
+
+def call_node(config, target: str, jwt_auth: str, method: str, params=None, reference: bool = False):
+    """ return the result of the method called on target within the pre-flight timeout, None on error
+    """
+    request = json.dumps({"jsonrpc": "2.0", "method": method, "params": params or [], "id": 1})
+    cmd = get_curl_command(config, jwt_auth, " --data '" + request + "' ", target, " --max-time " + str(PREFLIGHT_REQUEST_TIMEOUT),
+                           reference)
+    process = subprocess.run(shlex.split(cmd), stdout=subprocess.PIPE, universal_newlines=True, check=False)
+    try:
+        return json.loads(process.stdout).get("result")
+    except (json.decoder.JSONDecodeError, AttributeError):
+        return None
+
+
+def get_node_state(config, target: str, jwt_auth: str, reference: bool = False):
+    """ return the state of the node on target (None if unknown): client version, chain id, head block number and hash,
+        syncing and RPC modules, i.e. the fingerprint of the node the run is produced against
+    """
+    client_version = call_node(config, target, jwt_auth, "web3_clientVersion", reference=reference)
+    chain_id = call_node(config, target, jwt_auth, "eth_chainId", reference=reference)
+    block = call_node(config, target, jwt_auth, "eth_getBlockByNumber", ["latest", False], reference)
+    if not isinstance(block, dict):
+        # number only, e.g. node not serving the blocks
+        block = {"number": call_node(config, target, jwt_auth, "eth_blockNumber", reference=reference)}
+    syncing = call_node(config, target, jwt_auth, "eth_syncing", reference=reference)
+    rpc_modules = call_node(config, target, jwt_auth, "rpc_modules", reference=reference)
+    return {
+        "client_version": client_version if isinstance(client_version, str) else None,
+        "chain_id": int(chain_id, 16) if isinstance(chain_id, str) else None,
+        "block_number": int(block["number"], 16) if isinstance(block.get("number"), str) else None,
+        "block_hash": block.get("hash"),
+        "syncing": syncing is not False if syncing is not None else None,
+        "rpc_modules": rpc_modules if isinstance(rpc_modules, dict) else None,
+    }
+
+
+def get_node_not_ready(config, state):
+    """ return why the node is not ready (not answering, or with --wait-ready syncing, or below the min block height) or
+        empty string
+    """
+    if all(value is None for value in state.values()):
+        return "not answering"
+    if config.wait_ready > 0 and state["syncing"] is not False:
+        return "syncing"
+    if config.min_block >= 0 and (state["block_number"] is None or state["block_number"] < config.min_block):
+        return f"block {state['block_number']} below {config.min_block}"
+    return ""
+
+
+def run_preflight(config):
+    """ check that the daemon under test (and the reference, if any) answer before the run, waiting up to --wait-ready
+        for the sync completion and the min block height, print their state in the run header and return the not ready
+        ones with the reason
+    """
+    nodes = [("Target", config.scheme + get_target(config.daemon_under_test, "web3_clientVersion", config.infura_url,
+                                                   config.daemon_on_host, config.daemon_on_port), get_jwt_auth(config.jwt_secret), False)]
+    if config.verify_with_daemon:
+        reference_target = get_target(config.daemon_as_reference, "web3_clientVersion", config.infura_url, config.daemon_on_host,
+                                      config.daemon_on_port)
+        nodes.append(("Reference", reference_target if config.daemon_as_reference == INFURA else config.scheme + reference_target, "", True))
+    deadline = time.time() + config.wait_ready
+    while True:
+        states = {name: get_node_state(config, target, jwt_auth, reference) for name, target, jwt_auth, reference in nodes}
+        reasons = {name: get_node_not_ready(config, state) for name, state in states.items()}
+        not_ready = {name: reason for name, reason in reasons.items() if reason != ""}
+        if len(not_ready) == 0 or time.time() + PREFLIGHT_POLL_INTERVAL > deadline:
+            break
+        time.sleep(PREFLIGHT_POLL_INTERVAL)
+    config.node_states = {name.lower(): state for name, state in states.items()}
+    for name, state in states.items():
+        print(f"{(name + ':').ljust(11)}{state['client_version'] or 'unknown client'}, chain id {state['chain_id']}, "
+              f"block {state['block_number']} {state['block_hash'] or ''}".rstrip() + (" (syncing)" if state["syncing"] else "") +
+              (f" NOT READY ({not_ready[name]})" if name in not_ready else ""))
+    return not_ready
+
+
+def drop_client_fields(response, fields):
+    """ return the response without the result fields differing by client (in result object or result list objects)
+    """
+    if isinstance(response, list):
+        return [drop_client_fields(item, fields) for item in response]
+    if not isinstance(response, dict) or not isinstance(response.get("result"), dict):
+        return response
+    response = dict(response)
+    response["result"] = {key: value for key, value in response["result"].items() if key not in fields}
+    return response
 
 
 def get_target(target_type: str, method: str, infura_url: str, host: str, port: int = 0):
@@ -139,6 +459,40 @@ def get_json_filename_ext(target_type: str):
         return "-infura.json"
     return "-rpcdaemon.json"
 
+def get_test_case(test_name: str):
+    """ split the name of the subtest of parametrized test into test file name and case number (e.g. test_01.json#2),
+        case number None if not a subtest
+    """
+    if CASE_SEPARATOR in test_name:
+        file_name, case = test_name.rsplit(CASE_SEPARATOR, 1)
+        return file_name, int(case)
+    return test_name, None
+
+
+def get_archive_base_name(test_name: str):
+    """ strip case number and compression extension from test name (e.g. test_01.tar.zst -> test_01.tar)
+    """
+    test_name = get_test_case(test_name)[0]
+    for ext in (".zst", ".gz"):
+        if test_name.endswith(".tar" + ext):
+            return test_name[:-len(ext)]
+    return test_name
+
+
+def extract_zstd_tar(file_name: str):
+    """ return the content of the single file archived into the zstd tar file, streaming the zstd command output
+        (i.e. without keeping the whole decompressed tar in memory) or None if the archive doesn't contain one file
+    """
+    with subprocess.Popen(["zstd", "-d", "-c", "-q", file_name], stdout=subprocess.PIPE) as process:
+        with tarfile.open(fileobj=process.stdout, mode="r|", encoding='utf-8') as tar:
+            member = tar.next()
+            buff = tar.extractfile(member).read() if member is not None else None
+            if tar.next() is not None:
+                buff = None
+        process.stdout.close()
+    return buff
+
+
 def get_jwt_secret(name):
     """ parse secret file
     """
@@ -150,11 +504,1205 @@ def get_jwt_secret(name):
         return ""
 
 
+def load_timing_baseline(name):
+    """ parse timing baseline file i.e. JSON object of test full name -> p95 duration in secs
+    """
+    try:
+        with open(name, encoding='utf8') as file:
+            return json.load(file)
+    except (FileNotFoundError, json.decoder.JSONDecodeError):
+        return None
+
+
+def save_timings(name, test_timings):
+    """ save the durations measured in this run in the timing baseline format
+    """
+    timings = {}
+    for test_full_name, durations in test_timings.items():
+        timings[test_full_name] = round(get_percentile(durations, 95), 3)
+    with open(name, 'w', encoding='utf8') as file:
+        file.write(json.dumps(timings, indent=4, sort_keys=True))
+
+
+def get_percentile(durations, percentile: float):
+    """ return the percentile of the durations (nearest rank)
+    """
+    durations = sorted(durations)
+    rank = math.ceil(percentile / 100 * len(durations))
+    return durations[max(rank, 1) - 1]
+
+
+def parse_sla_target(target: str):
+    """ parse SLA target e.g. "200ms p95" into latency in secs and percentile, raise ValueError if invalid
+    """
+    latency, percentile = str(target).split()
+    if not percentile.startswith("p"):
+        raise ValueError(target)
+    if latency.endswith("ms"):
+        return float(latency[:-2]) / 1000, float(percentile[1:])
+    if latency.endswith("s"):
+        return float(latency[:-1]), float(percentile[1:])
+    raise ValueError(target)
+
+
+def load_sla(name, net: str):
+    """ parse SLA file i.e. YAML map of method -> latency target (e.g. eth_call: 200ms p95), optionally grouped by chain
+        return method -> (latency in secs, percentile) or None if not found or invalid
+    """
+    try:
+        with open(name, encoding='utf8') as file:
+            targets = yaml.safe_load(file)
+    except (FileNotFoundError, yaml.YAMLError):
+        return None
+    if not isinstance(targets, dict):
+        return None
+    if isinstance(targets.get(net), dict):
+        targets = targets[net]
+    try:
+        return {method: parse_sla_target(target) for method, target in targets.items() if not isinstance(target, dict)}
+    except ValueError:
+        return None
+
+
+def get_api_durations(test_timings):
+    """ return the durations of the tests grouped by API directory
+    """
+    api_durations = {}
+    for test_full_name, durations in test_timings.items():
+        api_durations.setdefault(test_full_name.split("/")[1], []).extend(durations)
+    return api_durations
+
+
+def check_sla(sla, test_timings):
+    """ evaluate the SLA targets over the durations of the tests of each method (i.e. API directory)
+        return the list of (method, percentile, measured latency, target latency) of the methods having tests
+    """
+    method_durations = get_api_durations(test_timings)
+    results = []
+    for method, (latency, percentile) in sorted(sla.items()):
+        if method in method_durations:
+            results.append((method, percentile, get_percentile(method_durations[method], percentile), latency))
+    return results
+
+
+def get_perf_metrics(test_timings, parse_time: float):
+    """ return the aggregate performance metrics of the run: total round trip time, response parsing time and p95 of each API
+    """
+    return {
+        "total_rtt": round(sum(sum(durations) for durations in test_timings.values()), 3),
+        "parse_time": round(parse_time, 3),
+        "api_p95": {api: round(get_percentile(durations, 95), 3) for api, durations in sorted(get_api_durations(test_timings).items())},
+    }
+
+
+def load_perf_history(name):
+    """ parse performance history file i.e. JSON lines of the metrics of the previous runs, empty if not found
+    """
+    history = []
+    try:
+        with open(name, encoding='utf8') as file:
+            for line in file:
+                try:
+                    history.append(json.loads(line))
+                except json.decoder.JSONDecodeError:
+                    continue
+    except FileNotFoundError:
+        pass
+    return history
+
+
+def print_perf_trend(perf_metrics, history, runs: int):
+    """ print the deltas of the performance metrics against the average of the last runs
+    """
+    history = history[-runs:]
+    if len(history) == 0:
+        print("Perf trend: no previous run")
+        return
+    print(f"Perf trend (delta vs average of last {len(history)} runs):")
+    rows = [("total rtt", perf_metrics["total_rtt"], [run.get("total_rtt") for run in history]),
+            ("parse time", perf_metrics["parse_time"], [run.get("parse_time") for run in history])]
+    for api, p95 in perf_metrics["api_p95"].items():
+        rows.append((api + " p95", p95, [run.get("api_p95", {}).get(api) for run in history]))
+    for name, value, previous_values in rows:
+        previous_values = [previous_value for previous_value in previous_values if isinstance(previous_value, (int, float))]
+        if len(previous_values) == 0:
+            print(f"    {name.ljust(50)} {value:10.3f} secs (new)")
+            continue
+        average = sum(previous_values) / len(previous_values)
+        delta = (value - average) / average * 100 if average > 0 else 0.0
+        print(f"    {name.ljust(50)} {value:10.3f} secs {delta:+7.1f}%")
+
+
+def classify_outcomes(test_outcomes):
+    """ classify tests executed several times as stable-pass, stable-fail or flaky (mixed outcomes)
+    """
+    stable_pass = []
+    stable_fail = []
+    flaky = []
+    for test_full_name, outcomes in test_outcomes.items():
+        if all(outcome == 0 for outcome in outcomes):
+            stable_pass.append(test_full_name)
+        elif all(outcome != 0 for outcome in outcomes):
+            stable_fail.append(test_full_name)
+        else:
+            flaky.append(test_full_name)
+    return stable_pass, stable_fail, flaky
+
+
+def is_slow(test_full_name, duration, timing_baseline, slow_factor):
+    """ determine if test duration exceeds slow_factor times its baseline
+    """
+    if timing_baseline is None or test_full_name not in timing_baseline:
+        return 0
+    return 1 if duration > slow_factor * float(timing_baseline[test_full_name]) else 0
+
+
+class ByteMetrics:
+    """ Byte sizes of the requests and responses of the tests (daemon under test), aggregated per API in the report
+        to spot the methods whose payloads grew (e.g. after a daemon upgrade) even if the content still matches
+    """
+
+    def __init__(self):
+        """ Create a new empty ByteMetrics """
+        self.api_sizes = {}
+
+    def record(self, json_file: str, write_out: str, response_size: int):
+        """ record the byte sizes written out by curl i.e. request total and body, response headers and body as
+            transferred (compressed if so) and the response size as decompressed
+        """
+        try:
+            request_size, request_body_size, header_size, body_size = [int(size) for size in write_out.split()[1:5]]
+        except ValueError:
+            return
+        sizes = (request_size - request_body_size, request_body_size, header_size, body_size, response_size)
+        self.api_sizes.setdefault(json_file.split("/")[0], []).append(sizes)
+
+    def get_report(self):
+        """ return per API the number of tests, the average sizes and the max decompressed response size """
+        report = {}
+        for api_name, sizes in sorted(self.api_sizes.items()):
+            averages = [sum(size[index] for size in sizes) // len(sizes) for index in range(5)]
+            report[api_name] = {
+                "tests": len(sizes),
+                "request_headers": averages[0],
+                "request_body": averages[1],
+                "response_headers": averages[2],
+                "response_body": averages[3],
+                "response_decompressed": averages[4],
+                "response_max": max(size[4] for size in sizes),
+            }
+        return report
+
+
+class ConnectionMetrics:
+    """ Connection timings of the requests to the daemon under test written out by curl, aggregated per API in the report
+        to tell how much of the round trip time is connection setup (TCP, TLS) rather than server time
+    """
+
+    def __init__(self):
+        """ Create a new empty ConnectionMetrics """
+        self.api_timings = {}
+
+    def record(self, json_file: str, write_out: str):
+        """ record the connections opened (0 if reused) and the DNS, TCP, TLS, server and transfer times in secs """
+        try:
+            items = write_out.split()[-7:]
+            connects = int(items[0])
+            lookup, connect, tls_connect, pretransfer, starttransfer, total = [float(item) for item in items[1:]]
+        except (ValueError, IndexError):
+            return
+        timings = (connects, lookup, connect - lookup, tls_connect - connect if tls_connect > 0 else 0.0,
+                   starttransfer - pretransfer, total - starttransfer)
+        self.api_timings.setdefault(json_file.split("/")[0], []).append(timings)
+
+    def get_report(self):
+        """ return per API the number of tests, the new and reused connections and the average times in ms """
+        report = {}
+        for api_name, timings in sorted(self.api_timings.items()):
+            averages = [round(sum(timing[index] for timing in timings) * 1000 / len(timings), 3) for index in range(1, 6)]
+            report[api_name] = {
+                "tests": len(timings),
+                "new_connections": sum(timing[0] for timing in timings),
+                "reused_connections": sum(1 for timing in timings if timing[0] == 0),
+                "dns_ms": averages[0],
+                "tcp_ms": averages[1],
+                "tls_ms": averages[2],
+                "server_ms": averages[3],
+                "transfer_ms": averages[4],
+            }
+        return report
+
+
+class CsvReport:
+    """ Per-test results written as CSV rows incrementally (flushed row by row), so that partial data survives crashes """
+
+    COLUMNS = ["test", "number", "transport", "outcome", "rtt_secs", "response_bytes", "error_class"]
+
+    def __init__(self, name: str):
+        """ Create a new CsvReport written into name """
+        self.file = open(name, 'w', encoding='utf8', newline='')  # pylint: disable=consider-using-with
+        self.writer = csv.writer(self.file)
+        self.writer.writerow(self.COLUMNS)
+        self.file.flush()
+
+    def write(self, test_full_name: str, test_number: int, transport: str, outcome: str, test_metrics):
+        """ write the result row of the test """
+        round_trip_time = test_metrics.get("round_trip_time")
+        self.writer.writerow([test_full_name, test_number, transport, outcome,
+                              f"{round_trip_time:.6f}" if round_trip_time is not None else "",
+                              test_metrics.get("response_bytes", ""), test_metrics.get("failure_class", "")])
+        self.file.flush()
+
+    def close(self):
+        """ close the report file """
+        self.file.close()
+
+
+class Tracer:
+    """ OpenTelemetry trace of the run (--otlp-endpoint): the run span, a span per test and the spans of its phases (load,
+        setup, wait, send, compare, dump, teardown), exported in batches to the OTLP/HTTP collector (e.g. Jaeger, Tempo),
+        so that the gaps between the tests, the server latency and the diffing time can be told apart
+    """
+
+    def __init__(self, endpoint: str, net: str):
+        """ Create a new Tracer exporting to the collector endpoint, starting the run span """
+        endpoint = endpoint.rstrip("/")
+        self.url = endpoint if endpoint.endswith(OTLP_TRACES_PATH) else endpoint + OTLP_TRACES_PATH
+        self.net = net
+        self.trace_id = os.urandom(16).hex()
+        self.spans = []
+        self.export_failures = 0
+        self.run_span = self.start_span("run " + net, None, {"chain": net})
+        self.test_span = None
+        self.phase_span = None
+
+    def start_span(self, name: str, parent, attributes):
+        """ return the new span started now as child of the parent span (root if None) """
+        span = {"traceId": self.trace_id, "spanId": os.urandom(8).hex(), "name": name, "kind": OTLP_SPAN_KIND_INTERNAL,
+                "startTimeUnixNano": str(time.time_ns()), "attributes": get_otlp_attributes(attributes)}
+        if parent is not None:
+            span["parentSpanId"] = parent["spanId"]
+        return span
+
+    def end_span(self, span, status_code: int = 0):
+        """ end the span now, exporting the batch of the ended spans once full """
+        span["endTimeUnixNano"] = str(time.time_ns())
+        if status_code != 0:
+            span["status"] = {"code": status_code}
+        self.spans.append(span)
+        if len(self.spans) >= OTLP_BATCH_SIZE:
+            self.export()
+
+    def start_test(self, test_full_name: str, test_number: int):
+        """ start the span of the test """
+        self.test_span = self.start_span(test_full_name, self.run_span, {"test": test_full_name, "number": test_number})
+
+    def phase(self, name: str):
+        """ start the span of the test phase, ending the previous one (the phase ends with the test if not followed) """
+        if self.test_span is None:
+            return
+        if self.phase_span is not None:
+            self.end_span(self.phase_span)
+        self.phase_span = self.start_span(name, self.test_span, {})
+
+    def end_test(self, outcome: str, test_metrics):
+        """ end the span of the test and of its last phase, with the outcome and the failure class (if any) """
+        if self.test_span is None:
+            return
+        if self.phase_span is not None:
+            self.end_span(self.phase_span)
+            self.phase_span = None
+        attributes = {"outcome": outcome}
+        for name in ("failure_class", "round_trip_time", "response_bytes", "diff_tool", "diff_time"):
+            if name in test_metrics:
+                attributes[name] = test_metrics[name]
+        self.test_span["attributes"].extend(get_otlp_attributes(attributes))
+        self.end_span(self.test_span, OTLP_STATUS_OK if outcome == "pass" else OTLP_STATUS_ERROR)
+        self.test_span = None
+
+    def export(self):
+        """ post the ended spans to the collector """
+        if len(self.spans) == 0:
+            return
+        resource = {"attributes": get_otlp_attributes({"service.name": OTLP_SERVICE_NAME, "chain": self.net})}
+        traces = {"resourceSpans": [{"resource": resource, "scopeSpans": [{"scope": {"name": OTLP_SERVICE_NAME}, "spans": self.spans}]}]}
+        self.spans = []
+        cmd = '''curl --silent --output /dev/null --write-out "%{http_code}" -X POST -H "Content-Type: application/json" --data-binary @- ''' + self.url
+        process = subprocess.run(shlex.split(cmd), input=json.dumps(traces), stdout=subprocess.PIPE, universal_newlines=True,
+                                 check=False)
+        if process.stdout.strip() not in ("200", "202"):
+            if self.export_failures == 0:
+                print("trace export to " + self.url + " failed: HTTP " + process.stdout.strip())
+            self.export_failures = self.export_failures + 1
+
+    def close(self):
+        """ end the run span (and the test interrupted, if any) and export the remaining spans """
+        if self.test_span is not None:
+            self.end_test("aborted", {})
+        self.end_span(self.run_span)
+        self.export()
+        print(f"Trace id:                     {self.trace_id}" +
+              (f" ({self.export_failures} exports failed)" if self.export_failures > 0 else ""))
+
+
+def get_otlp_attributes(attributes):
+    """ return the attributes as OTLP key-values """
+    key_values = []
+    for key, value in attributes.items():
+        if isinstance(value, bool):
+            key_values.append({"key": key, "value": {"boolValue": value}})
+        elif isinstance(value, int):
+            key_values.append({"key": key, "value": {"intValue": str(value)}})
+        elif isinstance(value, float):
+            key_values.append({"key": key, "value": {"doubleValue": value}})
+        else:
+            key_values.append({"key": key, "value": {"stringValue": str(value)}})
+    return key_values
+
+
+def trace_phase(config, phase: str):
+    """ start the phase of the test in the trace of the run, if any """
+    if config.tracer is not None:
+        config.tracer.phase(phase)
+
+
+class Checkpoint:
+    """ Outcomes of the completed tests saved every N tests (and at exit), so that after a crash or a node restart
+        the run can be resumed (--resume) skipping the tests already passed
+    """
+
+    def __init__(self, name: str, every: int, outcomes):
+        """ Create a new Checkpoint saved into name, resuming from the given outcomes """
+        self.name = name
+        self.every = every
+        self.outcomes = dict(outcomes)
+        self.passed = {test_full_name for test_full_name, outcome in outcomes.items() if outcome == "pass"}
+        self.completed = 0
+
+    @classmethod
+    def load(cls, name: str, every: int):
+        """ parse checkpoint file i.e. JSON object of test full name -> pass or fail, return None if not found or invalid
+        """
+        try:
+            with open(name, encoding='utf8') as file:
+                outcomes = json.load(file)
+        except (FileNotFoundError, json.decoder.JSONDecodeError):
+            return None
+        if not isinstance(outcomes, dict):
+            return None
+        return cls(name, every, outcomes)
+
+    def is_passed(self, test_full_name: str):
+        """ determine if the test passed before resume """
+        return test_full_name in self.passed
+
+    def record(self, test_full_name: str, ret: int):
+        """ record the test outcome, saving the checkpoint every N completed tests """
+        self.outcomes[test_full_name] = "pass" if ret == 0 else "fail"
+        self.completed = self.completed + 1
+        if self.completed % self.every == 0:
+            self.save()
+
+    def save(self):
+        """ write the checkpoint file atomically """
+        with open(self.name + ".tmp", 'w', encoding='utf8') as file:
+            file.write(json.dumps(self.outcomes, indent=4, sort_keys=True))
+        os.replace(self.name + ".tmp", self.name)
+
+
+class FailureManifest:
+    """ Failed tests with their failure class and artifacts written as JSON into the results directory (also on abort),
+        so that orchestration scripts can tell the failures apart without parsing the output
+    """
+
+    def __init__(self, name: str, net: str, node_states):
+        """ Create a new FailureManifest saved into name, node_states the fingerprint of the nodes at run start """
+        self.name = name
+        self.net = net
+        self.node_states = node_states
+        self.failures = []
+        self.completed = False
+
+    def record(self, config, test_full_name: str, test_number: int, json_file: str = ""):
+        """ record the failed test with its failure class and the artifacts left in the results directory (if a test file)
+        """
+        output_base_name = config.output_dir + get_output_base_name(json_file) if json_file != "" else ""
+        output_dir_name = os.path.dirname(output_base_name)
+        artifacts = []
+        if output_base_name != "" and os.path.isdir(output_dir_name):
+            artifacts = sorted(os.path.join(output_dir_name, file_name) for file_name in os.listdir(output_dir_name)
+                               if os.path.join(output_dir_name, file_name).startswith(output_base_name + "-"))
+        failure_class = config.test_metrics.get("failure_class", "")
+        self.failures.append({
+            "test": test_full_name,
+            "number": test_number,
+            "class": failure_class,
+            "transport": failure_class in TRANSPORT_FAILURE_CLASSES,
+            "artifacts": artifacts,
+        })
+
+    def get_exit_code(self):
+        """ return the exit code of the run by the classes of the failures """
+        if len(self.failures) == 0:
+            return EXIT_SUCCESS
+        if all(failure["transport"] for failure in self.failures):
+            return EXIT_TRANSPORT_FAILURES
+        return EXIT_CONTENT_FAILURES
+
+    def complete(self):
+        """ mark the run as completed (not aborted) and save the manifest """
+        self.completed = True
+        self.save()
+
+    def save(self):
+        """ write the manifest file """
+        with open(self.name, 'w', encoding='utf8') as file:
+            file.write(json.dumps({"net": self.net, "nodes": self.node_states, "completed": self.completed,
+                                   "exit_code": self.get_exit_code(), "failures": self.failures}, indent=4))
+
+
+class Fixtures:
+    """ Responses of the daemon under test recorded at a block height (--record-fixtures) and used as expected side
+        (--fixtures); the tests sensitive to the head (block tags e.g. latest, methods on head) are skipped or re-pinned
+        to the recorded height if the head of the target differs
+    """
+
+    def __init__(self, name: str, block_height: int, responses):
+        """ Create new Fixtures saved into name recorded at block_height """
+        self.name = name
+        self.block_height = block_height
+        self.responses = dict(responses)
+        self.head_matches = True
+
+    @classmethod
+    def load(cls, name: str):
+        """ parse fixtures file i.e. JSON object with block_height and responses (test -> response), return None if not
+            found or invalid
+        """
+        try:
+            with open(name, encoding='utf8') as file:
+                fixtures = json.load(file)
+        except (FileNotFoundError, json.decoder.JSONDecodeError):
+            return None
+        if not isinstance(fixtures, dict) or not isinstance(fixtures.get("block_height"), int) or \
+                not isinstance(fixtures.get("responses"), dict):
+            return None
+        return cls(name, fixtures["block_height"], fixtures["responses"])
+
+    def get_response(self, json_file: str):
+        """ return the recorded response of the test, None if not recorded """
+        return self.responses.get(json_file)
+
+    def record(self, json_file: str, response):
+        """ record the response of the test """
+        self.responses[json_file] = response
+
+    def save(self):
+        """ write the fixtures file atomically """
+        with open(self.name + ".tmp", 'w', encoding='utf8') as file:
+            file.write(json.dumps({"block_height": self.block_height, "responses": self.responses}, indent=4, sort_keys=True))
+        os.replace(self.name + ".tmp", self.name)
+
+
+def has_block_tag(value):
+    """ determine if any string contained in value is a block tag (e.g. latest)
+    """
+    if isinstance(value, str):
+        return value in BLOCK_TAGS
+    if isinstance(value, list):
+        return any(has_block_tag(item) for item in value)
+    if isinstance(value, dict):
+        return any(has_block_tag(item) for item in value.values())
+    return False
+
+
+def pin_block_tags(value, block_height: int):
+    """ return the value with the block tags contained in any string replaced by the block height
+    """
+    if isinstance(value, str):
+        return hex(block_height) if value in BLOCK_TAGS else value
+    if isinstance(value, list):
+        return [pin_block_tags(item, block_height) for item in value]
+    if isinstance(value, dict):
+        return {key: pin_block_tags(item, block_height) for key, item in value.items()}
+    return value
+
+
+def is_pinning_skipped(config, test_file: str):
+    """ determine if the test is skipped being sensitive to the head of the target which differs from the fixtures
+        height: always with --fixture-pinning skip, only if it can't be re-pinned (methods on head) otherwise
+    """
+    if config.fixtures is None or config.fixtures.head_matches:
+        return False
+    for json_rpc in load_test_commands(config, test_file):
+        request = json_rpc["request"]
+        for single_request in request if isinstance(request, list) else [request]:
+            if not isinstance(single_request, dict):
+                continue
+            if single_request.get("method") in methods_on_head:
+                return True
+            if config.fixture_pinning == FIXTURE_PINNING_SKIP and has_block_tag(single_request.get("params")):
+                return True
+    return False
+
+
+def get_head_height(config):
+    """ return the head block number of the daemon under test, None if not available
+    """
+    response = send_request(config, {"jsonrpc": "2.0", "method": "eth_blockNumber", "params": [], "id": 1})
+    try:
+        return int(response["result"], 16)
+    except (TypeError, KeyError, ValueError):
+        return None
+
+
+class RequestRules:
+    """ Rewrite the request fields before sending according to the rules loaded from a YAML file, e.g.:
+        replace:                  # placeholder -> value substitutions in any string of the request
+          "<chainId>": "0x5"
+        renumber_ids: true        # unique JSON-RPC ids across the run, restored in responses before comparison, true
+                                  # or list of the transports renumbered (e.g. [https, https+gzip])
+        latest_block:             # method -> position of block parameter replaced by latest (--tests-on-latest-block)
+          eth_getBalance: 1
+    """
+
+    def __init__(self, rules, tests_on_latest_block: bool):
+        """ Create new RequestRules """
+        self.placeholders = rules.get("replace", {}) or {}
+        self.renumber_ids = rules.get("renumber_ids", False)
+        self.latest_block = rules.get("latest_block", {}) or {}
+        self.tests_on_latest_block = tests_on_latest_block
+        self.next_id = 1
+
+    @classmethod
+    def load(cls, name, tests_on_latest_block: bool):
+        """ parse rules file, return None if not found or invalid
+        """
+        try:
+            with open(name, encoding='utf8') as file:
+                rules = yaml.safe_load(file)
+        except (FileNotFoundError, yaml.YAMLError):
+            return None
+        if rules is None:
+            rules = {}
+        if not isinstance(rules, dict):
+            return None
+        return cls(rules, tests_on_latest_block)
+
+    def replace(self, value):
+        """ substitute the placeholders in all the strings contained in value
+        """
+        if isinstance(value, str):
+            for placeholder, replacement in self.placeholders.items():
+                value = value.replace(placeholder, str(replacement))
+            return value
+        if isinstance(value, list):
+            return [self.replace(item) for item in value]
+        if isinstance(value, dict):
+            return {key: self.replace(item) for key, item in value.items()}
+        return value
+
+    def apply(self, request):
+        """ return the transformed request and the map from new to original ids
+        """
+        id_map = {}
+        request = self.replace(request)
+        for single_request in request if isinstance(request, list) else [request]:
+            if not isinstance(single_request, dict):
+                continue
+            method = single_request.get("method", "")
+            params = single_request.get("params")
+            if self.tests_on_latest_block and method in self.latest_block and isinstance(params, list):
+                position = int(self.latest_block[method])
+                if position < len(params):
+                    params[position] = "latest"
+            if self.renumber_ids and "id" in single_request:
+                id_map[self.next_id] = single_request["id"]
+                single_request["id"] = self.next_id
+                self.next_id = self.next_id + 1
+        return request, id_map
+
+    def select_transport(self, transport: str):
+        """ keep the id renumbering only if enabled for the transport of the run (renumber_ids true or listing it)
+        """
+        if isinstance(self.renumber_ids, list):
+            self.renumber_ids = transport in self.renumber_ids
+
+    @staticmethod
+    def restore_ids(response, id_map):
+        """ put back into the response the ids of the original request, the batch replies reordered as the requests
+            before, so that replies to requests sharing the same original id (e.g. all 1) are matched by position
+        """
+        if not id_map:
+            return response
+        if isinstance(response, list):
+            request_order = {new_id: position for position, new_id in enumerate(id_map)}
+            response = sorted(response, key=lambda reply: request_order.get(reply.get("id") if isinstance(reply, dict) else None,
+                                                                             len(request_order)))
+        for single_response in response if isinstance(response, list) else [response]:
+            if isinstance(single_response, dict) and single_response.get("id") in id_map:
+                single_response["id"] = id_map[single_response["id"]]
+        return response
+
+
+def parse_json_stream(text: str):
+    """ parse a single JSON document or, as in streaming mode, a sequence of concatenated or newline-delimited
+        JSON documents returned as list
+    """
+    try:
+        return json.loads(text)
+    except json.decoder.JSONDecodeError:
+        decoder = json.JSONDecoder()
+        documents = []
+        position = 0
+        while position < len(text):
+            if text[position].isspace():
+                position = position + 1
+                continue
+            document, position = decoder.raw_decode(text, position)
+            documents.append(document)
+        if len(documents) < 2:
+            raise
+        return documents
+
+
+def align_batch_response(response, expected_response):
+    """ return the batch response reordered by id as the expected one, the batch replies being allowed in any order
+        (replies without id e.g. notifications, duplicated or unexpected ids leave the response unchanged)
+    """
+    if not isinstance(response, list) or not isinstance(expected_response, list):
+        return response
+    replies = {}
+    for reply in response:
+        if not isinstance(reply, dict) or "id" not in reply:
+            return response
+        reply_id = json.dumps(reply["id"])
+        if reply_id in replies:
+            return response
+        replies[reply_id] = reply
+    aligned = []
+    for expected_reply in expected_response:
+        if not isinstance(expected_reply, dict) or json.dumps(expected_reply.get("id")) not in replies:
+            return response
+        aligned.append(replies.pop(json.dumps(expected_reply.get("id"))))
+    return aligned + [reply for reply in response if json.dumps(reply["id"]) in replies]
+
+
+def sort_unordered_result(response, method: str):
+    """ sort the result array of methods whose result order doesn't matter
+    """
+    if method not in methods_with_unordered_result:
+        return response
+    if not isinstance(response, dict) or not isinstance(response.get("result"), list):
+        return response
+    keys = methods_with_unordered_result[method]
+    response = dict(response)
+    response["result"] = sorted(response["result"],
+                                key=lambda item: tuple(str(item.get(key, "")) if isinstance(item, dict) else "" for key in keys))
+    return response
+
+
+def normalize_value(value, quantity_fields, quantity: bool):
+    """ lower-case hex strings, strip leading zeros of quantities and drop null optional fields
+    """
+    if isinstance(value, dict):
+        return {key: normalize_value(item, quantity_fields, key in quantity_fields) for key, item in value.items() if item is not None}
+    if isinstance(value, list):
+        return [normalize_value(item, quantity_fields, quantity) for item in value]
+    if isinstance(value, str) and value[:2] in ("0x", "0X"):
+        try:
+            int(value[2:] or "0", 16)
+        except ValueError:
+            return value
+        value = value.lower()
+        if quantity:
+            value = "0x" + (value[2:].lstrip("0") or "0")
+    return value
+
+
+def normalize_response(response, method: str):
+    """ normalize cosmetic encoding differences of the response according to the method rules
+    """
+    if not isinstance(response, dict):
+        return response
+    quantity_fields = methods_with_quantity_fields.get(method, ())
+    response = dict(response)
+    for key in ("result", "error"):
+        if key in response and response[key] is not None:
+            response[key] = normalize_value(response[key], quantity_fields, key == "result" and "result" in quantity_fields)
+    return response
+
+
+def get_json_path(value, path: str):
+    """ return the value at the dotted path (e.g. result.transactions[0].gas), raise KeyError if missing
+    """
+    for token in path.removeprefix("$").replace("[", ".").replace("]", "").split("."):
+        if token == "":
+            continue
+        if isinstance(value, list):
+            try:
+                value = value[int(token)]
+            except (IndexError, ValueError) as error:
+                raise KeyError(path) from error
+        elif isinstance(value, dict):
+            value = value[token]
+        else:
+            raise KeyError(path)
+    return value
+
+
+def to_comparable(value):
+    """ return hex quantities as int, any other value unchanged
+    """
+    if isinstance(value, str) and value[:2] in ("0x", "0X"):
+        try:
+            return int(value, 16)
+        except ValueError:
+            return value
+    return value
+
+
+def is_under_paths(path: str, paths):
+    """ return True if the path (array indexes omitted) is any of the paths or nested into it, the empty path covering all
+    """
+    return any(path_prefix == "" or path == path_prefix or path.startswith(path_prefix + ".") for path_prefix in paths)
+
+
+def align_numbers(response, expected_response, paths, path: str = ""):
+    """ return the response whose hex quantities (numbers) under the paths are taken from the expected response when it has
+        the same value as number (hex quantity), so that just real differences remain
+    """
+    if isinstance(response, dict) and isinstance(expected_response, dict):
+        return {key: align_numbers(value, expected_response[key], paths, path + "." + key if path != "" else key)
+                if key in expected_response else value for key, value in response.items()}
+    if isinstance(response, list) and isinstance(expected_response, list) and len(response) == len(expected_response):
+        return [align_numbers(item, expected_item, paths, path) for item, expected_item in zip(response, expected_response)]
+    if is_quantity(response) and is_quantity(expected_response) and isinstance(response, str) != isinstance(expected_response, str) \
+            and to_comparable(response) == to_comparable(expected_response) and is_under_paths(path, paths):
+        return expected_response
+    return response
+
+
+def get_sample_value(value):
+    """ return the value for the diff sample, truncated JSON text if too big
+    """
+    text = json.dumps(value)
+    return value if len(text) <= DIFF_SAMPLE_VALUE_SIZE else text[:DIFF_SAMPLE_VALUE_SIZE] + "..."
+
+
+def summarize_diff(expected, actual, max_entries: int, summary, path: str = ""):
+    """ count into summary the additions, deletions and changes from expected to actual, recording the first
+        divergence path and a sample of the first max_entries differences
+    """
+    entry = None
+    if isinstance(expected, dict) and isinstance(actual, dict):
+        for key in sorted(set(expected) | set(actual), key=str):
+            key_path = path + "." + str(key) if path != "" else str(key)
+            if key not in actual:
+                summary["deletions"] = summary["deletions"] + 1
+                entry = {"op": "remove", "path": key_path, "expected": get_sample_value(expected[key])}
+            elif key not in expected:
+                summary["additions"] = summary["additions"] + 1
+                entry = {"op": "add", "path": key_path, "actual": get_sample_value(actual[key])}
+            else:
+                summarize_diff(expected[key], actual[key], max_entries, summary, key_path)
+                continue
+            add_diff_sample(entry, max_entries, summary)
+        return
+    if isinstance(expected, list) and isinstance(actual, list):
+        for index in range(max(len(expected), len(actual))):
+            index_path = path + "[" + str(index) + "]"
+            if index >= len(actual):
+                summary["deletions"] = summary["deletions"] + 1
+                entry = {"op": "remove", "path": index_path, "expected": get_sample_value(expected[index])}
+            elif index >= len(expected):
+                summary["additions"] = summary["additions"] + 1
+                entry = {"op": "add", "path": index_path, "actual": get_sample_value(actual[index])}
+            else:
+                summarize_diff(expected[index], actual[index], max_entries, summary, index_path)
+                continue
+            add_diff_sample(entry, max_entries, summary)
+        return
+    if expected != actual:
+        summary["changes"] = summary["changes"] + 1
+        add_diff_sample({"op": "replace", "path": path, "expected": get_sample_value(expected), "actual": get_sample_value(actual)},
+                        max_entries, summary)
+
+
+def add_diff_sample(entry, max_entries: int, summary):
+    """ record the difference as first divergence if none yet and into the sample if not full
+    """
+    if summary["first_divergence"] is None:
+        summary["first_divergence"] = entry["path"]
+    if len(summary["sample"]) < max_entries:
+        summary["sample"].append(entry)
+
+
+def get_diff_summary(expected_response, response, max_entries: int):
+    """ return the summary of the differences of the response from the expected one
+    """
+    summary = {"additions": 0, "deletions": 0, "changes": 0, "first_divergence": None, "sample": []}
+    summarize_diff(expected_response, response, max_entries, summary)
+    return summary
+
+
+def get_sorted_primitives(value):
+    """ return the value with the arrays of primitive values sorted at any depth, i.e. as compared by json-diff -s
+    """
+    if isinstance(value, dict):
+        return {key: get_sorted_primitives(item) for key, item in value.items()}
+    if isinstance(value, list):
+        items = [get_sorted_primitives(item) for item in value]
+        if all(not isinstance(item, (dict, list)) for item in items):
+            return sorted(items, key=lambda item: json.dumps(item, sort_keys=True))
+        return items
+    return value
+
+
+def is_diff_summarized(config, diff_summary):
+    """ determine if the diff summary replaces the diff (more entries than the max diff entries and not full diff)
+    """
+    if diff_summary is None or config.full_diff:
+        return False
+    return diff_summary["additions"] + diff_summary["deletions"] + diff_summary["changes"] > config.max_diff_entries
+
+
+def record_diff_time(config, diff_tool: str, diff_time: float):
+    """ account the time spent by the diff tool into the test metrics and into the cumulative ones of the run
+    """
+    config.test_metrics["diff_tool"] = diff_tool
+    config.test_metrics["diff_time"] = config.test_metrics.get("diff_time", 0.0) + diff_time
+    tool_timings = config.diff_timings.setdefault(diff_tool, [0, 0.0])
+    tool_timings[0] = tool_timings[0] + 1
+    tool_timings[1] = tool_timings[1] + diff_time
+
+
+def is_quantity(value):
+    """ return True if value is a number or a hex quantity string
+    """
+    if isinstance(value, bool):
+        return False
+    if isinstance(value, (int, float)):
+        return True
+    return isinstance(value, str) and re.fullmatch(r"0x[0-9a-fA-F]+", value) is not None
+
+
+def get_canonical_order(value):
+    """ return the value with the arrays sorted at any depth, to compare regardless of the order
+    """
+    if isinstance(value, dict):
+        return {key: get_canonical_order(item) for key, item in value.items()}
+    if isinstance(value, list):
+        return sorted((get_canonical_order(item) for item in value), key=lambda item: json.dumps(item, sort_keys=True))
+    return value
+
+
+def find_mismatches(expected, actual, mismatches):
+    """ collect into mismatches the kinds of the differences from expected to actual: missing (or extra) fields,
+        numeric changes and other changes
+    """
+    if isinstance(expected, dict) and isinstance(actual, dict):
+        if set(expected) != set(actual):
+            mismatches.add("missing field")
+        for key in set(expected) & set(actual):
+            find_mismatches(expected[key], actual[key], mismatches)
+    elif isinstance(expected, list) and isinstance(actual, list) and len(expected) == len(actual):
+        for expected_item, actual_item in zip(expected, actual):
+            find_mismatches(expected_item, actual_item, mismatches)
+    elif expected != actual:
+        mismatches.add("numeric only" if is_quantity(expected) and is_quantity(actual) else "other")
+
+
+def is_valid_envelope(response):
+    """ return True if the response (or each reply of the batch response) is a JSON-RPC 2.0 response
+    """
+    if isinstance(response, list):
+        return len(response) > 0 and all(is_valid_envelope(reply) for reply in response)
+    return isinstance(response, dict) and response.get("jsonrpc") == "2.0" and "id" in response and \
+        ("result" in response) != ("error" in response)
+
+
+def get_error_code(reply):
+    """ return the error code of the reply, None if not an error
+    """
+    error = reply.get("error") if isinstance(reply, dict) else None
+    return error.get("code") if isinstance(error, dict) else error
+
+
+def classify_mismatch(response, expected_response):
+    """ return the failure class of the response differing from the expected one: invalid envelope, error code
+        mismatch (error vs result or different codes) or result mismatch with sub-class (numeric only, ordering only,
+        missing field or other)
+    """
+    if not is_valid_envelope(response):
+        return FAILURE_INVALID_ENVELOPE
+    replies = zip(response, expected_response) if isinstance(response, list) and isinstance(expected_response, list) and \
+        len(response) == len(expected_response) else [(response, expected_response)]
+    for reply, expected_reply in replies:
+        if isinstance(reply, dict) and isinstance(expected_reply, dict) and \
+                (("error" in reply) != ("error" in expected_reply) or get_error_code(reply) != get_error_code(expected_reply)):
+            return FAILURE_ERROR_CODE
+    if get_canonical_order(response) == get_canonical_order(expected_response):
+        return FAILURE_RESULT + " (ordering only)"
+    mismatches = set()
+    find_mismatches(expected_response, response, mismatches)
+    if "missing field" in mismatches:
+        return FAILURE_RESULT + " (missing field)"
+    if mismatches == {"numeric only"}:
+        return FAILURE_RESULT + " (numeric only)"
+    return FAILURE_RESULT + " (other)"
+
+
+def get_write_out_options(config):
+    """ return the curl write-out options of the requests to the daemon under test: HTTP status followed by the byte sizes
+        (--byte-metrics) and the connection timings (--connection-metrics) if requested
+    """
+    if config.byte_metrics is None and config.connection_metrics is None:
+        return HTTP_STATUS_OPTIONS
+    fields = "%{stderr}%{http_code}"
+    if config.byte_metrics is not None:
+        fields = fields + BYTE_METRICS_FIELDS
+    if config.connection_metrics is not None:
+        fields = fields + CONNECTION_METRICS_FIELDS
+    return ' --write-out "' + fields + '"'
+
+
+def get_http_status(write_out: str):
+    """ return the HTTP status written out by curl on stderr (first item), empty string if none
+    """
+    items = write_out.split() if write_out is not None else []
+    return items[0] if len(items) > 0 and items[0].isdigit() else ""
+
+
+def tag_failure(config, failure_class: str, http_status: str = ""):
+    """ count the failure in its class and return the tag of the failed line, the HTTP status of the target (if any)
+        not successful prevailing on the classes by content
+    """
+    if http_status not in ("", "000") and not http_status.startswith("2") and failure_class not in (FAILURE_TRANSPORT, FAILURE_TIMEOUT):
+        failure_class = FAILURE_HTTP_STATUS
+    config.failure_classes[failure_class] = config.failure_classes.get(failure_class, 0) + 1
+    config.test_metrics["failure_class"] = failure_class
+    return " [" + failure_class + "]"
+
+
+def check_expectations(response, expectations):
+    """ evaluate the test assertions against the response, return the first failed one or empty string
+    """
+    for expectation in expectations:
+        path = expectation.get("path", "")
+        try:
+            value = get_json_path(response, path)
+        except KeyError:
+            if expectation.get("exists", True):
+                return path + " missing"
+            continue
+        for operator_name, expected in expectation.items():
+            if operator_name == "path":
+                continue
+            if operator_name == "exists":
+                if not expected:
+                    return path + " exists"
+                continue
+            if operator_name not in expect_operators:
+                return path + " unknown operator " + operator_name
+            try:
+                satisfied = expect_operators[operator_name](to_comparable(value), to_comparable(expected))
+            except TypeError:
+                satisfied = False
+            if not satisfied:
+                return f"{path}: {value} {operator_name} {expected}"
+    return ""
+
+
+def is_error_message_matching(message, expected_message, error_message_mode: str):
+    """ determine if the error message matches the expected one according to the mode
+    """
+    if error_message_mode == ERROR_MESSAGE_IGNORE:
+        return 1
+    if not isinstance(message, str) or not isinstance(expected_message, str):
+        return 1 if message == expected_message else 0
+    if error_message_mode == ERROR_MESSAGE_PREFIX:
+        return 1 if message.startswith(expected_message) or expected_message.startswith(message) else 0
+    if error_message_mode == ERROR_MESSAGE_REGEX:
+        try:
+            return 1 if re.search(expected_message, message) is not None else 0
+        except re.error:
+            return 1 if message == expected_message else 0
+    return 1 if message == expected_message else 0
+
+
+def get_comparison_policy(config, method: str):
+    """ return the comparison policy of the namespace of the method
+    """
+    return config.namespace_policies.get(method.split("_")[0] + "_", COMPARISON_EXACT)
+
+
+def align_result(response, expected_response):
+    """ return the response whose result is taken from the expected response when both have one, so that just the envelope,
+        the result or error presence and the error are compared
+    """
+    if isinstance(response, list) and isinstance(expected_response, list) and len(response) == len(expected_response):
+        return [align_result(item, expected_item) for item, expected_item in zip(response, expected_response)]
+    if not isinstance(response, dict) or not isinstance(expected_response, dict) or not is_valid_envelope(response):
+        return response
+    if "result" not in response or "result" not in expected_response:
+        return response
+    response = dict(response)
+    response["result"] = expected_response["result"]
+    return response
+
+
+def align_error(response, expected_response, error_message_mode: str, ignore_error_data: bool):
+    """ return the response whose error message and data are taken from the expected response when, the code being
+        the same, they match according to the error comparison rules (so that just real differences remain)
+    """
+    if isinstance(response, list) and isinstance(expected_response, list) and len(response) == len(expected_response):
+        return [align_error(item, expected_item, error_message_mode, ignore_error_data)
+                for item, expected_item in zip(response, expected_response)]
+    if not isinstance(response, dict) or not isinstance(expected_response, dict):
+        return response
+    error = response.get("error")
+    expected_error = expected_response.get("error")
+    if not isinstance(error, dict) or not isinstance(expected_error, dict) or error.get("code") != expected_error.get("code"):
+        return response
+    error = dict(error)
+    if is_error_message_matching(error.get("message"), expected_error.get("message"), error_message_mode):
+        error.pop("message", None)
+        if "message" in expected_error:
+            error["message"] = expected_error["message"]
+    if ignore_error_data:
+        error.pop("data", None)
+        if "data" in expected_error:
+            error["data"] = expected_error["data"]
+    response = dict(response)
+    response["error"] = error
+    return response
+
+
+def get_jwt_token(jwt_secret: str, iat_skew: int = 0, expires_in=None, algorithm: str = "HS256", claims=None):
+    """ return the JWT token signed by the hex secret with issued at now plus iat_skew secs, expiration after expires_in
+        secs (if any) and the additional claims (if any); algorithm none means unsigned
+    """
+    payload = {"iat": datetime.fromtimestamp(datetime.now(pytz.utc).timestamp() + iat_skew, pytz.utc)}
+    if expires_in is not None:
+        payload["exp"] = datetime.fromtimestamp(datetime.now(pytz.utc).timestamp() + expires_in, pytz.utc)
+    payload.update(claims or {})
+    if algorithm == "none":
+        return str(jwt.encode(payload, None, algorithm="none"))
+    return str(jwt.encode(payload, bytes.fromhex(jwt_secret.removeprefix("0x")), algorithm=algorithm))
+
+
+def get_jwt_auth(jwt_secret: str, auth_case: str = ""):
+    """ return the curl authorization header for the JWT secret, altered as requested by the auth test case
+    """
+    if jwt_secret == "" or auth_case == AUTH_TEST_NO_TOKEN:
+        return ""
+    if auth_case == AUTH_TEST_EXPIRED_IAT:
+        encoded = get_jwt_token(jwt_secret, iat_skew=-AUTH_TEST_IAT_SKEW)
+    elif auth_case == AUTH_TEST_WRONG_SECRET:
+        encoded = get_jwt_token(bytes(reversed(bytes.fromhex(jwt_secret))).hex())
+    elif auth_case == AUTH_TEST_WRONG_ALGORITHM:
+        encoded = get_jwt_token(jwt_secret, algorithm="none")
+    else:
+        encoded = get_jwt_token(jwt_secret)
+    return "-H \"Authorization: Bearer " + encoded + "\" "
+
+
+def get_curl_command(config, jwt_auth: str, request_data: str, target: str, options: str = "", reference: bool = False):
+    """ return the curl command posting request_data to target, the single place where transport options (TLS, response
+        compression, proxy) and the custom authentication (headers, basic auth) of the target or of the reference are applied
+        with the IPC transport the requests to the daemon under test are sent by the IPC client instead (same options)
+    """
+    if config.transport == TRANSPORT_IPC and not reference:
+        return shlex.quote(sys.executable) + " " + shlex.quote(IPC_CLIENT) + " --ipc-path " + shlex.quote(config.ipc_path) + \
+            request_data + options
+    options = (config.reference_auth if reference else config.target_auth) + options
+    if config.compressed_response:
+        options = " --compressed" + options
+    if config.proxy != "":
+        options = " --proxy " + config.proxy + options
+    return '''curl --silent''' + config.tls_options + options + ''' -X POST -H "Content-Type: application/json" ''' + jwt_auth + request_data + target
+
+
+def run_auth_tests(config, request_dumps: str, target: str, json_file: str, test_number):
+    """ send the request with each invalid authentication and check HTTP 401 is returned
+    """
+    for auth_case in AUTH_TEST_CASES:
+        cmd = get_curl_command(config, get_jwt_auth(config.jwt_secret, auth_case), ''' --data \'''' + request_dumps + '''\' ''', target,
+                               ''' --output /dev/null --write-out "%{http_code}"''')
+        process = subprocess.run(shlex.split(cmd), stdout=subprocess.PIPE, universal_newlines=True, check=False)
+        http_code = process.stdout.strip()
+        if http_code != "401":
+            if config.verbose_level:
+                print(f"Failed (auth {auth_case}: HTTP {http_code} instead of 401)" + tag_failure(config, FAILURE_HTTP_STATUS))
+            else:
+                file = json_file.ljust(60)
+                print(f"{test_number:03d}. {file} Failed (auth {auth_case}: HTTP {http_code} instead of 401)" +
+                      tag_failure(config, FAILURE_HTTP_STATUS))
+            if config.exit_on_fail:
+                print("TEST ABORTED!")
+                sys.exit(1)
+            return 1
+    return 0
+
+
+def get_request_data(config, request_dumps: str, request_file: str):
+    """ return the curl options sending the request body, gzip-compressed into request_file if requested
+    """
+    if not config.gzip_request:
+        return ''' --data \'''' + request_dumps + '''\' '''
+    os.makedirs(os.path.dirname(request_file), exist_ok=True)
+    with gzip.open(request_file, 'wb') as zipped_file:
+        zipped_file.write(request_dumps.encode('utf8'))
+    return ''' -H "Content-Encoding: gzip" --data-binary @''' + request_file + " "
+
+
+def run_body_limit_test(config):
+    """ send requests sized at and just above the body size limit, check HTTP 413 is returned only above it
+    """
+    target = config.scheme + get_target(config.daemon_under_test, "web3_clientVersion", config.infura_url, config.daemon_on_host,
+                                        config.daemon_on_port)
+    request = {"jsonrpc": "2.0", "method": "web3_clientVersion", "params": [], "id": 1, "padding": ""}
+    base_size = len(json.dumps(request))
+    for body_size, expected_code in ((config.body_limit, "200"), (config.body_limit + 1, "413")):
+        request["padding"] = "0" * max(body_size - base_size, 0)
+        cmd = get_curl_command(config, get_jwt_auth(config.jwt_secret), ''' --data-binary @- ''', target,
+                               ''' --output /dev/null --write-out "%{http_code}"''')
+        process = subprocess.run(shlex.split(cmd), input=json.dumps(request), stdout=subprocess.PIPE, universal_newlines=True,
+                                 check=False)
+        http_code = process.stdout.strip()
+        if http_code != expected_code:
+            print(f"Body size limit test: Failed ({body_size} bytes: HTTP {http_code} instead of {expected_code})")
+            return 1
+    if config.verbose_level:
+        print("Body size limit test: OK")
+    return 0
+
+
+def run_system_command(cmd: str):
+    """ run cmd as os.system does, but propagate its interruption (Ctrl+C) which os.system ignores
+    """
+    status = os.system(cmd)
+    if os.waitstatus_to_exitcode(status) in (-signal.SIGINT, 128 + signal.SIGINT):
+        raise KeyboardInterrupt
+    return status
+
+
+def exit_on_interrupt():
+    """ exit after Ctrl+C, within SHUTDOWN_TIMEOUT secs even if the cleanup (e.g. docker container removal) hangs
+    """
+    print("\nTEST INTERRUPTED!", flush=True)
+    watchdog = threading.Timer(SHUTDOWN_TIMEOUT, os._exit, args=(1,))
+    watchdog.daemon = True
+    watchdog.start()
+    sys.exit(1)
+
+
 def to_lower_case(file, dest_file):
     """ converts input string into lower case
     """
     cmd = "tr '[:upper:]' '[:lower:]' < " + file + " > " + dest_file
-    os.system(cmd)
+    run_system_command(cmd)
 
 
 def replace_str_from_file(filer, filew, matched_string):
@@ -195,120 +1743,654 @@ def modified_str_from_file(filer, filew, matched_string):
                     output_file.write(line)
 
 
-def is_skipped(api_name, net, exclude_api_list, exclude_test_list, api_file: str, req_test, verify_with_daemon,
-               global_test_number):
-    """ determine if test must be skipped
-    """
-    api_full_name = net + "/" + api_name
-    api_full_test_name = net + "/" + api_file
-    if req_test == -1 and verify_with_daemon == 1:
-        for curr_test_name in api_not_compared:
-            if curr_test_name == api_full_name:
-                return 1
-    if req_test == -1 and verify_with_daemon == 1:
-        for curr_test in tests_not_compared:
-            if curr_test == api_full_test_name:
-                return 1
-    if exclude_api_list != "":  # scans exclude api list (-x)
-        tokenize_exclude_api_list = exclude_api_list.split(",")
-        for exclude_api in tokenize_exclude_api_list:
-            if exclude_api in api_full_name:
-                return 1
-    if exclude_test_list != "":  # scans exclude test list (-X)
-        tokenize_exclude_test_list = exclude_test_list.split(",")
-        for exclude_test in tokenize_exclude_test_list:
-            if exclude_test == str(global_test_number):
-                return 1
-    return 0
+def is_not_compared_api(config, api_name: str):
+    """ determine if the API is in the list of the APIs not compared with the reference daemon (-d)
+    """
+    return config.req_test == -1 and config.verify_with_daemon == 1 and config.net + "/" + api_name in api_not_compared
+
+
+def is_not_compared_test(config, test_file: str):
+    """ determine if the test is in the list of the tests not compared with the reference daemon (-d)
+    """
+    return config.req_test == -1 and config.verify_with_daemon == 1 and \
+        config.net + "/" + get_archive_base_name(test_file) in tests_not_compared
+
+
+def is_excluded_api(config, api_name: str):
+    """ determine if the API matches any of the exclude API list (-x)
+    """
+    return any(exclude_api in config.net + "/" + api_name for exclude_api in config.exclude_api_list.split(",") if exclude_api != "")
+
+
+def is_excluded_test(config, global_test_number: int):
+    """ determine if the global test number is in the exclude test list (-X)
+    """
+    return str(global_test_number) in config.exclude_test_list.split(",")
+
+
+def is_testing_tags(config, test_file: str):
+    """ determine if any request of the test has any of the requested tags in its metadata ("tags" in test)
+    """
+    if config.tags == "":
+        return 1
+    for json_rpc in load_test_commands(config, test_file):
+        if any(tag in json_rpc.get("test", {}).get("tags", []) for tag in config.tags.split(",")):
+            return 1
+    return 0
+
+
+def is_requested_test(config, global_test_number: int, test_number: int):
+    """ determine if the test is the requested one (-t) if any: global test number or, with -a, test number within the API
+    """
+    if config.requested_apis == "":
+        return config.req_test in (-1, global_test_number)
+    return config.req_test in (-1, test_number)
+
+
+def get_test_addresses(config, test_file: str):
+    """ return the stable addresses of the test, unlike the global test number not changing when tests are added: path
+        (e.g. eth_call/test_07.json), path without extension (eth_call/test_07), path of the parametrized test file (all
+        its cases) and, if requested by id, the ids in the test metadata ("id" in test)
+    """
+    file_name = get_test_case(test_file)[0]
+    addresses = {test_file, file_name, file_name.split(".")[0]}
+    if any("/" not in address for address in config.run_addresses.split(",")):
+        for json_rpc in load_test_commands(config, test_file):
+            if "id" in json_rpc.get("test", {}):
+                addresses.add(str(json_rpc["test"]["id"]))
+    return addresses
+
+
+def is_requested_address(config, test_file: str):
+    """ determine if the test is addressed by the requested addresses (--run) if any
+    """
+    if config.run_addresses == "":
+        return 1
+    addresses = get_test_addresses(config, test_file)
+    return any(address in addresses for address in config.run_addresses.split(","))
+
+
+def get_changed_test_files(config):
+    """ return the test files (relative to the chain directory) added, modified or renamed since the git ref, committed
+        or not, untracked ones included
+    """
+    if config.changed_test_files is None:
+        changed_test_files = set()
+        for cmd in (["git", "-C", config.json_dir, "diff", "--name-only", "--relative", "--diff-filter=AMR", config.changed_since, "--"],
+                    ["git", "-C", config.json_dir, "ls-files", "--others", "--exclude-standard"]):
+            process = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True, check=False)
+            if process.returncode != 0:
+                print("changed test files since " + config.changed_since + " not available: " + process.stderr.strip())
+                sys.exit(EXIT_CONFIG_ERROR)
+            changed_test_files.update(process.stdout.splitlines())
+        config.changed_test_files = changed_test_files
+    return config.changed_test_files
+
+
+def is_changed_test(config, test_file: str):
+    """ determine if the test file changed since the git ref (--changed-since) if any
+    """
+    if config.changed_since == "":
+        return 1
+    return get_test_case(test_file)[0] in get_changed_test_files(config)
+
+
+def get_selection_rules(config):
+    """ return the ordered test selection rules as (outcome, reason, predicate of api_name, test_file, global test number and
+        test number within the API), the first matching rule decides the outcome of the test, run if none matches
+    """
+    return [
+        (SELECTION_NOT_SELECTED, "API not requested (-a)",
+         lambda api_name, test_file, global_number, number: not is_testing_apis(api_name, config.requested_apis)),
+        (SELECTION_NOT_SELECTED, "no method matching the method filter (--method-filter)",
+         lambda api_name, test_file, global_number, number: not is_testing_methods(config, test_file)),
+        (SELECTION_NOT_SELECTED, "no requested tag (--tags)",
+         lambda api_name, test_file, global_number, number: not is_testing_tags(config, test_file)),
+        (SELECTION_NOT_SELECTED, "not changed since " + config.changed_since + " (--changed-since)",
+         lambda api_name, test_file, global_number, number: not is_changed_test(config, test_file)),
+        (SELECTION_NOT_SELECTED, "before the start test (-s)",
+         lambda api_name, test_file, global_number, number: config.start_test != "" and global_number < int(config.start_test)),
+        (SELECTION_SKIPPED, "API not compared with the reference (-d)",
+         lambda api_name, test_file, global_number, number: is_not_compared_api(config, api_name)),
+        (SELECTION_SKIPPED, "test not compared with the reference (-d)",
+         lambda api_name, test_file, global_number, number: is_not_compared_test(config, test_file)),
+        (SELECTION_SKIPPED, "API excluded (-x)",
+         lambda api_name, test_file, global_number, number: is_excluded_api(config, api_name)),
+        (SELECTION_SKIPPED, "test excluded (-X)",
+         lambda api_name, test_file, global_number, number: is_excluded_test(config, global_number)),
+        (SELECTION_HEAD_SENSITIVE, "head sensitive, fixtures at block " + str(config.fixtures.block_height if config.fixtures else ""),
+         lambda api_name, test_file, global_number, number: is_pinning_skipped(config, test_file)),
+        (SELECTION_RESUMED, "passed before resume",
+         lambda api_name, test_file, global_number, number:
+             config.checkpoint is not None and config.checkpoint.is_passed(config.net + "/" + test_file)),
+        (SELECTION_NOT_SELECTED, "not the requested test (-t)",
+         lambda api_name, test_file, global_number, number: not is_requested_test(config, global_number, number)),
+        (SELECTION_NOT_SELECTED, "not a requested test address (--run)",
+         lambda api_name, test_file, global_number, number: not is_requested_address(config, test_file)),
+    ]
+
+
+def select_test(selection_rules, api_name: str, test_file: str, global_test_number: int, test_number: int):
+    """ return the selection outcome of the test and its reason
+    """
+    for outcome, reason, predicate in selection_rules:
+        if predicate(api_name, test_file, global_test_number, test_number):
+            return outcome, reason
+    return SELECTION_RUN, "selected"
+
+
+def explain_selection(config):
+    """ print the selection outcome of each test with its reason, without running any test
+    """
+    selection_rules = get_selection_rules(config)
+    selections = {}
+    test_catalog = get_test_catalog(config)
+    dependencies = get_test_dependencies(config, test_catalog)
+    for api_file, test_lists in get_test_schedule(test_catalog, dependencies):
+        for test_name, global_test_number, test_number in test_lists:
+            test_file = api_file + "/" + test_name
+            selection, reason = select_test(selection_rules, api_file, test_file, global_test_number, test_number)
+            if test_file in dependencies:
+                reason = reason + " (after " + ", ".join(dependencies[test_file]) + ")"
+            print(f"{global_test_number:03d}. {test_file.ljust(60)} {selection}: {reason}")
+            selections[selection] = selections.get(selection, 0) + 1
+    for selection, count in sorted(selections.items()):
+        print(f"Number of {selection} tests: {count}")
+
+
+def is_testing_apis(api_name, requested_apis: str):
+    """ determine if api_name is in requested_apis
+    """
+    if requested_apis == "":
+        return 1
+    tokenize_list = requested_apis.split(",")
+    for test in tokenize_list:
+        if test in api_name:
+            return 1
+    return 0
+
+def get_test_methods(config, test_file: str):
+    """ return the methods of the requests (batches included) of the test
+    """
+    methods = []
+    for json_rpc in load_test_commands(config, test_file):
+        request = json_rpc.get("request")
+        for single_request in request if isinstance(request, list) else [request]:
+            if isinstance(single_request, dict) and single_request.get("method", "") not in methods + [""]:
+                methods.append(single_request["method"])
+    return methods
+
+
+def is_testing_methods(config, test_file: str):
+    """ determine if any request method of the test is in the method filter, as exact name or namespace (e.g. debug_)
+    """
+    if config.method_filter == "":
+        return 1
+    filter_list = config.method_filter.split(",")
+    for method in get_test_methods(config, test_file):
+        for method_filter in filter_list:
+            if method == method_filter or (method_filter.endswith("_") and method.startswith(method_filter)):
+                return 1
+    return 0
+
+def is_big_json(test_name, net: str,):
+    """ determine if json is in the big list
+    """
+    test_full_name = net + "/" + get_archive_base_name(test_name)
+    for curr_test_name in tests_with_big_json:
+        if curr_test_name == test_full_name:
+            return 1
+    return 0
+
+
+def is_not_compared_result(test_name, net: str):
+    """ determine if test not compared result
+    """
+    test_full_name = net + "/" + get_archive_base_name(test_name)
+    for curr_test_name in tests_not_compared_result:
+        if curr_test_name == test_full_name:
+            return 1
+    return 0
+
+def is_not_compared_message(test_name, net: str):
+    """ determine if test not compared result
+    """
+    test_full_name = net + "/" + get_archive_base_name(test_name)
+    for curr_test_name in tests_not_compared_message:
+        if curr_test_name == test_full_name:
+            return 1
+    return 0
+
+def has_text_normalization(test_name, net: str):
+    """ determine if the compared files are normalized as text (result or message not compared, message converted)
+    """
+    return is_not_compared_result(test_name, net) or is_not_compared_message(test_name, net) or \
+        is_message_to_be_converted(test_name, net)
+
+
+def get_external_diff_tool(test_name, net: str):
+    """ return the external diff tool of the test: json-patch-jsondiff for the big JSON files not normalized as text,
+        json-diff otherwise
+    """
+    return DIFF_TOOL_JSON_PATCH if is_big_json(test_name, net) and not has_text_normalization(test_name, net) else DIFF_TOOL_JSON_DIFF
+
+
+def is_message_to_be_converted(test_name, net: str):
+    """ determine if test not compared result
+    """
+    test_full_name = net + "/" + get_archive_base_name(test_name)
+    for curr_test_name in tests_message_lower_case:
+        if curr_test_name == test_full_name:
+            return 1
+    return 0
+
+
+def write_scratch_responses(response, expected_response, scratch_silk_file: str, scratch_exp_rsp_file: str):
+    """ serialize the response and the expected response into the scratch files, only when required by the external diff
+        tool or by the artifacts kept of the failed test
+    """
+    with open(scratch_silk_file, 'w', encoding='utf8') as json_file_ptr:
+        json_file_ptr.write(json.dumps(response, indent=5, sort_keys=True))
+    with open(scratch_exp_rsp_file, 'w', encoding='utf8') as json_file_ptr:
+        json_file_ptr.write(json.dumps(expected_response, indent=5, sort_keys=True))
+
+
+def keep_artifacts(config, output_dir: str, artifacts):
+    """ move the scratch artifacts (response, expected response, diff) of the failed test into the output dir unless
+        artifacts are not kept, in that case remove them
+    """
+    for scratch_file, artifact_file in artifacts:
+        if config.keep_artifacts == KEEP_ARTIFACTS_NONE:
+            if os.path.exists(scratch_file):
+                os.remove(scratch_file)
+            continue
+        os.makedirs(output_dir, exist_ok=True)
+        shutil.move(scratch_file, artifact_file)
+
+
+def parse_retention(retention: str):
+    """ parse results retention e.g. 7d, 12h (max age) or 10runs (newest runs kept) into max age in secs and max runs, None
+        if not limited, raise ValueError if invalid
+    """
+    if retention.endswith("runs"):
+        max_runs = int(retention[:-4])
+        if max_runs < 1:
+            raise ValueError(retention)
+        return None, max_runs
+    if retention.endswith("d"):
+        return float(retention[:-1]) * 86400, None
+    if retention.endswith("h"):
+        return float(retention[:-1]) * 3600, None
+    return parse_duration(retention), None
+
+
+def get_run_id(results_dir: str):
+    """ return the id of the new run from the current time (e.g. 20260514-093012), suffixed if already used """
+    base_run_id = datetime.now().strftime(RESULTS_RUN_ID_FORMAT)
+    run_id = base_run_id
+    suffix = 2
+    while os.path.exists(os.path.join(results_dir, run_id)):
+        run_id = f"{base_run_id}-{suffix}"
+        suffix = suffix + 1
+    return run_id
+
+
+def prune_results(results_dir: str, max_age, max_runs, keep_run_id: str = "", dry_run: bool = False):
+    """ remove the run directories of the results directory beyond retention (older than max age in secs, beyond the
+        max newest runs), never the kept run nor anything but run-id-stamped directories, return the stale run ids
+    """
+    if not os.path.isdir(results_dir):
+        return []
+    run_ids = [name for name in os.listdir(results_dir)
+               if RESULTS_RUN_ID_PATTERN.match(name) and not os.path.islink(os.path.join(results_dir, name)) and
+               os.path.isdir(os.path.join(results_dir, name))]
+    # oldest first, runs started within the same second by suffix
+    run_ids.sort(key=lambda run_id: (run_id[:15], int(run_id[16:] or 1)))
+    stale_run_ids = set(run_ids[:-max_runs]) if max_runs is not None else set()
+    if max_age is not None:
+        now = datetime.now()
+        stale_run_ids.update(run_id for run_id in run_ids
+                             if (now - datetime.strptime(run_id[:15], RESULTS_RUN_ID_FORMAT)).total_seconds() > max_age)
+    stale_run_ids.discard(keep_run_id)
+    for run_id in sorted(stale_run_ids):
+        if not dry_run:
+            shutil.rmtree(os.path.join(results_dir, run_id))
+    return sorted(stale_run_ids)
+
+
+def link_latest_results(results_dir: str, run_id: str):
+    """ point the latest link of the results directory to the run """
+    latest_link = os.path.join(results_dir, RESULTS_LATEST_LINK)
+    if os.path.islink(latest_link):
+        os.remove(latest_link)
+    if not os.path.exists(latest_link):
+        os.symlink(run_id, latest_link)
+
+
+class RateLimiter:
+    """ Token bucket limiting the rate of the requests to the reference endpoint (e.g. external provider), backing off
+        exponentially when rate limited anyway (HTTP 429) and accounting the throttled time
+    """
+
+    def __init__(self, rate: float, burst: int):
+        """ Create a new RateLimiter of rate requests per sec with bursts up to burst requests """
+        self.rate = rate
+        self.burst = burst
+        self.tokens = float(burst)
+        self.last_time = time.monotonic()
+        self.lock = threading.Lock()
+        self.throttled_time = 0.0
+        self.rate_limited_requests = 0
+
+    def acquire(self):
+        """ take one token, waiting for it if the bucket is empty """
+        with self.lock:
+            now = time.monotonic()
+            self.tokens = min(self.burst, self.tokens + (now - self.last_time) * self.rate) - 1
+            self.last_time = now
+            wait_time = -self.tokens / self.rate if self.tokens < 0 else 0
+            self.throttled_time = self.throttled_time + wait_time
+        if wait_time > 0:
+            time.sleep(wait_time)
+
+    def back_off(self, attempt: int):
+        """ wait after the rate limited request before the attempt-th retry """
+        delay = min(REFERENCE_BACKOFF_BASE * 2 ** attempt, REFERENCE_BACKOFF_MAX)
+        with self.lock:
+            self.throttled_time = self.throttled_time + delay
+            self.rate_limited_requests = self.rate_limited_requests + 1
+        time.sleep(delay)
+
+
+def parse_rate(rate: str):
+    """ parse request rate e.g. 10/s or 600/m into requests per sec, raise ValueError if invalid
+    """
+    requests, unit = rate.split("/")
+    if unit not in ("s", "m"):
+        raise ValueError(rate)
+    requests_per_sec = float(requests) / (60 if unit == "m" else 1)
+    if requests_per_sec <= 0:
+        raise ValueError(rate)
+    return requests_per_sec
+
+
+class ChaosInjector:
+    """ Network faults injected on the requests to the daemon under test (--chaos) to verify the robustness of the runner
+        and of the daemon: requests delayed, duplicated with the same id (the duplicate response must match) and
+        connections reset mid-response (the request is then sent again); the faults are reported apart from the tests
+    """
+
+    def __init__(self, drop: float, latency: float, jitter: float, dup: float):
+        """ Create a new ChaosInjector: drop and dup probabilities, latency and its jitter in secs """
+        self.drop = drop
+        self.latency = latency
+        self.jitter = jitter
+        self.dup = dup
+        self.random = random.Random()
+        self.lock = threading.Lock()
+        self.delayed_requests = 0
+        self.delay_time = 0.0
+        self.dropped_connections = 0
+        self.duplicated_requests = 0
+        self.duplicate_mismatches = 0
+
+    @classmethod
+    def parse(cls, spec: str):
+        """ parse the chaos spec e.g. drop=1%,latency=200ms±100ms,dup=0.1%, raise ValueError if invalid
+        """
+        faults = {"drop": 0.0, "latency": 0.0, "jitter": 0.0, "dup": 0.0}
+        for fault in spec.split(","):
+            name, _, value = fault.partition("=")
+            if name in ("drop", "dup") and value.endswith("%"):
+                faults[name] = float(value[:-1]) / 100
+            elif name == "latency":
+                delay, _, jitter = value.replace("+-", "±").partition("±")
+                faults["latency"] = parse_duration(delay)
+                faults["jitter"] = parse_duration(jitter) if jitter != "" else 0.0
+            else:
+                raise ValueError(fault)
+        return cls(faults["drop"], faults["latency"], faults["jitter"], faults["dup"])
 
-def is_testing_apis(api_name, requested_apis: str):
-    """ determine if api_name is in requested_apis
+    def inject(self, command: str):
+        """ inject the faults before sending the request: delay, connection reset mid-response, duplicate sent concurrently
+            (returned to be checked after the request, None if not duplicated)
+        """
+        if self.latency > 0:
+            delay = max(self.latency + self.random.uniform(-self.jitter, self.jitter), 0)
+            with self.lock:
+                self.delayed_requests = self.delayed_requests + 1
+                self.delay_time = self.delay_time + delay
+            time.sleep(delay)
+        if self.random.random() < self.drop:
+            with subprocess.Popen(shlex.split(command), stdout=subprocess.PIPE, stderr=subprocess.DEVNULL) as process:
+                # connection reset as soon as the response starts
+                process.stdout.read(1)
+                process.kill()
+            with self.lock:
+                self.dropped_connections = self.dropped_connections + 1
+        if self.random.random() >= self.dup:
+            return None
+        duplicate = {}
+
+        def send_duplicate():
+            duplicate["stdout"] = subprocess.run(shlex.split(command), stdout=subprocess.PIPE, stderr=subprocess.DEVNULL,
+                                                 universal_newlines=True, check=False).stdout
+        duplicate["thread"] = threading.Thread(target=send_duplicate)
+        duplicate["thread"].start()
+        return duplicate
+
+    def check_duplicate(self, duplicate, stdout: str):
+        """ wait the duplicate request, counting its response if it doesn't match the one of the request """
+        if duplicate is None:
+            return
+        duplicate["thread"].join()
+        try:
+            matching = parse_json_stream(duplicate["stdout"]) == parse_json_stream(stdout)
+        except json.decoder.JSONDecodeError:
+            matching = False
+        with self.lock:
+            self.duplicated_requests = self.duplicated_requests + 1
+            self.duplicate_mismatches = self.duplicate_mismatches + (0 if matching else 1)
+
+    def get_report(self):
+        """ return the counts of the injected faults and of their effects """
+        return {
+            "delayed_requests": self.delayed_requests,
+            "avg_delay": self.delay_time / self.delayed_requests if self.delayed_requests > 0 else 0.0,
+            "dropped_connections": self.dropped_connections,
+            "duplicated_requests": self.duplicated_requests,
+            "duplicate_mismatches": self.duplicate_mismatches,
+        }
+
+
+def parse_duration(duration: str):
+    """ parse duration e.g. 200ms or 1.5s into secs, raise ValueError if invalid
     """
-    if requested_apis == "":
-        return 1
-    tokenize_list = requested_apis.split(",")
-    for test in tokenize_list:
-        if test in api_name:
-            return 1
-    return 0
+    if duration.endswith("ms"):
+        return float(duration[:-2]) / 1000
+    if duration.endswith("s"):
+        return float(duration[:-1])
+    raise ValueError(duration)
 
-def is_big_json(test_name, net: str,):
-    """ determine if json is in the big list
+
+def run_curl_commands(commands, capture_stderr: bool, reference_limiter=None, chaos=None):
+    """ run the curl commands concurrently, return for each one the completed process and its round trip time in secs
+        the reference command (the second one) is rate limited by reference_limiter if any, the faults of chaos if any
+        are injected on the target command (the first one)
     """
-    test_full_name = net + "/" + test_name
-    for curr_test_name in tests_with_big_json:
-        if curr_test_name == test_full_name:
-            return 1
-    return 0
+    results = [None] * len(commands)
 
+    def run_curl_command(index: int):
+        limiter = reference_limiter if index == 1 else None
+        duplicate = chaos.inject(commands[index]) if chaos is not None and index == 0 else None
+        attempt = 0
+        while True:
+            if limiter is not None:
+                limiter.acquire()
+            start_time = time.time()
+            process = subprocess.run(shlex.split(commands[index]), stdout=subprocess.PIPE,
+                                     stderr=subprocess.PIPE if capture_stderr or limiter is not None else None,
+                                     universal_newlines=True, check=False)
+            if limiter is None or not process.stderr.strip().endswith("429") or attempt == REFERENCE_MAX_RETRIES:
+                break
+            limiter.back_off(attempt)
+            attempt = attempt + 1
+        results[index] = (process, time.time() - start_time)
+        if duplicate is not None:
+            chaos.check_duplicate(duplicate, process.stdout)
 
-def is_not_compared_result(test_name, net: str):
-    """ determine if test not compared result
+    threads = [threading.Thread(target=run_curl_command, args=(index,)) for index in range(1, len(commands))]
+    for thread in threads:
+        thread.start()
+    run_curl_command(0)
+    for thread in threads:
+        thread.join()
+    return results
+
+
+class ResponseAlternatives(list):
+    """ Acceptable alternatives of the expected response (e.g. empty list or null across daemon versions): the test passes
+        if the response matches any of them. In test files the response is an array of alternatives, i.e. array for single
+        request or array of arrays for batch request
     """
-    test_full_name = net + "/" + test_name
-    for curr_test_name in tests_not_compared_result:
-        if curr_test_name == test_full_name:
-            return 1
-    return 0
 
-def is_not_compared_message(test_name, net: str):
-    """ determine if test not compared result
+    @classmethod
+    def get(cls, request, response):
+        """ return the expected response as alternatives if declared as such, unchanged otherwise """
+        if isinstance(response, list) and len(response) > 0 and \
+                (isinstance(request, dict) or all(isinstance(alternative, list) for alternative in response)):
+            return cls(response)
+        return response
+
+
+def align_for_comparison(config, response, expected_response, method: str):
+    """ return the response and the expected response aligned as configured before being compared (batch order, unordered
+        results, normalization, client specific fields, numeric equivalence, error message and data, result of the
+        errors-only namespaces)
     """
-    test_full_name = net + "/" + test_name
-    for curr_test_name in tests_not_compared_message:
-        if curr_test_name == test_full_name:
-            return 1
-    return 0
+    response = align_batch_response(response, expected_response)
+    response = sort_unordered_result(response, method)
+    expected_response = sort_unordered_result(expected_response, method)
+    if config.normalize:
+        response = normalize_response(response, method)
+        expected_response = normalize_response(expected_response, method)
+    client_fields = client_profiles.get(config.reference_client, {}).get("ignored_fields", {}).get(method)
+    if client_fields is not None:
+        response = drop_client_fields(response, client_fields)
+        expected_response = drop_client_fields(expected_response, client_fields)
+    numeric_paths = config.numeric_equivalence.get(method, []) + config.numeric_equivalence.get(NUMERIC_EQUIVALENCE_ALL, [])
+    if numeric_paths:
+        response = align_numbers(response, expected_response, numeric_paths)
+    if config.error_message_mode != ERROR_MESSAGE_EXACT or config.ignore_error_data:
+        response = align_error(response, expected_response, config.error_message_mode, config.ignore_error_data)
+    if get_comparison_policy(config, method) == COMPARISON_ERRORS_ONLY:
+        response = align_result(response, expected_response)
+    return response, expected_response
 
-def is_message_to_be_converted(test_name, net: str):
-    """ determine if test not compared result
+
+def select_alternative(config, response, alternatives, method: str):
+    """ return the alternative of the expected response matching the response, the first one if none (compared then
+        as the expected response)
     """
-    test_full_name = net + "/" + test_name
-    for curr_test_name in tests_message_lower_case:
-        if curr_test_name == test_full_name:
-            return 1
-    return 0
+    for alternative in alternatives:
+        aligned_response, aligned_alternative = align_for_comparison(config, response, alternative, method)
+        if aligned_response == aligned_alternative:
+            return alternative
+    return alternatives[0]
 
 
-def run_shell_command(net: str, command: str, command1: str, expected_response: str, verbose_level: int, exit_on_fail: bool,
-                      output_dir: str, silk_file: str,
-                      exp_rsp_file: str, diff_file: str, dump_output, json_file: str, test_number):
+def run_shell_command(config, command: str, command1: str, expected_response: str, output_dir: str, silk_file: str,
+                      exp_rsp_file: str, diff_file: str, json_file: str, test_number, id_map, method: str, expectations):
     """ Run the specified command as shell. If exact result or error don't care, they are null but present in expected_response. """
 
-    command_and_args = shlex.split(command)
-    process = subprocess.run(command_and_args, stdout=subprocess.PIPE, universal_newlines=True, check=True)
-    if process.returncode != 0:
-        sys.exit(process.returncode)
+    # target and reference (if any) requested concurrently
+    trace_phase(config, "send")
+    processes = run_curl_commands([command, command1] if command1 != "" else [command], True, config.reference_limiter,
+                                  config.chaos)
+    trace_phase(config, "compare")
+    for endpoint, (process, round_trip_time) in zip(("target", "reference"), processes):
+        if process.returncode != 0:
+            return report_phase_failure(config, json_file, test_number, endpoint + " down", "curl exit code " + str(process.returncode),
+                                        FAILURE_TIMEOUT if process.returncode == CURL_TIMEOUT_EXIT_CODE else FAILURE_TRANSPORT)
+        config.endpoint_round_trip_times.setdefault(endpoint, []).append(round_trip_time)
+    process = processes[0][0]
+    config.test_metrics["round_trip_time"] = processes[0][1]
+    config.test_metrics["response_bytes"] = len(process.stdout.encode())
+    http_status = get_http_status(process.stderr)
+    if config.byte_metrics is not None:
+        config.byte_metrics.record(json_file, process.stderr, config.test_metrics["response_bytes"])
+    if config.connection_metrics is not None:
+        config.connection_metrics.record(json_file, process.stderr)
     process.stdout = process.stdout.strip('\n')
-    if verbose_level > 1:
+    if config.verbose_level > 1:
         print(process.stdout)
-    response = json.loads(process.stdout)
+    try:
+        parse_start_time = time.time()
+        response = RequestRules.restore_ids(parse_json_stream(process.stdout), id_map)
+        config.parse_time = config.parse_time + time.time() - parse_start_time
+        if config.record_fixtures is not None:
+            config.record_fixtures.record(json_file, response)
+    except json.decoder.JSONDecodeError:
+        tag = tag_failure(config, FAILURE_INVALID_ENVELOPE, http_status)
+        if config.verbose_level:
+            print("Failed (bad json format on rsp)" + tag)
+            print(process.stdout)
+            return 1
+        file = json_file.ljust(60)
+        print(f"{test_number:03d}. {file} Failed (bad json format on rsp)" + tag)
+        if config.exit_on_fail:
+            print("TEST ABORTED!")
+            sys.exit(1)
+        return 1
     if command1 != "":
-        command_and_args = shlex.split(command1)
-        process = subprocess.run(command_and_args, stdout=subprocess.PIPE, universal_newlines=True, check=True)
-        if process.returncode != 0:
-            sys.exit(process.returncode)
+        process = processes[1][0]
         process.stdout = process.stdout.strip('\n')
         try:
-            expected_response = json.loads(process.stdout)
+            parse_start_time = time.time()
+            expected_response = RequestRules.restore_ids(parse_json_stream(process.stdout), id_map)
+            config.parse_time = config.parse_time + time.time() - parse_start_time
         except json.decoder.JSONDecodeError:
-            if verbose_level:
-                print("Failed (bad json format on expected rsp)")
+            tag = tag_failure(config, FAILURE_INVALID_ENVELOPE)
+            if config.verbose_level:
+                print("Failed (bad json format on expected rsp)" + tag)
                 print(process.stdout)
                 return 1
             file = json_file.ljust(60)
-            print(f"{test_number:03d}. {file} Failed (bad json format on expected rsp)")
-            if exit_on_fail:
+            print(f"{test_number:03d}. {file} Failed (bad json format on expected rsp)" + tag)
+            if config.exit_on_fail:
+                print("TEST ABORTED!")
+                sys.exit(1)
+            return 1
+
+    if isinstance(expected_response, ResponseAlternatives):
+        expected_response = select_alternative(config, response, expected_response, method)
+
+    if expectations:
+        failed_expectation = check_expectations(response, expectations)
+        if failed_expectation != "":
+            tag = tag_failure(config, FAILURE_RESULT if is_valid_envelope(response) else FAILURE_INVALID_ENVELOPE, http_status)
+            if config.verbose_level:
+                print(f"Failed (expect {failed_expectation})" + tag)
+            else:
+                file = json_file.ljust(60)
+                print(f"{test_number:03d}. {file} Failed (expect {failed_expectation})" + tag)
+            if config.exit_on_fail:
                 print("TEST ABORTED!")
                 sys.exit(1)
             return 1
+        if expected_response is None:
+            # assertions only, no golden response to compare with
+            if config.verbose_level:
+                print("OK")
+            return 0
 
+    response, expected_response = align_for_comparison(config, response, expected_response, method)
     if response != expected_response:
         if "result" in response and "result" in expected_response and expected_response["result"] is None:
             # response and expected_response are different but don't care
-            if verbose_level:
+            if config.verbose_level:
                 print("OK")
-            if dump_output:
+            if config.dump_output:
                 if silk_file != "" and os.path.exists(output_dir) == 0:
                     os.mkdir(output_dir)
                 if silk_file != "":
@@ -320,9 +2402,9 @@ def run_shell_command(net: str, command: str, command1: str, expected_response:
             return 0
         if "error" in response and "error" in expected_response and expected_response["error"] is None:
             # response and expected_response are different but don't care
-            if verbose_level:
+            if config.verbose_level:
                 print("OK")
-            if dump_output:
+            if config.dump_output:
                 if silk_file != "" and os.path.exists(output_dir) == 0:
                     os.mkdir(output_dir)
                 if silk_file != "":
@@ -334,9 +2416,9 @@ def run_shell_command(net: str, command: str, command1: str, expected_response:
             return 0
         if "error" not in expected_response and "result" not in expected_response:
             # response and expected_response are different but don't care
-            if verbose_level:
+            if config.verbose_level:
                 print("OK")
-            if dump_output:
+            if config.dump_output:
                 if silk_file != "" and os.path.exists(output_dir) == 0:
                     os.mkdir(output_dir)
                 if silk_file != "":
@@ -346,74 +2428,109 @@ def run_shell_command(net: str, command: str, command1: str, expected_response:
                     with open(exp_rsp_file, 'w', encoding='utf8') as json_file_ptr:
                         json_file_ptr.write(json.dumps(expected_response, indent=5, sort_keys=True))
             return 0
-        if silk_file != "" and os.path.exists(output_dir) == 0:
-            os.mkdir(output_dir)
-        if silk_file != "":
-            with open(silk_file, 'w', encoding='utf8') as json_file_ptr:
-                json_file_ptr.write(json.dumps(response, indent=5, sort_keys=True))
-        if exp_rsp_file != "":
-            with open(exp_rsp_file, 'w', encoding='utf8') as json_file_ptr:
-                json_file_ptr.write(json.dumps(expected_response, indent=5, sort_keys=True))
+        # compared in scratch files, moved into the output dir only if the test fails and its artifacts are kept
+        scratch_prefix = "/tmp/" + str(os.getpid()) + "-"
+        scratch_silk_file = scratch_prefix + os.path.basename(silk_file)
+        scratch_exp_rsp_file = scratch_prefix + os.path.basename(exp_rsp_file)
+        scratch_diff_file = scratch_prefix + os.path.basename(diff_file)
 
-        temp_file1 = "/tmp/silk_lower_case"
-        temp_file2 = "/tmp/rpc_lower_case"
+        temp_file1 = scratch_prefix + "silk_lower_case"
+        temp_file2 = scratch_prefix + "rpc_lower_case"
 
-        if "error" in response:
-            to_lower_case(exp_rsp_file, temp_file2)
-            to_lower_case(silk_file, temp_file1)
-        else:
-            cmd = "cp " +  silk_file  + " " + temp_file1
-            os.system(cmd)
-            cmd = "cp " +  exp_rsp_file  + " " + temp_file2
-            os.system(cmd)
-
-        if is_not_compared_result(json_file, net):
-            removed_line_string = "error"
-            replace_str_from_file(exp_rsp_file, temp_file1, removed_line_string)
-            replace_str_from_file(silk_file, temp_file2, removed_line_string)
-            cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + diff_file
-        elif is_not_compared_message(json_file, net):
-            removed_line_string = "message"
-            replace_message(exp_rsp_file, temp_file1, removed_line_string)
-            replace_message(silk_file, temp_file2, removed_line_string)
-            cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + diff_file
-        elif is_message_to_be_converted(json_file, net):
-            modified_string = "message"
-            modified_str_from_file(exp_rsp_file, temp_file1, modified_string)
-            modified_str_from_file(silk_file, temp_file2, modified_string)
-            cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + diff_file
-        elif is_big_json(json_file, net):
-            cmd = "json-patch-jsondiff --indent 4 " + temp_file2 + " " + temp_file1 + " > " + diff_file
-        else:
-            cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + diff_file
-        os.system(cmd)
-        diff_file_size = os.stat(diff_file).st_size
+        diff_tool = get_external_diff_tool(json_file, config.net)
+        diff_summary = None
+        if config.diff_strategy == DIFF_STRATEGY_AUTO and "error" not in response and not has_text_normalization(json_file, config.net):
+            diff_start_time = time.time()
+            diff_found = get_sorted_primitives(response) != get_sorted_primitives(expected_response)
+            if diff_found and config.max_diff_entries > 0:
+                diff_summary = get_diff_summary(expected_response, response, config.max_diff_entries)
+            record_diff_time(config, DIFF_TOOL_PYTHON, time.time() - diff_start_time)
+            # the outcome is decided, escalated to the external tool only to write the diff artifact kept
+            if not diff_found or config.keep_artifacts == KEEP_ARTIFACTS_NONE or is_diff_summarized(config, diff_summary):
+                diff_tool = DIFF_TOOL_PYTHON
+                with open(scratch_diff_file, 'w', encoding='utf8') as json_file_ptr:
+                    json_file_ptr.write(json.dumps(diff_summary if diff_summary is not None else {}, indent=4) if diff_found else "")
+
+        if diff_tool != DIFF_TOOL_PYTHON:
+            diff_start_time = time.time()
+            write_scratch_responses(response, expected_response, scratch_silk_file, scratch_exp_rsp_file)
+            if "error" in response:
+                to_lower_case(scratch_exp_rsp_file, temp_file2)
+                to_lower_case(scratch_silk_file, temp_file1)
+            else:
+                cmd = "cp " +  scratch_silk_file  + " " + temp_file1
+                run_system_command(cmd)
+                cmd = "cp " +  scratch_exp_rsp_file  + " " + temp_file2
+                run_system_command(cmd)
+
+            if is_not_compared_result(json_file, config.net):
+                removed_line_string = "error"
+                replace_str_from_file(scratch_exp_rsp_file, temp_file1, removed_line_string)
+                replace_str_from_file(scratch_silk_file, temp_file2, removed_line_string)
+                cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + scratch_diff_file
+            elif is_not_compared_message(json_file, config.net):
+                removed_line_string = "message"
+                replace_message(scratch_exp_rsp_file, temp_file1, removed_line_string)
+                replace_message(scratch_silk_file, temp_file2, removed_line_string)
+                cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + scratch_diff_file
+            elif is_message_to_be_converted(json_file, config.net):
+                modified_string = "message"
+                modified_str_from_file(scratch_exp_rsp_file, temp_file1, modified_string)
+                modified_str_from_file(scratch_silk_file, temp_file2, modified_string)
+                cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + scratch_diff_file
+            elif is_big_json(json_file, config.net):
+                cmd = "json-patch-jsondiff --indent 4 " + temp_file2 + " " + temp_file1 + " > " + scratch_diff_file
+            else:
+                cmd = "json-diff -s " + temp_file2 + " " + temp_file1 + " > " + scratch_diff_file
+            run_system_command(cmd)
+            record_diff_time(config, diff_tool, time.time() - diff_start_time)
+        diff_file_size = os.stat(scratch_diff_file).st_size
         if diff_file_size != 0:
-            if verbose_level:
-                print("Failed")
+            reason = ""
+            if config.max_diff_entries > 0:
+                summary = diff_summary if diff_summary is not None else get_diff_summary(expected_response, response,
+                                                                                         config.max_diff_entries)
+                entries = summary["additions"] + summary["deletions"] + summary["changes"]
+                reason = f" ({summary['additions']} additions, {summary['deletions']} deletions, {summary['changes']} changes" + \
+                         (f", first divergence at {summary['first_divergence']})" if summary["first_divergence"] is not None else ")")
+                if entries > config.max_diff_entries and not config.full_diff:
+                    # the summary with truncated sample replaces the enormous diff
+                    with open(scratch_diff_file, 'w', encoding='utf8') as json_file_ptr:
+                        json_file_ptr.write(json.dumps(summary, indent=4))
+            trace_phase(config, "dump")
+            if config.keep_artifacts != KEEP_ARTIFACTS_NONE and diff_tool == DIFF_TOOL_PYTHON:
+                write_scratch_responses(response, expected_response, scratch_silk_file, scratch_exp_rsp_file)
+            keep_artifacts(config, output_dir, [(scratch_silk_file, silk_file), (scratch_exp_rsp_file, exp_rsp_file),
+                                                (scratch_diff_file, diff_file)])
+            for temp_file in (temp_file1, temp_file2):
+                if os.path.exists(temp_file):
+                    os.remove(temp_file)
+            reason = reason + tag_failure(config, classify_mismatch(response, expected_response), http_status)
+            if config.verbose_level:
+                print("Failed" + reason)
             else:
                 file = json_file.ljust(60)
-                print(f"{test_number:03d}. {file} Failed")
-            if exit_on_fail:
+                print(f"{test_number:03d}. {file} Failed" + reason)
+            if config.exit_on_fail:
                 print("TEST ABORTED!")
                 sys.exit(1)
             return 1
-        if verbose_level:
+        if config.verbose_level:
             print("OK")
         if os.path.exists(temp_file1):
             os.remove(temp_file1)
         if os.path.exists(temp_file2):
             os.remove(temp_file2)
-        os.remove(silk_file)
-        os.remove(exp_rsp_file)
-        os.remove(diff_file)
-        if not os.listdir(output_dir):
-            os.rmdir(output_dir)
+        if diff_tool != DIFF_TOOL_PYTHON:
+            os.remove(scratch_silk_file)
+            os.remove(scratch_exp_rsp_file)
+        os.remove(scratch_diff_file)
     else:
-        if verbose_level:
+        if config.verbose_level:
             print("OK")
 
-    if dump_output:
+    if config.dump_output:
+        trace_phase(config, "dump")
         if silk_file != "" and os.path.exists(output_dir) == 0:
             os.mkdir(output_dir)
         if silk_file != "":
@@ -425,83 +2542,936 @@ def run_shell_command(net: str, command: str, command1: str, expected_response:
     return 0
 
 
-def run_tests(net: str, test_dir: str, output_dir: str, json_file: str, verbose_level: int, daemon_under_test: str, exit_on_fail: bool,
-              verify_with_daemon: bool, daemon_as_reference: str,
-              dump_output: bool, test_number, infura_url: str, daemon_on_host: str, daemon_on_port: int,
-              jwt_secret: str):
-    """ Run integration tests. """
-    json_filename = test_dir + json_file
-    ext = os.path.splitext(json_file)[1]
-
-    if ext in (".zip", ".tar"):
-        with tarfile.open(json_filename, encoding='utf-8') as tar:
+def read_test_file(json_filename: str):
+    """ return the JSON content of the test file, archived or not
+    """
+    ext = os.path.splitext(json_filename)[1]
+    if ext == ".zst":
+        buff = extract_zstd_tar(json_filename)
+        if buff is None:
+            print("bad archive file " + json_filename)
+            sys.exit(EXIT_CONFIG_ERROR)
+        return buff
+    if ext in (".zip", ".tar", ".gz"):
+        tar = tarfile.open(json_filename, encoding='utf-8')
+        with tar:
             files = tar.getmembers()
             if len(files) != 1:
                 print("bad archive file " + json_filename)
-                sys.exit(1)
+                sys.exit(EXIT_CONFIG_ERROR)
             file = tar.extractfile(files[0])
             buff = file.read()
             tar.close()
-            jsonrpc_commands = json.loads(buff)
-    elif ext in (".gzip"):
+            return buff
+    if ext in (".gzip"):
         with gzip.open(json_filename, 'rb') as zipped_file:
-            buff = zipped_file.read()
-            jsonrpc_commands = json.loads(buff)
+            return zipped_file.read()
+    with open(json_filename, 'rb') as json_file_ptr:
+        return json_file_ptr.read()
+
+
+class GoldenStore:
+    """ Content-addressed store of expected responses and of their sub-objects, shared by the tests of all the chains:
+        test files (and blobs) reference a blob by the SHA-256 of its canonical JSON as {"$golden": "<hash>"}.
+        Each blob is parsed at most once and shared by all its references, so resolved objects are never modified.
+    """
+
+    def __init__(self, directory: str):
+        """ Create a new GoldenStore on the blobs directory """
+        self.directory = directory
+        self.blobs = {}
+
+    @staticmethod
+    def get_hash(value):
+        """ return the hash of the canonical JSON of the value """
+        return hashlib.sha256(json.dumps(value, sort_keys=True, separators=(",", ":")).encode()).hexdigest()
+
+    @staticmethod
+    def is_reference(value):
+        """ return True if the value is a reference to a blob """
+        return isinstance(value, dict) and len(value) == 1 and isinstance(value.get(GOLDEN_REFERENCE), str)
+
+    def get_blob_filename(self, blob_hash: str):
+        """ return the file of the blob, in a subdirectory named after the first two hex digits """
+        return os.path.join(self.directory, blob_hash[:2], blob_hash + ".json")
+
+    def get(self, blob_hash: str):
+        """ return the resolved value of the blob, loaded at most once """
+        if blob_hash not in self.blobs:
+            try:
+                with open(self.get_blob_filename(blob_hash), 'rb') as blob_file:
+                    self.blobs[blob_hash] = self.resolve(json.load(blob_file))
+            except FileNotFoundError:
+                print("golden blob not found: " + self.get_blob_filename(blob_hash))
+                sys.exit(EXIT_CONFIG_ERROR)
+        return self.blobs[blob_hash]
+
+    def resolve(self, value):
+        """ return the value replacing the blob references with the blob values """
+        if self.is_reference(value):
+            return self.get(value[GOLDEN_REFERENCE])
+        if isinstance(value, dict):
+            return {key: self.resolve(item) for key, item in value.items()}
+        if isinstance(value, list):
+            return [self.resolve(item) for item in value]
+        return value
+
+    def add(self, value):
+        """ write the value as blob if not yet stored, return its reference """
+        blob_hash = self.get_hash(value)
+        blob_filename = self.get_blob_filename(blob_hash)
+        if not os.path.exists(blob_filename):
+            os.makedirs(os.path.dirname(blob_filename), exist_ok=True)
+            with open(blob_filename, 'w', encoding='utf8') as blob_file:
+                blob_file.write(json.dumps(value, sort_keys=True, separators=(",", ":")))
+        return {GOLDEN_REFERENCE: blob_hash}
+
+
+def load_test_file(json_filename: str, golden_store=None):
+    """ return the list of JSON RPC commands (request, response) of the test file, archived or not, the golden references
+        resolved from golden_store if any (the default store otherwise)
+    """
+    buff = read_test_file(json_filename)
+    jsonrpc_commands = json.loads(buff)
+    if b'"' + GOLDEN_REFERENCE.encode() + b'"' in buff:
+        jsonrpc_commands = (golden_store or GoldenStore(DEFAULT_GOLDEN_STORE_DIR)).resolve(jsonrpc_commands)
+    return jsonrpc_commands
+
+
+class GoldenCache:
+    """ Parsed test files shared by the loop iterations, keyed by path, least recently used evicted beyond max size.
+        The last loaded file is kept anyway, so that the test selection (--method-filter) and run parse it once.
+        Cached commands are never modified: requests are rewritten into copies and responses compared as copies.
+        The golden references are resolved from the golden store, whose blobs are shared by all the test files.
+    """
+
+    def __init__(self, max_size: int, golden_store):
+        """ Create a new GoldenCache of max_size bytes of JSON content """
+        self.max_size = max_size
+        self.golden_store = golden_store
+        self.entries = {}
+        self.size = 0
+        self.last = ("", None)
+
+    def load(self, json_filename: str):
+        """ return the list of JSON RPC commands of the test file, parsed at most once while cached """
+        if json_filename in self.entries:
+            entry = self.entries.pop(json_filename)
+            self.entries[json_filename] = entry
+            return entry[0]
+        if self.last[0] == json_filename:
+            return self.last[1]
+        self.last = ("", None)
+        buff = read_test_file(json_filename)
+        size = len(buff)
+        jsonrpc_commands = json.loads(buff)
+        if b'"' + GOLDEN_REFERENCE.encode() + b'"' in buff:
+            jsonrpc_commands = self.golden_store.resolve(jsonrpc_commands)
+        del buff
+        if size <= self.max_size:
+            while self.size + size > self.max_size:
+                _, evicted_size = self.entries.pop(next(iter(self.entries)))
+                self.size = self.size - evicted_size
+            self.entries[json_filename] = (jsonrpc_commands, size)
+            self.size = self.size + size
+        else:
+            self.last = (json_filename, jsonrpc_commands)
+        return jsonrpc_commands
+
+
+def substitute_params(template, params):
+    """ return the request template with the ${name} placeholders replaced by the case parameters, as JSON value
+        if the placeholder is the whole string otherwise as text
+    """
+    if isinstance(template, dict):
+        return {key: substitute_params(value, params) for key, value in template.items()}
+    if isinstance(template, list):
+        return [substitute_params(item, params) for item in template]
+    if isinstance(template, str):
+        if template.startswith("${") and template.endswith("}") and template[2:-1] in params:
+            return params[template[2:-1]]
+        for name, value in params.items():
+            template = template.replace("${" + name + "}", value if isinstance(value, str) else json.dumps(value))
+    return template
+
+
+def get_case_command(json_rpc, case):
+    """ return the JSON RPC command of the case of parametrized command i.e. request template and array of cases
+        each one having parameters, expected response and optionally its own test assertions
+    """
+    command = {"request": substitute_params(json_rpc["request"], case.get("params", {}))}
+    if "response" in case:
+        command["response"] = case["response"]
+    if "test" in case or "test" in json_rpc:
+        command["test"] = case.get("test", json_rpc.get("test"))
+    return command
+
+
+def load_test_commands(config, test_file: str):
+    """ return the list of JSON RPC commands of the test, expanding the case if subtest of parametrized test
+    """
+    file_name, case = get_test_case(test_file)
+    jsonrpc_commands = config.golden_cache.load(config.json_dir + file_name)
+    if case is None:
+        return jsonrpc_commands
+    return [get_case_command(json_rpc, json_rpc["cases"][case - 1]) for json_rpc in jsonrpc_commands]
+
+
+def expand_test_cases(test_dir: str, test_lists):
+    """ return the test names replacing each parametrized test (i.e. JSON test file having cases) with its numbered
+        subtests (e.g. test_01.json#1, test_01.json#2, ...)
+    """
+    test_names = []
+    for test_name in test_lists:
+        cases = 0
+        if test_name.endswith(".json"):
+            with open(test_dir + "/" + test_name, 'rb') as json_file_ptr:
+                buff = json_file_ptr.read()
+            if b'"cases"' in buff:
+                jsonrpc_commands = json.loads(buff)
+                if isinstance(jsonrpc_commands, list) and len(jsonrpc_commands) > 0 and isinstance(jsonrpc_commands[0], dict):
+                    cases = len(jsonrpc_commands[0].get("cases", []))
+        if cases == 0:
+            test_names.append(test_name)
+        for case in range(1, cases + 1):
+            test_names.append(test_name + CASE_SEPARATOR + str(case))
+    return test_names
+
+
+def get_test_catalog(config):
+    """ return the tests of the chain as list of API directory and test names, walking the directories and expanding
+        the parametrized tests once for all the loops
+    """
+    test_catalog = []
+    for api_file in sorted(os.listdir(config.json_dir)):
+        # jump result_dir
+        if api_file == config.results_dir:
+            continue
+        test_dir = config.json_dir + api_file
+        test_catalog.append((api_file, expand_test_cases(test_dir, sorted(os.listdir(test_dir)))))
+    return test_catalog
+
+
+def get_test_dependencies(config, test_catalog):
+    """ return the dependencies of the tests (test -> tests), resolved from the addresses listed in their metadata
+        ("dependsOn" in test) as path with or without extension, all the cases of the parametrized test file if its path
+    """
+    tests_by_address = {}
+    for api_file, test_lists in test_catalog:
+        for test_name in test_lists:
+            test_file = api_file + "/" + test_name
+            file_name = get_test_case(test_file)[0]
+            for address in {test_file, file_name, file_name.split(".")[0]}:
+                tests_by_address.setdefault(address, []).append(test_file)
+    dependencies = {}
+    for api_file, test_lists in test_catalog:
+        for test_name in test_lists:
+            test_file = api_file + "/" + test_name
+            if not get_test_case(test_file)[0].endswith(".json"):
+                continue
+            with open(config.json_dir + get_test_case(test_file)[0], 'rb') as json_file_ptr:
+                if b'"dependsOn"' not in json_file_ptr.read():
+                    continue
+            for json_rpc in load_test_commands(config, test_file):
+                for address in json_rpc.get("test", {}).get("dependsOn", []):
+                    if address not in tests_by_address:
+                        print("unknown dependency of " + test_file + ": " + address)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    dependencies.setdefault(test_file, []).extend(dependency for dependency in tests_by_address[address]
+                                                                  if dependency not in dependencies.get(test_file, []))
+    return dependencies
+
+
+def get_test_schedule(test_catalog, dependencies):
+    """ return the tests of the catalog in run order, each dependency before the tests depending on it and the others in
+        catalog order, as list of API directory and test names (consecutive tests of the same API) with their global test
+        number and test number within the API in the catalog
+    """
+    numbers = {}
+    global_test_number = 1
+    for api_file, test_lists in test_catalog:
+        for test_number, test_name in enumerate(test_lists, 1):
+            numbers[api_file + "/" + test_name] = (api_file, test_name, global_test_number, test_number)
+            global_test_number = global_test_number + 1
+    scheduled = []
+    visiting = []
+
+    def schedule(test_file):
+        if test_file in scheduled:
+            return
+        if test_file in visiting:
+            print("dependency cycle: " + " -> ".join(visiting[visiting.index(test_file):] + [test_file]))
+            sys.exit(EXIT_CONFIG_ERROR)
+        visiting.append(test_file)
+        for dependency in dependencies.get(test_file, []):
+            schedule(dependency)
+        visiting.pop()
+        scheduled.append(test_file)
+
+    for test_file in numbers:
+        schedule(test_file)
+    test_schedule = []
+    for test_file in scheduled:
+        api_file, test_name, global_test_number, test_number = numbers[test_file]
+        if len(test_schedule) == 0 or test_schedule[-1][0] != api_file:
+            test_schedule.append((api_file, []))
+        test_schedule[-1][1].append((test_name, global_test_number, test_number))
+    return test_schedule
+
+
+def get_output_base_name(json_file: str):
+    """ return the base name of the output files of the test, distinct for each subtest of parametrized test
+    """
+    case = get_test_case(json_file)[1]
+    return get_archive_base_name(json_file)[:-4] + ("" if case is None else str(case) + ".")
+
+
+def send_request(config, request):
+    """ send the request to the daemon under test, return the JSON response or None if invalid
+    """
+    method = request.get("method", "") if isinstance(request, dict) else ""
+    target = config.scheme + get_target(config.daemon_under_test, method, config.infura_url, config.daemon_on_host,
+                                        config.daemon_on_port)
+    cmd = get_curl_command(config, get_jwt_auth(config.jwt_secret), ''' --data-binary @- ''', target)
+    process = subprocess.run(shlex.split(cmd), input=json.dumps(request), stdout=subprocess.PIPE, universal_newlines=True,
+                             check=False)
+    try:
+        return parse_json_stream(process.stdout)
+    except json.decoder.JSONDecodeError:
+        return None
+
+
+def run_phase(config, steps, variables):
+    """ send the requests of the setup or teardown phase checking their assertions (expect) and saving into variables
+        the response values selected by path (e.g. "save": {"tx_hash": "result"}), return the error or empty string
+    """
+    for step in steps:
+        request = substitute_params(step["request"], variables)
+        response = send_request(config, request)
+        if response is None:
+            return "bad json format on rsp of " + str(request.get("method"))
+        failed_expectation = check_expectations(response, substitute_params(step.get("expect", []), variables))
+        if failed_expectation != "":
+            return str(request.get("method")) + " " + failed_expectation
+        for name, path in step.get("save", {}).items():
+            try:
+                variables[name] = get_json_path(response, path)
+            except KeyError:
+                return str(request.get("method")) + " " + path + " missing"
+    return ""
+
+
+def wait_condition(config, wait, variables):
+    """ poll with the wait request until its response satisfies the assertions (until) or the timeout expires,
+        return the error or empty string
+    """
+    request = substitute_params(wait["request"], variables)
+    until = substitute_params(wait.get("until", []), variables)
+    deadline = time.time() + wait.get("timeout", DEFAULT_WAIT_TIMEOUT)
+    while True:
+        response = send_request(config, request)
+        if response is not None and check_expectations(response, until) == "":
+            return ""
+        if time.time() >= deadline:
+            return "timeout waiting " + str(request.get("method"))
+        time.sleep(WAIT_POLL_INTERVAL)
+
+
+def report_phase_failure(config, json_file: str, test_number, phase: str, error: str, failure_class: str = FAILURE_PIPELINE):
+    """ print the failure of the setup, wait or teardown phase of the test (or of the transport)
+    """
+    tag = tag_failure(config, failure_class)
+    if config.verbose_level:
+        print(f"Failed ({phase}: {error})" + tag)
     else:
-        with open(json_filename, encoding='utf8') as json_file_ptr:
-            jsonrpc_commands = json.load(json_file_ptr)
+        file = json_file.ljust(60)
+        print(f"{test_number:03d}. {file} Failed ({phase}: {error})" + tag)
+    if config.exit_on_fail:
+        print("TEST ABORTED!")
+        sys.exit(1)
+    return 1
+
+
+def get_transport(config):
+    """ return the transport of the requests to the daemon under test (e.g. https+gzip)
+    """
+    if config.transport == TRANSPORT_IPC:
+        return TRANSPORT_IPC
+    return ("https" if config.scheme == "https://" else "http") + ("+gzip" if config.gzip_request else "")
+
+
+def check_latency(config, json_file: str, test_number, max_latency_ms):
+    """ check the round trip time of the test request against the max latency of its metadata (maxLatencyMs), failing
+        or warning as configured if exceeded
+    """
+    latency_ms = config.endpoint_round_trip_times["target"][-1] * 1000
+    if latency_ms <= max_latency_ms:
+        return 0
+    if config.latency_mode == LATENCY_MODE_WARN:
+        file = json_file.ljust(60)
+        print(f"{test_number:03d}. {file} WARN (latency {latency_ms:.0f} ms, max {max_latency_ms} ms)")
+        return 0
+    return report_phase_failure(config, json_file, test_number, "latency", f"{latency_ms:.0f} ms, max {max_latency_ms} ms",
+                                FAILURE_LATENCY)
+
+
+def sample_latency(config, json_file: str, samples: int):
+    """ return the round trip times in secs of the requests of the test sent samples times, responses not compared, empty
+        if the requests depend on pipeline phases (setup, wait)
+    """
+    jsonrpc_commands = load_test_commands(config, json_file)
+    if any("setup" in json_rpc or "wait" in json_rpc for json_rpc in jsonrpc_commands):
+        return []
+    commands = []
     for json_rpc in jsonrpc_commands:
         request = json_rpc["request"]
-        try:
-            if isinstance(request, dict) == 1:
-                method = request["method"]
-            else:
-                method = request[0]["method"]
-        except KeyError:
-            method = ""
-        request_dumps = json.dumps(request)
-        target = get_target(daemon_under_test, method, infura_url, daemon_on_host, daemon_on_port)
-        if jwt_secret == "":
-            jwt_auth = ""
+        if config.fixtures is not None and not config.fixtures.head_matches:
+            request = pin_block_tags(request, config.fixtures.block_height)
+        if config.request_rules is not None:
+            request = config.request_rules.apply(request)[0]
+        target = config.scheme + get_target(config.daemon_under_test, get_request_method(request), config.infura_url,
+                                            config.daemon_on_host, config.daemon_on_port)
+        commands.append((get_curl_command(config, get_jwt_auth(config.jwt_secret), " --data-binary @- --output /dev/null ", target),
+                         json.dumps(request)))
+    durations = []
+    for _ in range(samples):
+        start_time = time.time()
+        for cmd, request_dumps in commands:
+            subprocess.run(shlex.split(cmd), input=request_dumps, stdout=subprocess.DEVNULL, universal_newlines=True, check=False)
+        durations.append(time.time() - start_time)
+    return durations
+
+
+def get_compression_problem(plain_body: bytes, output: bytes):
+    """ return the compression problem of the response (headers and body as dumped by curl) to the request accepting gzip
+        compared with the plain one: not compressed, unexpected encoding, gzip decoding error or decompressed body differing,
+        empty string if none
+    """
+    headers = b""
+    # header blocks of the interim responses (e.g. 100 Continue) before the final one
+    while output.startswith(b"HTTP/") and b"\r\n\r\n" in output:
+        headers, _, output = output.partition(b"\r\n\r\n")
+    content_encoding = ""
+    for header in headers.split(b"\r\n")[1:]:
+        name, _, value = header.partition(b":")
+        if name.strip().lower() == b"content-encoding":
+            content_encoding = value.strip().decode(errors="replace").lower()
+    if content_encoding == "":
+        return COMPRESSION_NOT_APPLIED if output == plain_body else COMPRESSION_CORRUPTED
+    if content_encoding != "gzip":
+        return COMPRESSION_UNEXPECTED_ENCODING
+    try:
+        return "" if gzip.decompress(output) == plain_body else COMPRESSION_CORRUPTED
+    except (OSError, EOFError):
+        return COMPRESSION_CORRUPTED
+
+
+def check_compression(config, json_file: str):
+    """ send the requests of the test without and with response compression (gzip, decoded here to check the actual
+        encoding), return the method and the compression problem of each request, empty if the requests depend on pipeline
+        phases (setup, wait)
+    """
+    jsonrpc_commands = load_test_commands(config, json_file)
+    if any("setup" in json_rpc or "wait" in json_rpc for json_rpc in jsonrpc_commands):
+        return {}
+    problems = []
+    for json_rpc in jsonrpc_commands:
+        request = json_rpc["request"]
+        if config.fixtures is not None and not config.fixtures.head_matches:
+            request = pin_block_tags(request, config.fixtures.block_height)
+        if config.request_rules is not None:
+            request = config.request_rules.apply(request)[0]
+        method = get_request_method(request) or "(no method)"
+        target = config.scheme + get_target(config.daemon_under_test, method, config.infura_url, config.daemon_on_host,
+                                            config.daemon_on_port)
+        # raw bodies, not decoded by curl even with --compressed-response
+        plain = subprocess.run(shlex.split(get_curl_command(config, get_jwt_auth(config.jwt_secret), " --data-binary @- ", target,
+                                                            " --no-compressed")),
+                               input=json.dumps(request).encode(), stdout=subprocess.PIPE, check=False)
+        compressed = subprocess.run(shlex.split(get_curl_command(config, get_jwt_auth(config.jwt_secret), " --data-binary @- ", target,
+                                                                 ' --no-compressed -H "Accept-Encoding: gzip" --dump-header - ')),
+                                    input=json.dumps(request).encode(), stdout=subprocess.PIPE, check=False)
+        if plain.returncode != 0 or compressed.returncode != 0:
+            problems.append((method, COMPRESSION_TRANSPORT))
         else:
-            byte_array_secret = bytes.fromhex(jwt_secret)
-            encoded = jwt.encode({"iat": datetime.now(pytz.utc)}, byte_array_secret, algorithm="HS256")
-            jwt_auth = "-H \"Authorization: Bearer " + str(encoded) + "\" "
-        if verify_with_daemon == 0:
-            cmd = '''curl --silent -X POST -H "Content-Type: application/json" ''' + jwt_auth + ''' --data \'''' + request_dumps + '''\' ''' + target
+            problems.append((method, get_compression_problem(plain.stdout, compressed.stdout)))
+    return problems
+
+
+def get_request_method(request):
+    """ return the method of the request, of the first request if batch, empty string if none
+    """
+    try:
+        if isinstance(request, dict) == 1:
+            return request["method"]
+        return request[0]["method"]
+    except (KeyError, IndexError):
+        return ""
+
+
+def run_tests(config, json_file: str, test_number):
+    """ Run integration tests. """
+    trace_phase(config, "load")
+    jsonrpc_commands = load_test_commands(config, json_file)
+    for json_rpc in jsonrpc_commands:
+        # pipeline phases: setup requests, wait condition, test request, teardown requests
+        variables = {}
+        if "setup" in json_rpc:
+            trace_phase(config, "setup")
+        error = run_phase(config, json_rpc.get("setup", []), variables)
+        if error != "":
+            return report_phase_failure(config, json_file, test_number, "setup", error)
+        if "wait" in json_rpc:
+            trace_phase(config, "wait")
+            error = wait_condition(config, json_rpc["wait"], variables)
+            if error != "":
+                trace_phase(config, "teardown")
+                run_phase(config, json_rpc.get("teardown", []), variables)
+                return report_phase_failure(config, json_file, test_number, "wait", error)
+        request = json_rpc["request"]
+        expectations = json_rpc.get("test", {}).get("expect", [])
+        if len(variables) > 0:
+            request = substitute_params(request, variables)
+            expectations = substitute_params(expectations, variables)
+        if config.fixtures is not None and not config.fixtures.head_matches:
+            request = pin_block_tags(request, config.fixtures.block_height)
+        method = get_request_method(request)
+        id_map = {}
+        if config.request_rules is not None:
+            request, id_map = config.request_rules.apply(request)
+        request_dumps = json.dumps(request)
+        target = config.scheme + get_target(config.daemon_under_test, method, config.infura_url, config.daemon_on_host,
+                                            config.daemon_on_port)
+        jwt_auth = get_jwt_auth(config.jwt_secret)
+        if config.auth_test and "engine_" in method:
+            if run_auth_tests(config, request_dumps, target, json_file, test_number) != 0:
+                return 1
+        if config.verify_with_daemon == 0:
+            output_api_filename = config.output_dir + get_output_base_name(json_file)
+            request_data = get_request_data(config, request_dumps, output_api_filename + "-request.json.gz")
+            cmd = get_curl_command(config, jwt_auth, request_data, target,
+                                   get_write_out_options(config))
             cmd1 = ""
-            output_api_filename = output_dir + json_file[:-4]
             output_dir_name = output_api_filename[:output_api_filename.rfind("/")]
-            response = json_rpc["response"]
+            response = json_rpc.get("response")
+            if config.fixtures is not None and config.fixtures.get_response(json_file) is not None:
+                response = config.fixtures.get_response(json_file)
+            if len(variables) > 0:
+                response = substitute_params(response, variables)
+            response = ResponseAlternatives.get(request, response)
             silk_file = output_api_filename + "-response.json"
             exp_rsp_file = output_api_filename + "-expResponse.json"
             diff_file = output_api_filename + "-diff.json"
         else:
-            target = get_target(SILK, method, infura_url, daemon_on_host, daemon_on_port)
-            target1 = get_target(daemon_as_reference, method, infura_url, daemon_on_host, daemon_on_port)
-            cmd = '''curl --silent -X POST -H "Content-Type: application/json" ''' + jwt_auth + ''' --data \'''' + request_dumps + '''\' ''' + target
-            cmd1 = '''curl --silent -X POST -H "Content-Type: application/json" ''' + jwt_auth + ''' --data \'''' + request_dumps + '''\' ''' + target1
-            output_api_filename = output_dir + json_file[:-4]
+            target = config.scheme + get_target(SILK, method, config.infura_url, config.daemon_on_host, config.daemon_on_port)
+            target1 = get_target(config.daemon_as_reference, method, config.infura_url, config.daemon_on_host, config.daemon_on_port)
+            if config.daemon_as_reference != INFURA:
+                target1 = config.scheme + target1
+            output_api_filename = config.output_dir + get_output_base_name(json_file)
+            request_data = get_request_data(config, request_dumps, output_api_filename + "-request.json.gz")
+            cmd = get_curl_command(config, jwt_auth, request_data, target,
+                                   get_write_out_options(config))
+            cmd1 = get_curl_command(config, jwt_auth, request_data, target1,
+                                    HTTP_STATUS_OPTIONS if config.reference_limiter is not None else "", True)
             output_dir_name = output_api_filename[:output_api_filename.rfind("/")]
             response = ""
             silk_file = output_api_filename + get_json_filename_ext(SILK)
-            exp_rsp_file = output_api_filename + get_json_filename_ext(daemon_as_reference)
+            exp_rsp_file = output_api_filename + get_json_filename_ext(config.daemon_as_reference)
             diff_file = output_api_filename + "-diff.json"
 
-        return run_shell_command(
-            net,
+        ret = run_shell_command(
+            config,
             cmd,
             cmd1,
             response,
-            verbose_level,
-            exit_on_fail,
             output_dir_name,
             silk_file,
             exp_rsp_file,
             diff_file,
-            dump_output,
             json_file,
-            test_number)
+            test_number,
+            id_map,
+            method,
+            expectations)
+        if "teardown" in json_rpc:
+            trace_phase(config, "teardown")
+        error = run_phase(config, json_rpc.get("teardown", []), variables)
+        if error != "" and ret == 0:
+            return report_phase_failure(config, json_file, test_number, "teardown", error)
+        max_latency_ms = json_rpc.get("test", {}).get("maxLatencyMs")
+        if ret == 0 and max_latency_ms is not None:
+            ret = check_latency(config, json_file, test_number, max_latency_ms)
+        return ret
+
+
+class DaemonLog:
+    """ Log of the daemon under test (--daemon-log), file or Docker container logs: the lines emitted during the time window
+        of each failing test are saved beside its artifacts and the most relevant ones printed with the failure
+    """
+
+    def __init__(self, source: str):
+        """ Create a new DaemonLog on the log file path, docker:<container> or docker (container of --docker-image) """
+        self.container = source[len(DAEMON_LOG_DOCKER_PREFIX):] if source.startswith(DAEMON_LOG_DOCKER_PREFIX) else ""
+        if source == DAEMON_LOG_DOCKER_NODE:
+            self.container = DOCKER_CONTAINER_NAME
+        self.path = source if self.container == "" else ""
+        self.offset = 0
+
+    def mark(self):
+        """ mark the start of the test window, i.e. the current end of the log file """
+        if self.path != "":
+            self.offset = os.path.getsize(self.path) if os.path.exists(self.path) else 0
+
+    def get_lines(self, start_time: float, end_time: float):
+        """ return the log lines emitted from the mark (file) or within the time window (container) """
+        if self.container != "":
+            try:
+                process = subprocess.run(["docker", "logs", "--since", f"{start_time:.3f}", "--until", f"{end_time:.3f}",
+                                          self.container], stdout=subprocess.PIPE, stderr=subprocess.STDOUT, universal_newlines=True,
+                                         check=False)
+            except FileNotFoundError:
+                return []
+            return process.stdout.splitlines()
+        if not os.path.exists(self.path):
+            return []
+        with open(self.path, 'rb') as log_file:
+            # the log file rotated if shorter than the mark
+            log_file.seek(self.offset if os.path.getsize(self.path) >= self.offset else 0)
+            return log_file.read().decode("utf-8", errors="replace").splitlines()
+
+    def attach(self, config, json_file: str, start_time: float, end_time: float):
+        """ save the log lines of the failed test window beside its artifacts and print the most relevant ones (errors and
+            warnings first)
+        """
+        lines = self.get_lines(start_time, end_time)
+        if len(lines) == 0:
+            return
+        log_file_name = config.output_dir + get_output_base_name(json_file) + "-daemon.log"
+        if config.keep_artifacts != KEEP_ARTIFACTS_NONE:
+            os.makedirs(os.path.dirname(log_file_name), exist_ok=True)
+            with open(log_file_name, 'w', encoding='utf8') as log_file:
+                log_file.write("\n".join(lines) + "\n")
+        relevant_lines = [line for line in lines if any(marker in line for marker in DAEMON_LOG_ERROR_MARKERS)] or lines
+        print(f"     daemon log: {len(lines)} lines during the test" +
+              (f" ({log_file_name})" if config.keep_artifacts != KEEP_ARTIFACTS_NONE else ""))
+        for line in relevant_lines[-DAEMON_LOG_PRINTED_LINES:]:
+            print("     | " + line)
+
+
+class DockerNode:
+    """ Start the daemon under test within a Docker container and tear it down at the end of the run """
+
+    def __init__(self, image: str, datadir: str, jwt_file: str, net: str, host: str, port: int):
+        """ Create a new DockerNode """
+        self.image = image
+        self.datadir = datadir
+        self.jwt_file = jwt_file
+        self.chain = "goerli" if net == "goerly" else net
+        self.host = host
+        self.http_port = port if port > 0 else 8545
+        # the engine API published on the port where the engine_ requests are sent
+        self.auth_port = int(get_target(RPCDAEMON, "engine_", "", host, port).split(":")[-1])
+        self.started = False
+
+    def start(self):
+        """ Run the container and wait until the daemon answers to JSON RPC requests """
+        self.stop()
+        cmd = "docker run -d --name " + DOCKER_CONTAINER_NAME + " -p " + str(self.http_port) + ":8545"
+        # the engine API requires the JWT secret, not published without it or if sharing the HTTP port (-p)
+        if self.jwt_file != "" and self.auth_port != self.http_port:
+            cmd = cmd + " -p " + str(self.auth_port) + ":8551"
+        if self.datadir != "":
+            cmd = cmd + " -v " + os.path.abspath(self.datadir) + ":" + DOCKER_DATADIR
+        if self.jwt_file != "":
+            cmd = cmd + " -v " + os.path.abspath(self.jwt_file) + ":" + DOCKER_JWT_FILE + ":ro"
+        cmd = cmd + " " + self.image + " --chain=" + self.chain + " --datadir=" + DOCKER_DATADIR + \
+              " --http.addr=0.0.0.0 --http.port=8545 --http.api=admin,debug,eth,erigon,net,ots,parity,trace,txpool,web3" + \
+              " --authrpc.addr=0.0.0.0 --authrpc.port=8551"
+        if self.jwt_file != "":
+            cmd = cmd + " --authrpc.jwtsecret=" + DOCKER_JWT_FILE
+        print("Starting docker image: " + self.image + " (container: " + DOCKER_CONTAINER_NAME + ")")
+        status = run_system_command(cmd + " > /dev/null")
+        if int(status) != 0:
+            print("docker run failed: Test Aborted!")
+            sys.exit(EXIT_INTERNAL_ERROR)
+        self.started = True
+        if self.wait_ready() == 0:
+            print("daemon in docker container not ready after " + str(DOCKER_READY_TIMEOUT) + " secs: Test Aborted!")
+            self.stop()
+            sys.exit(EXIT_TRANSPORT_FAILURES)
+
+    def wait_ready(self):
+        """ Poll the daemon until it answers to web3_clientVersion or the timeout expires """
+        request = '{"jsonrpc":"2.0","method":"web3_clientVersion","params":[],"id":1}'
+        cmd = "curl --silent -X POST -H \"Content-Type: application/json\" --data '" + request + "' " + \
+              self.host + ":" + str(self.http_port) + " > /dev/null"
+        deadline = time.time() + DOCKER_READY_TIMEOUT
+        while time.time() < deadline:
+            if int(run_system_command(cmd)) == 0:
+                return 1
+            time.sleep(1)
+        return 0
+
+    def stop(self):
+        """ Remove the container, if any """
+        os.system("docker rm -f " + DOCKER_CONTAINER_NAME + " > /dev/null 2>&1")
+        self.started = False
+
+
+class ResultSink:
+    """ Publish the run results out of the local output dir, e.g. before an ephemeral runner goes away """
+
+    def publish(self, summary: dict):
+        """ Publish the run summary, may update it (e.g. results location) for the following sinks """
+        raise NotImplementedError
+
+
+class UploadSink(ResultSink):
+    """ Upload the results tree (diff artifacts) to S3 (s3://bucket/prefix) or GCS (gs://bucket/prefix) """
+
+    def __init__(self, url: str):
+        """ Create a new UploadSink """
+        self.url = url.rstrip("/")
+
+    def publish(self, summary: dict):
+        """ Upload the output dir under <url>/<chain>/<date-time> using the cloud provider CLI """
+        if not os.path.isdir(summary["results"]) or not os.listdir(summary["results"]):
+            return
+        destination = self.url + "/" + summary["net"] + "/" + datetime.now().strftime('%Y%m%d-%H%M%S')
+        if self.url.startswith("gs://"):
+            cmd = "gsutil -m -q cp -r " + summary["results"] + "/* " + destination + "/"
+        else:
+            cmd = "aws s3 cp --recursive --only-show-errors " + summary["results"] + " " + destination
+        if int(run_system_command(cmd)) != 0:
+            print("results upload to " + destination + " failed")
+            return
+        print("Results uploaded to:          " + destination)
+        summary["results"] = destination
+
+
+class WebhookSink(ResultSink):
+    """ Notify the failures summary to a Slack or Teams incoming webhook """
+
+    def __init__(self, url: str):
+        """ Create a new WebhookSink """
+        self.url = url
+
+    def publish(self, summary: dict):
+        """ Post the summary as message text, listing the first failed tests and the results location """
+        text = f"rpc-tests on {summary['net']}: {summary['failed']} failed of {summary['executed']} executed tests"
+        for failed_test in summary["failed_tests"][:WEBHOOK_MAX_FAILED_TESTS]:
+            text = text + "\n- " + failed_test
+        if len(summary["failed_tests"]) > WEBHOOK_MAX_FAILED_TESTS:
+            text = text + f"\n- ... and {len(summary['failed_tests']) - WEBHOOK_MAX_FAILED_TESTS} more"
+        if summary["failed"] > 0:
+            text = text + "\nResults: " + summary["results"]
+        cmd = '''curl --silent --output /dev/null --write-out "%{http_code}" -X POST -H "Content-Type: application/json" --data-binary @- ''' + self.url
+        process = subprocess.run(shlex.split(cmd), input=json.dumps({"text": text}), stdout=subprocess.PIPE,
+                                 universal_newlines=True, check=False)
+        if process.stdout.strip() not in ("200", "202"):
+            print("webhook notification failed: HTTP " + process.stdout.strip())
+
+
+def get_result_sinks(config):
+    """ return the configured result sinks, uploads first so that notifications can link the uploaded results
+    """
+    sinks = []
+    if config.upload_results_url != "":
+        sinks.append(UploadSink(config.upload_results_url))
+    if config.notify_webhook_url != "":
+        sinks.append(WebhookSink(config.notify_webhook_url))
+    return sinks
+
+
+def run_chain_session(argv, chain: str, port: str, options, lock, exit_codes, processes, outputs):
+    """ run the test session of one chain as child process, printing its output prefixed by the chain name or collecting
+        it into the outputs (if any) to be printed in the order of the chains
+    """
+    child_argv = [sys.executable, argv[0], "-b", chain]
+    if port != "":
+        child_argv = child_argv + ["-p", port]
+    credential_options = []
+    for option, optarg in options:
+        if option in ("-b", "-p", "--port-map"):
+            continue
+        if option in CREDENTIAL_OPTIONS:
+            credential_options.append([option, optarg])
+            continue
+        child_argv.append(option)
+        if option in CHAIN_FILE_OPTIONS:
+            root, ext = os.path.splitext(optarg)
+            child_argv.append(root + "_" + chain + ext)
+        elif optarg != "":
+            child_argv.append(optarg)
+    child_env = dict(os.environ, **{CREDENTIAL_OPTIONS_ENV: json.dumps(credential_options)})
+    with subprocess.Popen(child_argv, stdout=subprocess.PIPE, stderr=subprocess.STDOUT, env=child_env) as process:
+        processes.append(process)
+        for line in process.stdout:
+            # overlay the carriage-return separated chunks, i.e. keep what would be visible on a terminal
+            visible = ""
+            for chunk in line.decode('utf8', 'replace').rstrip('\n').split('\r'):
+                visible = chunk + visible[len(chunk):]
+            if visible.strip() == "":
+                continue
+            if outputs is not None:
+                outputs.setdefault(chain, []).append("[" + chain + "] " + visible.rstrip())
+                continue
+            with lock:
+                print("[" + chain + "] " + visible.rstrip(), flush=True)
+        exit_codes[chain] = process.wait()
+
+
+def run_multi_chain(argv, config):
+    """ run concurrently one test session per chain, each against its own endpoint; with seed the outputs of the sessions
+        are not interleaved but printed by chain in order, so that the outputs of two runs can be compared line by line
+    """
+    lock = threading.Lock()
+    exit_codes = {}
+    processes = []
+    threads = []
+    outputs = {} if config.seed is not None else None
+    for chain in config.net.split(","):
+        port = config.port_map.get(chain, str(config.daemon_on_port) if config.daemon_on_port > 0 else "")
+        thread = threading.Thread(target=run_chain_session, args=(argv, chain, port, config.options, lock, exit_codes, processes,
+                                                                  outputs), daemon=True)
+        thread.start()
+        threads.append(thread)
+    try:
+        for thread in threads:
+            thread.join()
+    except KeyboardInterrupt:
+        # children not in the terminal process group don't receive Ctrl+C
+        for process in processes:
+            process.terminate()
+        raise
+    for chain in dict.fromkeys(config.net.split(",")) if outputs is not None else []:
+        for line in outputs.get(chain, []):
+            print(line)
+    for chain, exit_code in sorted(exit_codes.items()):
+        print(f"[{chain}] exit code: {exit_code}")
+    return max(exit_codes.values(), key=lambda exit_code: EXIT_CODE_PRIORITY.index(exit_code) if exit_code in EXIT_CODE_PRIORITY
+               else EXIT_CODE_PRIORITY.index(EXIT_INTERNAL_ERROR), default=EXIT_SUCCESS)
+
+
+# run config file keys of the options that can be repeated, given as list of values instead of comma-joined
+CONFIG_REPEATED_OPTIONS = ["header", "reference-header"]
+# run config file keys of the short options, the long options have their name as key (e.g. port-map)
+CONFIG_SHORT_OPTIONS = {
+    "only-fail": "-f",
+    "continue": "-c",
+    "rpcdaemon": "-r",
+    "loops": "-l",
+    "apis": "-a",
+    "start-test": "-s",
+    "test": "-t",
+    "verify-with-daemon": "-d",
+    "infura-url": "-i",
+    "blockchain": "-b",
+    "verbose": "-v",
+    "dump-output": "-o",
+    "jwt-file": "-k",
+    "exclude-apis": "-x",
+    "exclude-tests": "-X",
+    "host": "-H",
+    "port": "-p",
+}
+
+
+def load_config_options(name: str):
+    """ parse run config file (YAML, or TOML if .toml) of option key -> value into command line options, raise ValueError if
+        invalid e.g. {"blockchain": "mainnet", "continue": true, "exclude-apis": ["engine_", "txpool_"]} becomes
+        ["-b", "mainnet", "-c", "-x", "engine_,txpool_"]; true values are flags, false values are omitted, lists are joined
+        and maps (e.g. port-map) become key=value lists
+    """
+    try:
+        if name.endswith(".toml"):
+            # tomllib from Python 3.11, tomli package before
+            try:
+                import tomllib  # pylint: disable=import-outside-toplevel
+            except ImportError:
+                try:
+                    import tomli as tomllib  # pylint: disable=import-outside-toplevel
+                except ImportError as err:
+                    raise ValueError("TOML run config needs Python 3.11 or the tomli package") from err
+            with open(name, 'rb') as file:
+                try:
+                    run_config = tomllib.load(file)
+                except tomllib.TOMLDecodeError as err:
+                    raise ValueError(str(err)) from err
+        else:
+            with open(name, encoding='utf8') as file:
+                run_config = yaml.safe_load(file)
+    except (FileNotFoundError, yaml.YAMLError) as err:
+        raise ValueError(str(err)) from err
+    if not isinstance(run_config, dict):
+        raise ValueError("run config must be a map of option key -> value")
+    options = []
+    for key, value in run_config.items():
+        option = CONFIG_SHORT_OPTIONS.get(key, "--" + str(key))
+        if value is False or value is None:
+            continue
+        if key in CONFIG_REPEATED_OPTIONS and isinstance(value, list):
+            for item in value:
+                options = options + [option, str(item)]
+            continue
+        options.append(option)
+        if value is True:
+            continue
+        if isinstance(value, list):
+            value = ",".join(str(item) for item in value)
+        elif isinstance(value, dict):
+            value = ",".join(str(item_key) + "=" + str(item_value) for item_key, item_value in value.items())
+        options.append(str(value))
+    return options
+
+
+def get_config_argv(argv):
+    """ return the command line with the options of the run config file (--config) in front of the others, so that the
+        options on the command line override the ones in the file
+    """
+    config_options = []
+    command_line = []
+    args = iter(argv[1:])
+    for arg in args:
+        if arg == "--config" or arg.startswith("--config="):
+            name = arg.partition("=")[2] if "=" in arg else next(args, "")
+            try:
+                config_options = config_options + load_config_options(name)
+            except ValueError as err:
+                print("invalid run config file: " + name + ": " + str(err))
+                sys.exit(EXIT_CONFIG_ERROR)
+        else:
+            command_line.append(arg)
+    return argv[:1] + config_options + command_line
+
+
+def mask_credential(option, optarg):
+    """ return the value of the credential option with the secret part masked, i.e. the header value or the password
+    """
+    if option in ("--header", "--reference-header"):
+        name, _, _ = optarg.partition(":")
+        return name.strip() + ": ***"
+    user, _, _ = optarg.partition(":")
+    return user + ":***"
+
+
+def get_effective_config(options):
+    """ return the run config (option key -> value) equivalent to the parsed options, the last occurrence of an option wins
+    """
+    option_keys = {option: key for key, option in CONFIG_SHORT_OPTIONS.items()}
+    run_config = {}
+    for option, optarg in options:
+        if option == "--print-config":
+            continue
+        key = option_keys.get(option, option.lstrip("-"))
+        if option in CREDENTIAL_OPTIONS:
+            optarg = mask_credential(option, optarg)
+        if key in CONFIG_REPEATED_OPTIONS:
+            run_config[key] = run_config.get(key, []) + [optarg]
+            continue
+        run_config.pop(key, None)
+        run_config[key] = True if optarg == "" else int(optarg) if optarg.isdigit() else optarg
+    return run_config
 
 
 #
@@ -521,10 +3491,10 @@ def usage(argv):
     print("-l <number of loops>")
     print("-a <test_apis>: run all tests of the specified API (e.g.: eth_call,eth_getLogs,debug_)")
     print("-s <start_test_number>: run tests starting from input")
-    print("-t <test_number>: run single test")
+    print("-t <test_number>: run single test (global test number, changing when tests are added: see --run)")
     print("-d send requests also to the reference daemon e.g.: Erigon RpcDaemon")
     print("-i <infura_url> send any request also to the Infura API endpoint as reference")
-    print("-b blockchain [default: goerly]")
+    print("-b blockchain, comma-separated list runs the chains concurrently (e.g.: mainnet,sepolia) [default: goerly]")
     print("-v <verbose_level>")
     print("-o dump response")
     print("-k authentication token file")
@@ -532,6 +3502,587 @@ def usage(argv):
     print("-X exclude test list (e.g.: 18,22)")
     print("-H host where the RpcDaemon is located (e.g.: 10.10.2.3)")
     print("-p port where the RpcDaemon is located (e.g.: 8545)")
+    print("--docker-image <image> start the daemon under test from the Docker image before the run (e.g.: erigontech/erigon:v3.x)")
+    print("--docker-datadir <path> datadir mounted as volume into the Docker container")
+    print("--timing-baseline <file> JSON file of test -> p95 duration (secs) used to flag SLOW tests")
+    print("--slow-factor <factor> test is SLOW if its duration exceeds factor times its baseline [default: " + str(DEFAULT_SLOW_FACTOR) + "]")
+    print("--fail-on-slow exit with error if any test is SLOW")
+    print("--save-timings <file> save the test durations of this run in the timing baseline format")
+    print("--request-rules <file> YAML file of rules rewriting requests before sending (e.g.: placeholders, ids)")
+    print("--tests-on-latest-block replace block parameters by latest as configured in the request rules")
+    print("--auth-test send engine_ requests also with invalid JWT (no token, expired iat, wrong secret, wrong algorithm) expecting HTTP 401")
+    print("--quarantine-flaky <file> with more loops (-l) write the FLAKY tests (mixed outcomes) into file")
+    print("--tls-ca <file> connect using TLS (https) verifying the RpcDaemon certificate with the CA certificate file")
+    print("--tls-cert <file> connect using TLS (https) with the client certificate file (mutual TLS)")
+    print("--tls-key <file> private key file of the client certificate")
+    print("--tls-insecure connect using TLS (https) without verifying the RpcDaemon certificate")
+    print("--gzip-request send the request bodies gzip-compressed (Content-Encoding: gzip)")
+    print("--body-limit <bytes> check that requests at the body size limit are accepted and just above it are rejected with HTTP 413")
+    print("--normalize compare responses after normalizing hex case, quantity leading zeros and null optional fields")
+    print("--upload-results <url> upload the results tree to S3 (s3://bucket/prefix) or GCS (gs://bucket/prefix)")
+    print("--notify-webhook <url> post the failures summary to the Slack or Teams incoming webhook")
+    print("--golden-cache <MB> with more loops (-l) max size of the parsed test files kept in memory across loops [default: " +
+          str(DEFAULT_GOLDEN_CACHE_SIZE) + "]")
+    print("--golden-store <dir> directory of the content-addressed blobs referenced by the test files as {\"$golden\": \"<hash>\"} "
+          "[default: " + DEFAULT_GOLDEN_STORE_DIR + "]")
+    print("--method-filter <methods> run the tests whose requests call any of the methods (e.g.: eth_call,eth_estimateGas,debug_)")
+    print("--sla <file> YAML file of latency targets per method (e.g.: eth_call: 200ms p95), optionally per chain, evaluated over the run")
+    print("--enforce-sla exit with error if any SLA target is missed")
+    print("--error-message <mode> compare the error message (error code is always compared) as exact, prefix, regex (expected message) or ignore [default: exact]")
+    print("--ignore-error-data don't compare the error data")
+    print("--namespace-policy <namespace=policy,...> comparison policy of the namespaces overriding the policy table: exact or "
+          "errors-only (JSON-RPC envelope, result or error presence and error compared, not the result) [default: errors-only for "
+          + ",".join(namespace for namespace, policy in namespace_comparison_policies.items() if policy == COMPARISON_ERRORS_ONLY) + "]")
+    print("--numeric-equivalence <rules> compare hex quantities and numbers (e.g. \"0x1\" and 1) as equal when the same value, for "
+          "the comma-separated methods, optionally restricted to a path (e.g.: eth_getBlockByNumber,engine_getPayloadV3:result."
+          "executionPayload) or all")
+    print("--checkpoint <file> save the outcomes of the completed tests into file every N tests (and at exit)")
+    print("--checkpoint-every <N> number of completed tests between checkpoints [default: " + str(DEFAULT_CHECKPOINT_EVERY) + "]")
+    print("--resume <file> resume the run from the checkpoint file skipping the tests already passed (checkpoint updated in place)")
+    print("--byte-metrics report per API the average request and response sizes (headers, body, decompressed body)")
+    print("--connection-metrics report per API the new and reused connections and the average DNS, TCP, TLS, server and transfer times")
+    print("--compressed-response request compressed responses (Accept-Encoding), decompressed before comparison")
+    print("--max-diff-entries <N> summarize the failed test differences (additions, deletions, changes, first divergence), "
+          "writing the summary with a sample of N differences instead of diff if more")
+    print("--full-diff with max diff entries (--max-diff-entries) write anyway the full diff")
+    print("--diff-strategy <strategy> auto (in process comparison, external diff tool only for text normalized files or to write "
+          "the diff file) or external (always the external diff tool) [default: auto]")
+    print("--keep-artifacts <mode> keep response, expected response and diff files of all, failed or none tests [default: failed]")
+    print("--reference-client <client> with -d client of the reference (e.g. geth, nethermind) whose capability profile adjusts "
+          "skipped namespaces and compared fields [default: detected by web3_clientVersion]")
+    print("--reference-rate <rate> max rate of the requests to the reference (e.g.: 10/s, 600/m), backing off if rate limited (HTTP 429)")
+    print("--reference-burst <N> max burst of the requests to the reference [default: requests per sec of the rate]")
+    print("--perf-history <file> append the run performance metrics (total RTT, parsing time, p95 per API) to the history file")
+    print("--perf-trend <K> print the deltas of the performance metrics against the average of the last K runs in history")
+    print("--config <file> run config file (YAML, or TOML if .toml) of option key -> value (e.g. blockchain: mainnet, "
+          "exclude-apis: [engine_], tls-insecure: true), options on the command line override the file")
+    print("--print-config print the effective run config (config file and command line options) and exit")
+    print("--record-fixtures <file> record the responses of the daemon under test tagged with its head block height")
+    print("--fixtures <file> compare against the responses recorded in file (expected side), the head sensitive tests skipped or "
+          "re-pinned to the recorded height if the head differs")
+    print("--fixture-pinning <mode> head sensitive tests if the head differs from the fixtures height: skip, repin (block tags "
+          "replaced by the recorded height) [default: repin]")
+    print("--tags <list> run only the tests having any of the tags in their metadata (e.g.: cancun,receipts)")
+    print("--explain-selection print for each test whether it is run, skipped or not selected and why, without running any test")
+    print("--run <list> run the tests by stable address i.e. path (e.g.: eth_call/test_07.json,eth_getLogs/test_03) or "
+          "metadata id, unlike -t not changing when tests are added")
+    print("--latency-mode <mode> test exceeding the max latency of its metadata (maxLatencyMs): fail, warn [default: fail]")
+    print("--csv-report <file> write the per-test results as CSV rows (test, number, transport, outcome, RTT, response bytes, "
+          "error class) incrementally")
+    print("--proxy <url> send the requests through the HTTP or SOCKS proxy (e.g.: http://proxy:3128, socks5h://localhost:1080) "
+          "[default: proxy environment variables e.g. https_proxy, ALL_PROXY]")
+    print("--transport <transport> transport of the requests to the daemon under test: http (https with TLS options), ipc "
+          "[default: http]")
+    print("--ipc-path <path> IPC socket of the daemon under test with the ipc transport (e.g.: /data/erigon/erigon.ipc)")
+    print("--results-retention <7d|10runs> results of each run in a run-id-stamped directory (results/<run id>, latest linked as "
+          "results/latest), removing the runs older than the age or beyond the newest runs")
+    print("--compression-check send the requests of each test also without and with gzip response compression, reporting the "
+          "methods whose response is not compressed or differs once decompressed")
+    print("--header <'name: value'> custom HTTP header of the requests to the daemon under test, repeatable (e.g.: 'X-Api-Key: "
+          "${API_KEY}', environment variables expanded)")
+    print("--reference-header <'name: value'> custom HTTP header of the requests to the reference (-d, -i), repeatable")
+    print("--basic-auth <user:password> HTTP basic authentication of the daemon under test (environment variables expanded)")
+    print("--reference-basic-auth <user:password> HTTP basic authentication of the reference (-d, -i)")
+    print("--changed-since <git-ref> run only the test files added or modified since the git ref (e.g.: origin/main), "
+          "uncommitted and untracked ones included")
+    print("--daemon-log <path|docker:container|docker> attach to each failure the log lines of the daemon under test emitted during the test "
+          "(log file, Docker container logs or docker for the container of --docker-image)")
+    print("--otlp-endpoint <url> export the OpenTelemetry trace of the run (span per test and per test phase: load, setup, wait, "
+          "send, compare, dump, teardown) to the OTLP/HTTP collector (e.g.: http://localhost:4318)")
+    print("--chaos <faults> inject network faults on the requests to the daemon under test, reported apart: connections reset "
+          "mid-response, delays, duplicates with same id (e.g.: drop=1%,latency=200ms±100ms,dup=0.1%)")
+    print("--unique-ids <transports> unique JSON-RPC ids per request (restored in responses before comparison) on all or the listed "
+          "transports of the run (e.g.: https,https+gzip), as renumber_ids of the request rules")
+    print("--samples <N> send the requests of each test N more times after the compared run, aggregating the per-test latency "
+          "(p50/p95) over the N samples")
+    print("--wait-ready <duration> wait up to duration (e.g.: 120s) for the daemon under test (and the reference) to answer with "
+          "the sync completed before the run, checked anyway without waiting")
+    print("--min-block <N> min head block height of the daemon under test (and the reference) to start the run")
+    print("--seed <N> seed of the random chaos faults (printed at start if not given) and, in multi-chain run, output by chain in "
+          "order instead of interleaved, so that two runs are comparable line by line")
+    print("--port-map <chain=port,...> port of the RpcDaemon for each chain in multi-chain run (e.g.: mainnet=8545,sepolia=8546)")
+
+
+class Config:
+    # pylint: disable=too-many-instance-attributes
+    """ This class manage configuration params """
+
+    def __init__(self, argv):
+        """ Processes the command line contained in argv """
+        self.exit_on_fail = True
+        self.daemon_under_test = SILK
+        self.daemon_as_reference = RPCDAEMON
+        self.loop_number = 1
+        self.verbose_level = 0
+        self.req_test = -1
+        self.dump_output = False
+        self.infura_url = ""
+        self.daemon_on_host = "localhost"
+        self.daemon_on_port = 0
+        self.requested_apis = ""
+        self.verify_with_daemon = False
+        self.net = "goerly"
+        self.json_dir = "./" + self.net + "/"
+        self.results_dir = "results"
+        self.output_dir = self.json_dir + self.results_dir + "/"
+        self.exclude_api_list = ""
+        self.exclude_test_list = ""
+        self.start_test = ""
+        self.jwt_secret = ""
+        self.jwt_file = ""
+        self.display_only_fail = 0
+        self.docker_image = ""
+        self.docker_datadir = ""
+        self.timing_baseline = None
+        self.slow_factor = DEFAULT_SLOW_FACTOR
+        self.fail_on_slow = False
+        self.save_timings_file = ""
+        self.request_rules = None
+        self.port_map = {}
+        self.options = []
+        self.auth_test = False
+        self.quarantine_flaky_file = ""
+        self.scheme = ""
+        self.tls_options = ""
+        self.gzip_request = False
+        self.body_limit = 0
+        self.transport = TRANSPORT_HTTP
+        self.ipc_path = ""
+        self.normalize = False
+        self.upload_results_url = ""
+        self.notify_webhook_url = ""
+        self.golden_cache_size = DEFAULT_GOLDEN_CACHE_SIZE
+        self.golden_cache = None
+        self.golden_store_dir = DEFAULT_GOLDEN_STORE_DIR
+        self.method_filter = ""
+        self.sla = None
+        self.enforce_sla = False
+        self.error_message_mode = ERROR_MESSAGE_EXACT
+        self.ignore_error_data = False
+        self.numeric_equivalence = {}
+        self.namespace_policies = dict(namespace_comparison_policies)
+        self.checkpoint = None
+        self.byte_metrics = None
+        self.connection_metrics = None
+        self.compressed_response = False
+        self.max_diff_entries = 0
+        self.full_diff = False
+        self.diff_strategy = DIFF_STRATEGY_AUTO
+        self.diff_timings = {}
+        self.endpoint_round_trip_times = {}
+        self.keep_artifacts = KEEP_ARTIFACTS_FAILED
+        self.reference_client = ""
+        self.reference_limiter = None
+        self.parse_time = 0.0
+        self.perf_history_file = ""
+        self.perf_trend_runs = 0
+        self.failure_classes = {}
+        self.fixtures = None
+        self.record_fixtures = None
+        self.fixture_pinning = FIXTURE_PINNING_REPIN
+        self.tags = ""
+        self.explain_selection = False
+        self.run_addresses = ""
+        self.latency_mode = LATENCY_MODE_FAIL
+        self.csv_report = None
+        self.proxy = ""
+        self.target_auth = ""
+        self.reference_auth = ""
+        self.chaos = None
+        self.seed = None
+        self.wait_ready = 0
+        self.samples = 0
+        self.compression_check = False
+        self.results_retention = None
+        self.run_id = ""
+        self.min_block = -1
+        self.daemon_log = None
+        self.tracer = None
+        self.changed_since = ""
+        self.changed_test_files = None
+        self.failure_manifest = None
+        self.node_states = {}
+        self.test_metrics = {}
+
+        self.__parse_args(argv)
+
+    def __parse_args(self, argv):
+        request_rules_file = ""
+        sla_file = ""
+        reference_rate = 0.0
+        reference_burst = 0
+        csv_report_file = ""
+        otlp_endpoint = ""
+        checkpoint_file = ""
+        checkpoint_every = DEFAULT_CHECKPOINT_EVERY
+        resume_file = ""
+        fixtures_file = ""
+        tests_on_latest_block = False
+        unique_ids = ""
+        print_config = False
+        argv = get_config_argv(argv)
+        try:
+            opts, _ = getopt.getopt(argv[1:], "hfrcv:t:l:a:di:b:ox:X:H:k:s:p:",
+                                    ["docker-image=", "docker-datadir=", "timing-baseline=", "slow-factor=", "fail-on-slow",
+                                     "save-timings=", "request-rules=", "tests-on-latest-block",
+                                     "port-map=", "auth-test", "quarantine-flaky=",
+                                     "tls-ca=", "tls-cert=", "tls-key=", "tls-insecure", "gzip-request", "body-limit=",
+                                     "normalize", "upload-results=", "notify-webhook=",
+                                     "golden-cache=", "golden-store=", "method-filter=",
+                                     "sla=", "enforce-sla", "error-message=", "ignore-error-data", "numeric-equivalence=", "namespace-policy=",
+                                     "checkpoint=", "checkpoint-every=", "resume=",
+                                     "byte-metrics", "connection-metrics", "compressed-response", "max-diff-entries=", "full-diff",
+                                     "keep-artifacts=", "reference-client=",
+                                     "reference-rate=", "reference-burst=", "perf-history=", "perf-trend=",
+                                     "print-config", "fixtures=", "record-fixtures=", "fixture-pinning=",
+                                     "tags=", "explain-selection", "run=", "latency-mode=", "csv-report=", "proxy=", "chaos=", "daemon-log=",
+                                     "diff-strategy=", "changed-since=", "seed=",
+                                     "wait-ready=", "min-block=", "samples=",
+                                     "unique-ids=", "compression-check", "results-retention=",
+                                     "transport=", "ipc-path=", "otlp-endpoint=",
+                                     "header=", "reference-header=", "basic-auth=", "reference-basic-auth="])
+            # credential options of a multi-chain run, passed by the parent session through the environment
+            opts = opts + [tuple(option) for option in json.loads(os.environ.pop(CREDENTIAL_OPTIONS_ENV, "[]"))]
+            self.options = opts
+            for option, optarg in opts:
+                if option in ("-h", "--help"):
+                    usage(argv)
+                    sys.exit(EXIT_CONFIG_ERROR)
+                elif option == "-c":
+                    self.exit_on_fail = 0
+                elif option == "-r":
+                    self.daemon_under_test = RPCDAEMON
+                elif option == "-i":
+                    self.daemon_as_reference = INFURA
+                    # API key in the URL path given by environment variable (e.g. https://mainnet.infura.io/v3/${API_KEY})
+                    self.infura_url = os.path.expandvars(optarg)
+                elif option == "-H":
+                    self.daemon_on_host = optarg
+                elif option == "-p":
+                    self.daemon_on_port = int(optarg)
+                elif option == "-f":
+                    self.display_only_fail = 1
+                elif option == "-v":
+                    self.verbose_level = int(optarg)
+                elif option == "-t":
+                    self.req_test = int(optarg)
+                elif option == "-s":
+                    self.start_test = int(optarg)
+                elif option == "-a":
+                    self.requested_apis = optarg
+                elif option == "-l":
+                    self.loop_number = int(optarg)
+                elif option == "-d":
+                    self.verify_with_daemon = 1
+                elif option == "-o":
+                    self.dump_output = 1
+                elif option == "-b":
+                    self.net = optarg
+                    self.json_dir = "./" + self.net + "/"
+                    self.output_dir = self.json_dir + self.results_dir + "/"
+                elif option == "-x":
+                    self.exclude_api_list = optarg
+                elif option == "-X":
+                    self.exclude_test_list = optarg
+                elif option == "-k":
+                    self.jwt_secret = get_jwt_secret(optarg)
+                    if self.jwt_secret == "":
+                        print("secret file not found")
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.jwt_file = optarg
+                elif option == "--docker-image":
+                    self.docker_image = optarg
+                    self.daemon_under_test = RPCDAEMON
+                elif option == "--docker-datadir":
+                    self.docker_datadir = optarg
+                elif option == "--timing-baseline":
+                    self.timing_baseline = load_timing_baseline(optarg)
+                    if self.timing_baseline is None:
+                        print("timing baseline file not found or invalid")
+                        sys.exit(EXIT_CONFIG_ERROR)
+                elif option == "--slow-factor":
+                    self.slow_factor = float(optarg)
+                elif option == "--fail-on-slow":
+                    self.fail_on_slow = True
+                elif option == "--save-timings":
+                    self.save_timings_file = optarg
+                elif option == "--request-rules":
+                    request_rules_file = optarg
+                elif option == "--tests-on-latest-block":
+                    tests_on_latest_block = True
+                elif option == "--tls-ca":
+                    self.tls_options = self.tls_options + " --cacert " + optarg
+                    self.scheme = "https://"
+                elif option == "--tls-cert":
+                    self.tls_options = self.tls_options + " --cert " + optarg
+                    self.scheme = "https://"
+                elif option == "--tls-key":
+                    self.tls_options = self.tls_options + " --key " + optarg
+                    self.scheme = "https://"
+                elif option == "--tls-insecure":
+                    self.tls_options = self.tls_options + " --insecure"
+                    self.scheme = "https://"
+                elif option == "--gzip-request":
+                    self.gzip_request = True
+                elif option == "--body-limit":
+                    self.body_limit = int(optarg)
+                elif option == "--normalize":
+                    self.normalize = True
+                elif option == "--upload-results":
+                    if not optarg.startswith(("s3://", "gs://")):
+                        print("unsupported results upload destination: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.upload_results_url = optarg
+                elif option == "--notify-webhook":
+                    self.notify_webhook_url = optarg
+                elif option == "--golden-cache":
+                    self.golden_cache_size = int(optarg)
+                elif option == "--golden-store":
+                    self.golden_store_dir = optarg
+                elif option == "--method-filter":
+                    self.method_filter = optarg
+                elif option == "--sla":
+                    sla_file = optarg
+                elif option == "--enforce-sla":
+                    self.enforce_sla = True
+                elif option == "--error-message":
+                    if optarg not in (ERROR_MESSAGE_EXACT, ERROR_MESSAGE_PREFIX, ERROR_MESSAGE_REGEX, ERROR_MESSAGE_IGNORE):
+                        print("unsupported error message comparison: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.error_message_mode = optarg
+                elif option == "--ignore-error-data":
+                    self.ignore_error_data = True
+                elif option == "--namespace-policy":
+                    for rule in optarg.split(","):
+                        namespace, _, policy = rule.partition("=")
+                        if policy not in (COMPARISON_EXACT, COMPARISON_ERRORS_ONLY):
+                            print("unsupported namespace comparison policy: " + rule)
+                            sys.exit(EXIT_CONFIG_ERROR)
+                        self.namespace_policies[namespace.rstrip("_") + "_"] = policy
+                elif option == "--numeric-equivalence":
+                    for rule in optarg.split(","):
+                        method, _, path = rule.partition(":")
+                        # paths matched with the array indexes omitted (e.g. result.transactions.gas)
+                        path = re.sub(r"\[\d*\]", "", path.removeprefix("$").removeprefix("."))
+                        self.numeric_equivalence.setdefault(method, []).append(path)
+                elif option == "--checkpoint":
+                    checkpoint_file = optarg
+                elif option == "--checkpoint-every":
+                    checkpoint_every = int(optarg)
+                elif option == "--resume":
+                    resume_file = optarg
+                elif option == "--byte-metrics":
+                    self.byte_metrics = ByteMetrics()
+                elif option == "--connection-metrics":
+                    self.connection_metrics = ConnectionMetrics()
+                elif option == "--compressed-response":
+                    self.compressed_response = True
+                elif option == "--max-diff-entries":
+                    self.max_diff_entries = int(optarg)
+                elif option == "--full-diff":
+                    self.full_diff = True
+                elif option == "--diff-strategy":
+                    if optarg not in (DIFF_STRATEGY_AUTO, DIFF_STRATEGY_EXTERNAL):
+                        print("unsupported diff strategy: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.diff_strategy = optarg
+                elif option == "--keep-artifacts":
+                    if optarg not in (KEEP_ARTIFACTS_ALL, KEEP_ARTIFACTS_FAILED, KEEP_ARTIFACTS_NONE):
+                        print("unsupported artifacts retention: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.keep_artifacts = optarg
+                    # all as dump response (-o)
+                    self.dump_output = 1 if optarg == KEEP_ARTIFACTS_ALL else self.dump_output
+                elif option == "--reference-client":
+                    self.reference_client = optarg.lower()
+                elif option == "--reference-rate":
+                    try:
+                        reference_rate = parse_rate(optarg)
+                    except ValueError:
+                        print("invalid reference rate: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                elif option == "--reference-burst":
+                    reference_burst = int(optarg)
+                elif option == "--perf-history":
+                    self.perf_history_file = optarg
+                elif option == "--perf-trend":
+                    self.perf_trend_runs = int(optarg)
+                elif option == "--print-config":
+                    print_config = True
+                elif option == "--fixtures":
+                    fixtures_file = optarg
+                elif option == "--record-fixtures":
+                    self.record_fixtures = Fixtures(optarg, 0, {})
+                elif option == "--fixture-pinning":
+                    if optarg not in (FIXTURE_PINNING_SKIP, FIXTURE_PINNING_REPIN):
+                        print("invalid fixture pinning: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.fixture_pinning = optarg
+                elif option == "--tags":
+                    self.tags = optarg
+                elif option == "--explain-selection":
+                    self.explain_selection = True
+                elif option == "--run":
+                    self.run_addresses = optarg
+                elif option == "--latency-mode":
+                    if optarg not in (LATENCY_MODE_FAIL, LATENCY_MODE_WARN):
+                        print("invalid latency mode: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.latency_mode = optarg
+                elif option == "--csv-report":
+                    csv_report_file = optarg
+                elif option == "--proxy":
+                    self.proxy = optarg
+                elif option == "--daemon-log":
+                    self.daemon_log = DaemonLog(optarg)
+                elif option == "--otlp-endpoint":
+                    otlp_endpoint = optarg
+                elif option in ("--header", "--reference-header"):
+                    name, _, value = optarg.partition(":")
+                    if name.strip() == "" or " " in name.strip() or value.strip() == "":
+                        print("invalid header (name: value): " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    auth = " -H " + shlex.quote(name.strip() + ": " + os.path.expandvars(value.strip()))
+                    if option == "--header":
+                        self.target_auth = self.target_auth + auth
+                    else:
+                        self.reference_auth = self.reference_auth + auth
+                elif option in ("--basic-auth", "--reference-basic-auth"):
+                    if ":" not in optarg:
+                        print("invalid basic auth (user:password): " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    auth = " --user " + shlex.quote(os.path.expandvars(optarg))
+                    if option == "--basic-auth":
+                        self.target_auth = self.target_auth + auth
+                    else:
+                        self.reference_auth = self.reference_auth + auth
+                elif option == "--unique-ids":
+                    unique_ids = optarg
+                elif option == "--transport":
+                    if optarg not in (TRANSPORT_HTTP, TRANSPORT_IPC):
+                        print("unsupported transport: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                    self.transport = optarg
+                elif option == "--ipc-path":
+                    self.ipc_path = optarg
+                elif option == "--results-retention":
+                    try:
+                        self.results_retention = parse_retention(optarg)
+                    except ValueError:
+                        print("invalid results retention: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                elif option == "--compression-check":
+                    self.compression_check = True
+                elif option == "--samples":
+                    self.samples = int(optarg)
+                elif option == "--wait-ready":
+                    try:
+                        self.wait_ready = parse_duration(optarg)
+                    except ValueError:
+                        print("invalid ready timeout: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                elif option == "--min-block":
+                    self.min_block = int(optarg, 0)
+                elif option == "--seed":
+                    self.seed = int(optarg)
+                elif option == "--changed-since":
+                    self.changed_since = optarg
+                elif option == "--chaos":
+                    try:
+                        self.chaos = ChaosInjector.parse(optarg)
+                    except ValueError:
+                        print("invalid chaos spec: " + optarg)
+                        sys.exit(EXIT_CONFIG_ERROR)
+                elif option == "--quarantine-flaky":
+                    self.quarantine_flaky_file = optarg
+                elif option == "--auth-test":
+                    self.auth_test = True
+                elif option == "--port-map":
+                    for chain_port in optarg.split(","):
+                        chain, _, port = chain_port.partition("=")
+                        self.port_map[chain] = port
+                else:
+                    usage(argv)
+                    sys.exit(EXIT_CONFIG_ERROR)
+            if self.auth_test and self.jwt_secret == "":
+                print("auth test requires the authentication token file (-k)")
+                sys.exit(EXIT_CONFIG_ERROR)
+            if " --key " in self.tls_options and " --cert " not in self.tls_options:
+                print("TLS client key requires the client certificate (--tls-cert)")
+                sys.exit(EXIT_CONFIG_ERROR)
+            # caching is worth only when the tests are repeated
+            self.golden_cache = GoldenCache(self.golden_cache_size * 1024 * 1024 if self.loop_number > 1 else 0,
+                                            GoldenStore(self.golden_store_dir))
+            if sla_file != "":
+                self.sla = load_sla(sla_file, self.net)
+                if self.sla is None:
+                    print("invalid SLA file: " + sla_file)
+                    sys.exit(EXIT_CONFIG_ERROR)
+            if self.enforce_sla and self.sla is None:
+                print("enforce SLA requires the SLA file (--sla)")
+                sys.exit(EXIT_CONFIG_ERROR)
+            if reference_rate > 0:
+                self.reference_limiter = RateLimiter(reference_rate, reference_burst if reference_burst > 0 else max(int(reference_rate), 1))
+            if self.transport == TRANSPORT_IPC and self.ipc_path == "":
+                print("IPC transport requires the IPC socket path (--ipc-path)")
+                sys.exit(EXIT_CONFIG_ERROR)
+            if self.transport == TRANSPORT_IPC and (self.scheme != "" or self.gzip_request or self.auth_test or self.body_limit > 0 or
+                                                    self.compression_check):
+                print("TLS, gzip request, auth test, body limit and compression check not supported by the IPC transport")
+                sys.exit(EXIT_CONFIG_ERROR)
+            if self.results_retention is not None:
+                # results of each run kept apart, the stale ones pruned
+                self.run_id = get_run_id(self.json_dir + self.results_dir)
+                self.output_dir = self.json_dir + self.results_dir + "/" + self.run_id + "/"
+            if self.perf_trend_runs > 0 and self.perf_history_file == "":
+                print("perf trend requires the performance history file (--perf-history)")
+                sys.exit(EXIT_CONFIG_ERROR)
+            if fixtures_file != "" and (self.verify_with_daemon or self.record_fixtures is not None):
+                print("fixtures are the expected side, not compatible with the reference daemon (-d) or recording fixtures")
+                sys.exit(EXIT_CONFIG_ERROR)
+            if "," in self.net and self.docker_image != "":
+                print("Docker image not supported in multi-chain run (the containers of the chains would share the host ports)")
+                sys.exit(EXIT_CONFIG_ERROR)
+            # the chain files (CHAIN_FILE_OPTIONS) of a multi-chain run are opened by the chain sessions
+            chain_files = "," not in self.net
+            if fixtures_file != "" and chain_files:
+                self.fixtures = Fixtures.load(fixtures_file)
+                if self.fixtures is None:
+                    print("invalid fixtures file: " + fixtures_file)
+                    sys.exit(EXIT_CONFIG_ERROR)
+            if csv_report_file != "" and not self.explain_selection and chain_files:
+                self.csv_report = CsvReport(csv_report_file)
+            if otlp_endpoint != "" and not self.explain_selection:
+                self.tracer = Tracer(otlp_endpoint, self.net)
+            if resume_file != "" and chain_files:
+                self.checkpoint = Checkpoint.load(resume_file, checkpoint_every)
+                if self.checkpoint is None:
+                    print("invalid checkpoint file: " + resume_file)
+                    sys.exit(EXIT_CONFIG_ERROR)
+                if checkpoint_file != "":
+                    self.checkpoint.name = checkpoint_file
+            elif checkpoint_file != "" and chain_files:
+                self.checkpoint = Checkpoint(checkpoint_file, checkpoint_every, {})
+            if request_rules_file != "":
+                self.request_rules = RequestRules.load(request_rules_file, tests_on_latest_block)
+                if self.request_rules is None:
+                    print("request rules file not found or invalid")
+                    sys.exit(EXIT_CONFIG_ERROR)
+            if unique_ids != "":
+                if self.request_rules is None:
+                    self.request_rules = RequestRules({}, tests_on_latest_block)
+                self.request_rules.renumber_ids = True if unique_ids == UNIQUE_IDS_ALL else unique_ids.split(",")
+            if self.request_rules is not None:
+                self.request_rules.select_transport(get_transport(self))
+            if print_config:
+                print(yaml.safe_dump(get_effective_config(opts), sort_keys=False, default_flow_style=False), end="")
+                sys.exit(0)
+
+        except getopt.GetoptError as err:
+            # print help information and exit:
+            print(err)
+            usage(argv)
+            sys.exit(EXIT_CONFIG_ERROR)
 
 
 #
@@ -540,158 +4091,341 @@ def usage(argv):
 def main(argv):
     """ parse command line and execute tests
     """
-    exit_on_fail = True
-    daemon_under_test = SILK
-    daemon_as_reference = RPCDAEMON
-    loop_number = 1
-    verbose_level = 0
-    req_test = -1
-    dump_output = False
-    infura_url = ""
-    daemon_on_host = "localhost"
-    daemon_on_port = 0
-    requested_apis = ""
-    verify_with_daemon = False
-    net = "goerly"
-    json_dir = "./" + net + "/"
-    results_dir = "results"
-    output_dir = json_dir + results_dir + "/"
-    exclude_api_list = ""
-    exclude_test_list = ""
-    start_test = ""
-    jwt_secret = ""
-    display_only_fail = 0
+    config = Config(argv)
 
-    try:
-        opts, _ = getopt.getopt(argv[1:], "hfrcv:t:l:a:di:b:ox:X:H:k:s:p:")
-        for option, optarg in opts:
-            if option in ("-h", "--help"):
-                usage(argv)
-                sys.exit(-1)
-            elif option == "-c":
-                exit_on_fail = 0
-            elif option == "-r":
-                daemon_under_test = RPCDAEMON
-            elif option == "-i":
-                daemon_as_reference = INFURA
-                infura_url = optarg
-            elif option == "-H":
-                daemon_on_host = optarg
-            elif option == "-p":
-                daemon_on_port = int(optarg)
-            elif option == "-f":
-                display_only_fail = 1
-            elif option == "-v":
-                verbose_level = int(optarg)
-            elif option == "-t":
-                req_test = int(optarg)
-            elif option == "-s":
-                start_test = int(optarg)
-            elif option == "-a":
-                requested_apis = optarg
-            elif option == "-l":
-                loop_number = int(optarg)
-            elif option == "-d":
-                verify_with_daemon = 1
-            elif option == "-o":
-                dump_output = 1
-            elif option == "-b":
-                net = optarg
-                json_dir = "./" + net + "/"
-                output_dir = json_dir + results_dir + "/"
-            elif option == "-x":
-                exclude_api_list = optarg
-            elif option == "-X":
-                exclude_test_list = optarg
-            elif option == "-k":
-                jwt_secret = get_jwt_secret(optarg)
-                if jwt_secret == "":
-                    print("secret file not found")
-                    sys.exit(-1)
-            else:
-                usage(argv)
-                sys.exit(-1)
+    if "," in config.net:
+        sys.exit(run_multi_chain(argv, config))
+
+    if config.explain_selection:
+        explain_selection(config)
+        sys.exit(0)
+
+    if os.path.exists(config.output_dir):
+        shutil.rmtree(config.output_dir)
+
+    if config.docker_image != "":
+        docker_node = DockerNode(config.docker_image, config.docker_datadir, config.jwt_file, config.net,
+                                 config.daemon_on_host, config.daemon_on_port)
+        atexit.register(docker_node.stop)
+        docker_node.start()
 
-    except getopt.GetoptError as err:
-        # print help information and exit:
-        print(err)
-        usage(argv)
-        sys.exit(-1)
+    not_ready = run_preflight(config)
+    if len(not_ready) > 0:
+        print("daemon not ready: " + ", ".join(f"{name.lower()} {reason}" for name, reason in not_ready.items()) + ": Test Aborted!")
+        sys.exit(EXIT_TRANSPORT_FAILURES)
 
-    if os.path.exists(output_dir):
-        shutil.rmtree(output_dir)
+    if config.verify_with_daemon and config.reference_client == "":
+        reference_target = get_target(config.daemon_as_reference, "web3_clientVersion", config.infura_url, config.daemon_on_host,
+                                      config.daemon_on_port)
+        if config.daemon_as_reference != INFURA:
+            reference_target = config.scheme + reference_target
+        config.reference_client = detect_client(config, reference_target, True)
+        print("Reference client: " + (config.reference_client if config.reference_client != "" else "unknown"))
+    if config.verify_with_daemon and config.reference_client in client_profiles:
+        # namespaces not supported by the reference client skipped as excluded (-x)
+        config.exclude_api_list = ",".join([api for api in config.exclude_api_list.split(",") if api != ""] +
+                                           client_profiles[config.reference_client]["skip_namespaces"])
+
+    if config.checkpoint is not None:
+        atexit.register(config.checkpoint.save)
+    if config.csv_report is not None:
+        atexit.register(config.csv_report.close)
+    if config.tracer is not None:
+        atexit.register(config.tracer.close)
+    if config.fixtures is not None or config.record_fixtures is not None:
+        head_height = get_head_height(config)
+        if head_height is None:
+            print("head block number of the daemon under test not available")
+            sys.exit(EXIT_TRANSPORT_FAILURES)
+        if config.record_fixtures is not None:
+            config.record_fixtures.block_height = head_height
+            atexit.register(config.record_fixtures.save)
+        if config.fixtures is not None:
+            config.fixtures.head_matches = head_height == config.fixtures.block_height
+            print(f"Fixtures block height: {config.fixtures.block_height}, target head: {head_height}" +
+                  ("" if config.fixtures.head_matches else f" ({config.fixture_pinning} the head sensitive tests)"))
+
+    if config.chaos is not None:
+        # printed before the run, so that the faults of an aborted run can be replayed too
+        seed = config.seed if config.seed is not None else random.randrange(2 ** 32)
+        config.chaos.random.seed(seed)
+        print(f"Chaos seed: {seed}")
 
     start_time = time.time()
-    os.mkdir(output_dir)
+    os.makedirs(config.output_dir)
+    if config.results_retention is not None:
+        results_dir = config.json_dir + config.results_dir
+        link_latest_results(results_dir, config.run_id)
+        stale_run_ids = prune_results(results_dir, *config.results_retention, config.run_id)
+        print(f"Results: {config.output_dir.rstrip('/')}" + (f" ({len(stale_run_ids)} stale runs removed)" if len(stale_run_ids) > 0 else ""))
+    config.failure_manifest = FailureManifest(config.output_dir + FAILURE_MANIFEST_FILE, config.net, config.node_states)
+    atexit.register(config.failure_manifest.save)
     match = 0
     executed_tests = 0
     failed_tests = 0
     success_tests = 0
     tests_not_executed = 0
+    resumed_tests = 0
+    slow_tests = []
+    test_timings = {}
+    test_outcomes = {}
+    latency_samples = {}
+    compression_checks = {}
     global_test_number = 1
-    for test_rep in range(0, loop_number):
-        if verbose_level:
+    if config.body_limit > 0:
+        executed_tests = executed_tests + 1
+        if run_body_limit_test(config) == 0:
+            success_tests = success_tests + 1
+        else:
+            failed_tests = failed_tests + 1
+            config.failure_manifest.record(config, config.net + "/body-limit", 0)
+            if config.exit_on_fail:
+                print("TEST ABORTED!")
+                sys.exit(config.failure_manifest.get_exit_code())
+    test_catalog = get_test_catalog(config)
+    test_dependencies = get_test_dependencies(config, test_catalog)
+    test_schedule = get_test_schedule(test_catalog, test_dependencies)
+    test_count = sum(len(test_lists) for _, test_lists in test_catalog)
+    selection_rules = get_selection_rules(config)
+    for test_rep in range(0, config.loop_number):
+        if config.verbose_level:
             print("Test iteration: ", test_rep + 1)
-        dirs = sorted(os.listdir(json_dir))
-        for api_file in dirs:
-            # jump result_dir
-            if api_file == results_dir:
-                continue
-            test_dir = json_dir + api_file
-            test_lists = sorted(os.listdir(test_dir))
-            test_number = 1
-            for test_name in test_lists:
-                if is_testing_apis(api_file, requested_apis):  # -a
-                    test_file = api_file + "/" + test_name
-                    if is_skipped(api_file, net, exclude_api_list, exclude_test_list, test_file, req_test,
-                                  verify_with_daemon, global_test_number) == 1:
-                        if start_test == "" or global_test_number >= int(start_test):
-                            if display_only_fail == 0:
-                                file = test_file.ljust(60)
-                                print(f"{global_test_number:03d}. {file} Skipped")
-                                tests_not_executed = tests_not_executed + 1
+        # the dependent tests run only if their dependencies passed (or were resumed) in the same loop
+        passed_tests = set()
+        for api_file, test_lists in test_schedule:
+            for test_name, catalog_test_number, test_number in test_lists:
+                global_test_number = test_rep * test_count + catalog_test_number
+                test_file = api_file + "/" + test_name
+                selection, reason = select_test(selection_rules, api_file, test_file, global_test_number, test_number)
+                not_passed = [dependency for dependency in test_dependencies.get(test_file, []) if dependency not in passed_tests]
+                if selection == SELECTION_RUN and len(not_passed) > 0:
+                    selection, reason = SELECTION_DEPENDENCY_NOT_PASSED, "dependency " + ", ".join(not_passed) + " not passed"
+                if selection in (SELECTION_SKIPPED, SELECTION_HEAD_SENSITIVE, SELECTION_DEPENDENCY_NOT_PASSED):
+                    if config.display_only_fail == 0:
+                        file = test_file.ljust(60)
+                        print(f"{global_test_number:03d}. {file} Skipped" +
+                              (f" ({reason})" if selection in (SELECTION_HEAD_SENSITIVE, SELECTION_DEPENDENCY_NOT_PASSED) else ""))
+                        tests_not_executed = tests_not_executed + 1
+                    elif selection == SELECTION_HEAD_SENSITIVE:
+                        # counted as not executed even if not displayed
+                        tests_not_executed = tests_not_executed + 1
+                    if config.csv_report is not None:
+                        config.csv_report.write(config.net + "/" + test_file, global_test_number, get_transport(config), "skipped", {})
+                elif selection == SELECTION_RESUMED:
+                    if config.display_only_fail == 0:
+                        file = test_file.ljust(60)
+                        print(f"{global_test_number:03d}. {file} Skipped ({reason})")
+                    resumed_tests = resumed_tests + 1
+                    passed_tests.add(test_file)
+                    if config.csv_report is not None:
+                        config.csv_report.write(config.net + "/" + test_file, global_test_number, get_transport(config), "resumed", {})
+                elif selection == SELECTION_RUN:
+                    file = test_file.ljust(60)
+                    if config.method_filter != "":
+                        # the actual methods, they may differ from the API directory name
+                        file = (test_file + " [" + ",".join(get_test_methods(config, test_file)) + "]").ljust(60)
+                    if config.verbose_level:
+                        print(f"{global_test_number:03d}. {file} ", end='', flush=True)
+                    elif sys.stdout.isatty():
+                        # progress overwritten by the next test, not in CI logs or chain sessions (piped output)
+                        print(f"{global_test_number:03d}. {file}\r", end='', flush=True)
+                    config.test_metrics = {}
+                    if config.daemon_log is not None:
+                        config.daemon_log.mark()
+                    test_start_time = time.time()
+                    test_full_name = config.net + "/" + test_file
+                    if config.tracer is not None:
+                        config.tracer.start_test(test_full_name, global_test_number)
+                    try:
+                        ret = run_tests(config, test_file, global_test_number)
+                    except SystemExit:
+                        # test aborted on failure (no -c): the exit code by its failure class
+                        if "failure_class" not in config.test_metrics:
+                            raise
+                        config.failure_manifest.record(config, test_full_name, global_test_number, test_file)
+                        sys.exit(config.failure_manifest.get_exit_code())
+                    test_duration = time.time() - test_start_time
+                    if ret != 0 and config.daemon_log is not None:
+                        config.daemon_log.attach(config, test_file, test_start_time, time.time())
+                    if ret != 0:
+                        config.failure_manifest.record(config, test_full_name, global_test_number, test_file)
+                    if config.samples > 0:
+                        trace_phase(config, "samples")
+                    samples = sample_latency(config, test_file, config.samples) if config.samples > 0 else []
+                    if len(samples) > 0:
+                        # the latency of the test aggregated over the samples, the compared run as warm-up
+                        latency_samples.setdefault(test_full_name, []).extend(samples)
+                        test_duration = get_percentile(samples, 50)
+                        test_timings.setdefault(test_full_name, []).extend(samples)
+                    else:
+                        test_timings.setdefault(test_full_name, []).append(test_duration)
+                    if config.compression_check:
+                        trace_phase(config, "compression check")
+                    compression_problems = check_compression(config, test_file) if config.compression_check else []
+                    for method, problem in compression_problems:
+                        checks = compression_checks.setdefault(method, dict.fromkeys(["requests"] + COMPRESSION_PROBLEMS, 0))
+                        checks["requests"] = checks["requests"] + 1
+                        if problem != "":
+                            checks[problem] = checks[problem] + 1
+                    problems = sorted({method + ": " + problem for method, problem in compression_problems if problem != ""})
+                    if len(problems) > 0:
+                        print(f"{global_test_number:03d}. {file} COMPRESSION ({', '.join(problems)})")
+                    test_outcomes.setdefault(test_full_name, []).append(ret)
+                    if config.tracer is not None:
+                        config.tracer.end_test("pass" if ret == 0 else "fail", config.test_metrics)
+                    if config.checkpoint is not None:
+                        config.checkpoint.record(test_full_name, ret)
+                    if config.csv_report is not None:
+                        config.csv_report.write(test_full_name, global_test_number, get_transport(config), "pass" if ret == 0 else "fail",
+                                                config.test_metrics)
+                    if is_slow(test_full_name, test_duration, config.timing_baseline, config.slow_factor):
+                        print(f"{global_test_number:03d}. {file} SLOW ({test_duration:.3f} secs, "
+                              f"baseline {float(config.timing_baseline[test_full_name]):.3f} secs)")
+                        slow_tests.append(test_file)
+                    if ret == 0:
+                        success_tests = success_tests + 1
+                        passed_tests.add(test_file)
                     else:
-                        # runs all tests req_test refers global test number or
-                        # runs only tests on specific api req_test refers all test on specific api
-                        if ((requested_apis == "" and req_test in (-1, global_test_number)) or
-                                (requested_apis != "" and req_test in (-1, test_number))):
-                            if (start_test == "") or (start_test != "" and global_test_number >= int(start_test)):
-                                file = test_file.ljust(60)
-                                if verbose_level:
-                                    print(f"{global_test_number:03d}. {file} ", end='', flush=True)
-                                else:
-                                    print(f"{global_test_number:03d}. {file}\r", end='', flush=True)
-                                ret = run_tests(net, json_dir, output_dir, test_file, verbose_level, daemon_under_test,
-                                                exit_on_fail, verify_with_daemon, daemon_as_reference,
-                                                dump_output, global_test_number, infura_url, daemon_on_host,
-                                                daemon_on_port, jwt_secret)
-                                if ret == 0:
-                                    success_tests = success_tests + 1
-                                else:
-                                    failed_tests = failed_tests + 1
-                                executed_tests = executed_tests + 1
-                                if req_test != -1 or requested_apis != "":
-                                    match = 1
-
-                global_test_number = global_test_number + 1
-                test_number = test_number + 1
-
-    if (req_test != -1 or requested_apis != "") and match == 0:
+                        failed_tests = failed_tests + 1
+                    executed_tests = executed_tests + 1
+                    if config.req_test != -1 or config.requested_apis != "" or config.run_addresses != "":
+                        match = 1
+
+    if (config.req_test != -1 or config.requested_apis != "" or config.run_addresses != "") and match == 0:
         print("ERROR: api or testNumber not found")
+        sys.exit(EXIT_CONFIG_ERROR)
     else:
         end_time = time.time()
         elapsed = end_time - start_time
-        print("                                                                                    \r")
+        print("                                                                                    \r" if sys.stdout.isatty() else "")
         print(f"Test time-elapsed (secs):     {int(elapsed)}")
-        print(f"Number of executed tests:     {executed_tests}/{global_test_number - 1}")
+        print(f"Number of executed tests:     {executed_tests}/{config.loop_number * test_count}")
         print(f"Number of NOT executed tests: {tests_not_executed}")
         print(f"Number of success tests:      {success_tests}")
         print(f"Number of failed tests:       {failed_tests}")
+        if resumed_tests > 0:
+            print(f"Number of resumed tests:      {resumed_tests}")
+        if config.timing_baseline is not None:
+            print(f"Number of slow tests:         {len(slow_tests)}")
+            for slow_test in slow_tests:
+                print(f"    {slow_test}")
+        if config.byte_metrics is not None:
+            print("Byte metrics per API (average bytes of request headers/body, response headers/body/decompressed, max):")
+            for api_name, metrics in config.byte_metrics.get_report().items():
+                print(f"    {api_name.ljust(40)} {metrics['tests']:4d} tests {metrics['request_headers']:6d} {metrics['request_body']:8d} "
+                      f"{metrics['response_headers']:6d} {metrics['response_body']:10d} {metrics['response_decompressed']:10d} "
+                      f"{metrics['response_max']:10d}")
+        if config.connection_metrics is not None:
+            print("Connection metrics per API (new/reused connections, average ms of DNS, TCP, TLS, server, transfer):")
+            for api_name, metrics in config.connection_metrics.get_report().items():
+                print(f"    {api_name.ljust(40)} {metrics['tests']:4d} tests {metrics['new_connections']:4d}/{metrics['reused_connections']:<4d} "
+                      f"{metrics['dns_ms']:8.3f} {metrics['tcp_ms']:8.3f} {metrics['tls_ms']:8.3f} {metrics['server_ms']:8.3f} "
+                      f"{metrics['transfer_ms']:8.3f}")
+        if len(latency_samples) > 0:
+            print(f"Latency samples per test ({config.samples} samples, p50/p95):")
+            for test_full_name, samples in latency_samples.items():
+                print(f"    {test_full_name.ljust(60)} {get_percentile(samples, 50):.3f} / {get_percentile(samples, 95):.3f} secs")
+        if len(compression_checks) > 0:
+            print("Compression check per method (requests, " + ", ".join(COMPRESSION_PROBLEMS) + "):")
+            for method, checks in sorted(compression_checks.items()):
+                problem_counts = [checks[problem] for problem in COMPRESSION_PROBLEMS]
+                print(f"    {method.ljust(40)} {checks['requests']:4d} " + " ".join(f"{count:4d}" for count in problem_counts) +
+                      (" OK" if sum(problem_counts) == 0 else ""))
+        if config.verify_with_daemon:
+            for endpoint, round_trip_times in sorted(config.endpoint_round_trip_times.items(), reverse=True):
+                print(f"Round trip time {endpoint.ljust(9)} avg {sum(round_trip_times) / len(round_trip_times):.3f} secs, "
+                      f"p95 {get_percentile(round_trip_times, 95):.3f} secs")
+        if config.reference_limiter is not None:
+            print(f"Reference throttled time:     {config.reference_limiter.throttled_time:.3f} secs "
+                  f"({config.reference_limiter.rate_limited_requests} rate limited requests)")
+        if len(config.diff_timings) > 0:
+            print("Diff time per tool:")
+            for diff_tool, (diffs, diff_time) in sorted(config.diff_timings.items()):
+                print(f"    {diff_tool.ljust(40)} {diffs:4d} diffs {diff_time:.3f} secs")
+        if len(config.failure_classes) > 0:
+            print("Failure classes:")
+            for failure_class, count in sorted(config.failure_classes.items(), key=lambda item: (-item[1], item[0])):
+                print(f"    {failure_class.ljust(40)} {count}")
+        if config.chaos is not None:
+            chaos_report = config.chaos.get_report()
+            print(f"Chaos faults injected:        {chaos_report['delayed_requests']} delayed requests "
+                  f"(avg {chaos_report['avg_delay'] * 1000:.0f} ms), {chaos_report['dropped_connections']} connections reset, "
+                  f"{chaos_report['duplicated_requests']} duplicated requests ({chaos_report['duplicate_mismatches']} mismatching)")
+        sla_failures = 0
+        if config.sla is not None:
+            for method, percentile, measured, latency in check_sla(config.sla, test_timings):
+                outcome = "PASS" if measured <= latency else "FAIL"
+                print(f"SLA {method} p{percentile:g}: {measured:.3f} secs (target {latency:.3f} secs) {outcome}")
+                sla_failures = sla_failures + (1 if outcome == "FAIL" else 0)
+        if config.save_timings_file != "":
+            save_timings(config.save_timings_file, test_timings)
+        if config.perf_history_file != "":
+            perf_metrics = get_perf_metrics(test_timings, config.parse_time)
+            history = [run for run in load_perf_history(config.perf_history_file) if run.get("net") == config.net]
+            if config.perf_trend_runs > 0:
+                print_perf_trend(perf_metrics, history, config.perf_trend_runs)
+            with open(config.perf_history_file, 'a', encoding='utf8') as file:
+                file.write(json.dumps({"time": int(start_time), "net": config.net, "executed": executed_tests, **perf_metrics,
+                                       "nodes": config.node_states}) + "\n")
+        if config.loop_number > 1:
+            stable_pass, stable_fail, flaky = classify_outcomes(test_outcomes)
+            print(f"Number of stable-pass tests:  {len(stable_pass)}")
+            print(f"Number of stable-fail tests:  {len(stable_fail)}")
+            print(f"Number of FLAKY tests:        {len(flaky)}")
+            for flaky_test in flaky:
+                outcomes = "".join("." if outcome == 0 else "F" for outcome in test_outcomes[flaky_test])
+                print(f"    {flaky_test} [{outcomes}]")
+            if config.quarantine_flaky_file != "":
+                with open(config.quarantine_flaky_file, 'w', encoding='utf8') as quarantine_file:
+                    for flaky_test in flaky:
+                        quarantine_file.write(flaky_test + "\n")
+        summary = {
+            "net": config.net,
+            "executed": executed_tests,
+            "failed": failed_tests,
+            "failed_tests": sorted(name for name, outcomes in test_outcomes.items() if any(outcome != 0 for outcome in outcomes)),
+            "results": config.output_dir.rstrip("/"),
+            "nodes": config.node_states,
+        }
+        if config.verify_with_daemon:
+            summary["round_trip_times"] = {endpoint: {"avg": sum(round_trip_times) / len(round_trip_times),
+                                                      "p95": get_percentile(round_trip_times, 95)}
+                                           for endpoint, round_trip_times in config.endpoint_round_trip_times.items()}
+        summary["failure_classes"] = config.failure_classes
+        if len(latency_samples) > 0:
+            summary["latency_samples"] = {test_full_name: {"p50": get_percentile(samples, 50), "p95": get_percentile(samples, 95)}
+                                          for test_full_name, samples in latency_samples.items()}
+        if len(compression_checks) > 0:
+            summary["compression_check"] = compression_checks
+        summary["diff_timings"] = {diff_tool: {"diffs": diffs, "secs": diff_time}
+                                   for diff_tool, (diffs, diff_time) in config.diff_timings.items()}
+        if config.chaos is not None:
+            summary["chaos"] = config.chaos.get_report()
+        if config.byte_metrics is not None:
+            summary["byte_metrics"] = config.byte_metrics.get_report()
+        if config.connection_metrics is not None:
+            summary["connection_metrics"] = config.connection_metrics.get_report()
+        summary["exit_code"] = config.failure_manifest.get_exit_code()
+        for sink in get_result_sinks(config):
+            sink.publish(summary)
+        config.failure_manifest.complete()
+        print(f"Failure manifest:             {config.failure_manifest.name} (exit code {summary['exit_code']})")
+        if config.fail_on_slow and len(slow_tests) > 0:
+            sys.exit(EXIT_CONTENT_FAILURES)
+        if config.enforce_sla and sla_failures > 0:
+            sys.exit(EXIT_CONTENT_FAILURES)
+        sys.exit(summary["exit_code"])
 
 
 #
 # module as main
 #
 if __name__ == "__main__":
-    main(sys.argv)
-    sys.exit(0)
+    try:
+        main(sys.argv)
+    except KeyboardInterrupt:
+        exit_on_interrupt()
+    except Exception:  # pylint: disable=broad-except
+        traceback.print_exc()
+        sys.exit(EXIT_INTERNAL_ERROR)
+    sys.exit(EXIT_SUCCESS)
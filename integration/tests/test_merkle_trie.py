@@ -0,0 +1,95 @@
+""" Unit tests of the Merkle Patricia trie root of merkle_trie.py (vectors of the ethereum/tests trie tests) """
+
+import os
+import sys
+import unittest
+
+sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+import merkle_trie  # pylint: disable=wrong-import-position
+from web3 import Web3  # pylint: disable=wrong-import-position,wrong-import-order
+
+
+def get_root(pairs):
+    """ return the hex root of the trie of the key-value pairs """
+    entries = [(merkle_trie.to_nibbles(key.encode()), value.encode()) for key, value in pairs.items()]
+    return bytes(Web3.keccak(merkle_trie.rlp_encode(merkle_trie.build_node(entries)))).hex()
+
+
+def get_proof(entries, nibbles, proof, root=True):
+    """ append to proof the nodes from the root of the trie of the entries along the path of nibbles, as eth_getProof """
+    node = merkle_trie.build_node(entries)
+    encoded = merkle_trie.rlp_encode(node)
+    if root or len(encoded) >= 32:
+        proof.append(encoded)
+    if len(entries) == 1:
+        return proof
+    if len(node) == 2:
+        prefix, _ = merkle_trie.decode_path(node[0])
+        if nibbles[:len(prefix)] == prefix:
+            get_proof([(key[len(prefix):], value) for key, value in entries], nibbles[len(prefix):], proof, False)
+        return proof
+    children = [(key[1:], value) for key, value in entries if len(key) > 0 and len(nibbles) > 0 and key[0] == nibbles[0]]
+    if len(children) > 0:
+        get_proof(children, nibbles[1:], proof, False)
+    return proof
+
+
+def get_secure_entries(pairs):
+    """ return the entries of the secure trie (keys hashed) of the key-value pairs """
+    return [(merkle_trie.to_nibbles(bytes(Web3.keccak(key))), value) for key, value in pairs.items()]
+
+
+class MerkleTrieTest(unittest.TestCase):
+    """ Roots of the tries: leaves, extensions, branches and embedded nodes """
+
+    def test_dogs(self):
+        """ extension, branch with value and embedded leaves """
+        self.assertEqual(get_root({"doe": "reindeer", "dog": "puppy", "dogglesworth": "cat"}),
+                         "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3")
+
+    def test_puppy(self):
+        """ the root does not depend on the order of insertion """
+        self.assertEqual(get_root({"do": "verb", "horse": "stallion", "doge": "coin", "dog": "puppy"}),
+                         "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84")
+
+    def test_ordered_root(self):
+        """ the empty list has the empty trie root, the items are keyed by the RLP of their index """
+        self.assertEqual(merkle_trie.get_trie_root([]), merkle_trie.EMPTY_TRIE_ROOT)
+        self.assertEqual(merkle_trie.EMPTY_TRIE_ROOT, bytes(Web3.keccak(merkle_trie.rlp_encode(b""))))
+        items = [bytes([index]) * 40 for index in range(200)]
+        entries = [(merkle_trie.to_nibbles(merkle_trie.rlp_encode(index)), item) for index, item in enumerate(items)]
+        self.assertEqual(merkle_trie.get_trie_root(items), bytes(Web3.keccak(merkle_trie.rlp_encode(merkle_trie.build_node(entries)))))
+
+    def test_proof(self):
+        """ the values of the keys present are proven, the keys absent are proven missing """
+        pairs = {bytes([index]) * 20: merkle_trie.rlp_encode([index, index * 1000, b"\x01" * 32]) for index in range(64)}
+        pairs[b"\xee" * 20] = b"\x01"
+        entries = get_secure_entries(pairs)
+        root = bytes(Web3.keccak(merkle_trie.rlp_encode(merkle_trie.build_node(entries))))
+        for key in list(pairs) + [b"\xff" * 20]:
+            proof = get_proof(entries, merkle_trie.to_nibbles(bytes(Web3.keccak(key))), [])
+            self.assertEqual(merkle_trie.get_proof_value(root, key, proof), pairs.get(key))
+
+    def test_proof_invalid(self):
+        """ the tampered, truncated and extended proofs are rejected """
+        pairs = {bytes([index]) * 32: merkle_trie.rlp_encode(index + 1) for index in range(16)}
+        entries = get_secure_entries(pairs)
+        root = bytes(Web3.keccak(merkle_trie.rlp_encode(merkle_trie.build_node(entries))))
+        key = bytes([3]) * 32
+        proof = get_proof(entries, merkle_trie.to_nibbles(bytes(Web3.keccak(key))), [])
+        tampered = proof[:-1] + [proof[-1][:-1] + bytes([proof[-1][-1] ^ 1])]
+        for invalid in (tampered, proof[:-1], proof + [proof[-1]]):
+            with self.assertRaises(ValueError):
+                merkle_trie.get_proof_value(root, key, invalid)
+        with self.assertRaises(ValueError):
+            merkle_trie.get_proof_value(b"\x00" * 32, key, proof)
+
+    def test_proof_empty_trie(self):
+        """ the keys of the empty trie are proven missing by no node or by the empty root node """
+        self.assertIsNone(merkle_trie.get_proof_value(merkle_trie.EMPTY_TRIE_ROOT, b"\x01" * 32, []))
+        self.assertIsNone(merkle_trie.get_proof_value(merkle_trie.EMPTY_TRIE_ROOT, b"\x01" * 32, [b"\x80"]))
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,83 @@
+""" Unit tests of the RLP encoding and decoding of rlp_codec.py """
+
+import os
+import sys
+import unittest
+
+sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+import rlp_codec  # pylint: disable=wrong-import-position
+
+
+# encodings of the RLP specification examples
+SPEC_EXAMPLES = [
+    (b"dog", "83646f67"),
+    ([b"cat", b"dog"], "c88363617483646f67"),
+    (b"", "80"),
+    ([], "c0"),
+    (0, "80"),
+    (b"\x00", "00"),
+    (15, "0f"),
+    (1024, "820400"),
+    ([[], [[]], [[], [[]]]], "c7c0c1c0c3c0c1c0"),
+    (b"Lorem ipsum dolor sit amet, consectetur adipisicing elit", "b838" + b"Lorem ipsum dolor sit amet, consectetur adipisicing elit".hex()),
+]
+ACCESS_LIST = [{"address": "0x" + "11" * 20, "storageKeys": ["0x" + "00" * 31 + "01"]}]
+
+
+class RlpCodecTest(unittest.TestCase):
+    """ Encoding and decoding of the RLP items and of the transaction envelopes """
+
+    def test_encode(self):
+        """ the items are encoded as in the specification examples """
+        for item, encoding in SPEC_EXAMPLES:
+            self.assertEqual(rlp_codec.rlp_encode(item).hex(), encoding)
+
+    def test_decode(self):
+        """ the decoding of the encoding gives back the item, the integers as big endian bytes """
+        for item, encoding in SPEC_EXAMPLES:
+            expected = rlp_codec.encode_uint(item) if isinstance(item, int) else item
+            self.assertEqual(rlp_codec.rlp_decode(bytes.fromhex(encoding)), expected)
+
+    def test_decode_malformed(self):
+        """ truncated items, list length mismatches and trailing bytes are rejected """
+        for encoding in ["83646f", "c88363617483646f", "c3836361", "83646f6700", ""]:
+            with self.assertRaises(ValueError):
+                rlp_codec.rlp_decode(bytes.fromhex(encoding))
+
+    def test_encode_transaction(self):
+        """ the JSON transactions of each type are encoded into their envelope and decoded back """
+        common = {"nonce": "0x1", "gas": "0x5208", "to": "0x" + "22" * 20, "value": "0xde0b6b3a7640000", "input": "0x",
+                  "r": "0x" + "33" * 32, "s": "0x" + "44" * 32}
+        transactions = [
+            dict(common, type="0x0", gasPrice="0x3b9aca00", v="0x25"),
+            dict(common, type="0x1", chainId="0x1", gasPrice="0x3b9aca00", accessList=ACCESS_LIST, v="0x1"),
+            dict(common, type="0x2", chainId="0x1", maxPriorityFeePerGas="0x1", maxFeePerGas="0x2", accessList=[], yParity="0x0"),
+            dict(common, type="0x3", chainId="0x1", maxPriorityFeePerGas="0x1", maxFeePerGas="0x2", accessList=[],
+                 maxFeePerBlobGas="0x3", blobVersionedHashes=["0x01" + "55" * 31], yParity="0x1"),
+            dict(common, type="0x4", chainId="0x1", maxPriorityFeePerGas="0x1", maxFeePerGas="0x2", accessList=[],
+                 authorizationList=[{"chainId": "0x1", "address": "0x" + "66" * 20, "nonce": "0x0", "yParity": "0x1",
+                                     "r": "0x7", "s": "0x8"}], yParity="0x1"),
+        ]
+        for transaction in transactions:
+            raw = rlp_codec.encode_transaction(transaction)
+            transaction_type, items = rlp_codec.decode_transaction_envelope(raw)
+            self.assertEqual(transaction_type, int(transaction["type"], 16))
+            self.assertEqual(rlp_codec.encode_transaction_envelope(transaction_type, items), raw)
+            self.assertEqual(items[-1], bytes.fromhex("44" * 32))
+        # contract creation: empty destination
+        raw = rlp_codec.encode_transaction(dict(transactions[0], to=None))
+        self.assertEqual(rlp_codec.decode_transaction_envelope(raw)[1][3], b"")
+
+    def test_decode_transaction_unsupported(self):
+        """ unknown types and wrong numbers of fields are rejected """
+        with self.assertRaises(ValueError):
+            rlp_codec.decode_transaction_envelope(bytes([0x05]) + rlp_codec.rlp_encode([]))
+        with self.assertRaises(ValueError):
+            rlp_codec.decode_transaction_envelope(bytes([0x02]) + rlp_codec.rlp_encode([b"\x01"]))
+        with self.assertRaises(ValueError):
+            rlp_codec.encode_transaction({"type": "0x7f"})
+
+
+if __name__ == '__main__':
+    unittest.main()
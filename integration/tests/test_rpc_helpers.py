@@ -0,0 +1,110 @@
+""" Unit tests of the command line and block range helpers shared by the scripts (rpc_helpers.py) """
+
+import os
+import shutil
+import sys
+import tempfile
+import unittest
+from unittest import mock
+
+sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+import rpc_helpers  # pylint: disable=wrong-import-position
+from rpc_helpers import ScriptOptions  # pylint: disable=wrong-import-position
+
+
+def parse(count: int, args):
+    """ return the options parsed from the (option, optarg) pairs """
+    options = ScriptOptions(count)
+    for option, optarg in args:
+        if not options.parse_target(option, optarg) and not options.parse_range(option, optarg):
+            raise ValueError(option)
+    return options
+
+
+class ScriptOptionsTest(unittest.TestCase):
+    """ Node address and block range of the common options """
+
+    def test_target(self):
+        """ default and given node, other port (e.g. Engine API) """
+        self.assertEqual(parse(0, []).get_target(), "localhost:8545")
+        options = parse(0, [("-H", "10.10.2.3"), ("-p", "8546")])
+        self.assertEqual(options.get_target(), "10.10.2.3:8546")
+        self.assertEqual(options.get_target(8551), "10.10.2.3:8551")
+
+    def test_not_common_option(self):
+        """ options of the scripts left to them """
+        self.assertFalse(ScriptOptions().parse_target("-s", "1"))
+        self.assertFalse(ScriptOptions().parse_range("-H", "localhost"))
+
+    def test_given_range(self):
+        """ given first block, hex or decimal, no latest block needed """
+        with mock.patch.object(rpc_helpers, "get_latest_block", side_effect=AssertionError):
+            self.assertEqual(parse(16, [("-s", "0x10")]).get_block_range(), (16, 16))
+            self.assertEqual(parse(16, [("-s", "5"), ("-n", "3")]).get_block_range(), (5, 3))
+
+    def test_latest_blocks(self):
+        """ latest blocks by default, bounded by the genesis or the given minimum block """
+        with mock.patch.object(rpc_helpers, "get_latest_block", return_value=100):
+            self.assertEqual(parse(16, []).get_block_range(), (85, 16))
+        with mock.patch.object(rpc_helpers, "get_latest_block", return_value=5):
+            self.assertEqual(parse(16, []).get_block_range(), (0, 6))
+            self.assertEqual(parse(16, []).get_block_range(min_block=1), (1, 5))
+
+    def test_follow(self):
+        """ only the new blocks if following the chain without range, the range otherwise """
+        with mock.patch.object(rpc_helpers, "get_latest_block", return_value=100):
+            self.assertEqual(parse(16, []).get_block_range(True), (101, 0))
+            self.assertEqual(parse(16, [("-s", "90"), ("-n", "4")]).get_block_range(True), (90, 4))
+
+    def test_latest_block_not_available(self):
+        """ exit if the latest block is needed but not available """
+        with mock.patch.object(rpc_helpers, "get_latest_block", return_value=-1), mock.patch("builtins.print"):
+            with self.assertRaises(SystemExit) as context:
+                parse(16, []).get_block_range()
+        self.assertEqual(context.exception.code, 1)
+
+
+class FollowBlocksTest(unittest.TestCase):
+    """ Blocks yielded for the range and the new ones """
+
+    def test_range(self):
+        """ the range only if not following the chain """
+        with mock.patch.object(rpc_helpers, "get_latest_block", side_effect=AssertionError):
+            self.assertEqual(list(rpc_helpers.follow_blocks("localhost:8545", 3, 4, False, 0)), [3, 4, 5, 6])
+
+    def test_follow(self):
+        """ the new blocks as the latest one grows, polling when none """
+        latest_blocks = iter([7, 7, 9, 9])
+        with mock.patch.object(rpc_helpers, "get_latest_block", side_effect=lambda target: next(latest_blocks)), \
+                mock.patch.object(rpc_helpers.time, "sleep") as sleep:
+            blocks = rpc_helpers.follow_blocks("localhost:8545", 5, 2, True, 1)
+            self.assertEqual([next(blocks) for _ in range(5)], [5, 6, 7, 8, 9])
+        sleep.assert_called_once_with(1)
+
+
+class HelpersTest(unittest.TestCase):
+    """ Sampling of the transactions and numbering of the generated tests """
+
+    def test_sample_transactions(self):
+        """ evenly spaced, first and last included """
+        transactions = list(range(10))
+        self.assertEqual(rpc_helpers.sample_transactions(transactions, 20), transactions)
+        self.assertEqual(rpc_helpers.sample_transactions(transactions, 1), [0])
+        self.assertEqual(rpc_helpers.sample_transactions(transactions, 4), [0, 3, 6, 9])
+
+    def test_next_test_number(self):
+        """ number following the last test, first one if none """
+        test_dir = tempfile.mkdtemp()
+        try:
+            self.assertEqual(rpc_helpers.get_next_test_number(test_dir + "/missing"), 1)
+            for test_name in ("test_01.json", "test_07.json", "README.md"):
+                with open(os.path.join(test_dir, test_name), 'w', encoding='utf8'):
+                    pass
+            self.assertEqual(rpc_helpers.get_next_test_number(test_dir), 8)
+        finally:
+            shutil.rmtree(test_dir)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,153 @@
+""" Unit tests of the test selection rules of run_tests.py (select_test over get_selection_rules) """
+
+import json
+import os
+import shutil
+import sys
+import tempfile
+import unittest
+
+sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+import run_tests  # pylint: disable=wrong-import-position
+
+
+TEST_FILES = {
+    "eth_call/test_01.json": {"method": "eth_call", "params": [{}, "0x10"], "tags": ["slow"]},
+    "eth_call/test_02.json": {"method": "eth_call", "params": [{}, "0x10"]},
+    "eth_blockNumber/test_01.json": {"method": "eth_blockNumber", "params": []},
+    "eth_getBalance/test_01.json": {"method": "eth_getBalance", "params": ["0x0", "latest"]},
+}
+
+
+class SelectTestTest(unittest.TestCase):
+    """ Outcome of the selection of a test for the combinations of the selection options """
+
+    def setUp(self):
+        """ write the test files of the testnet chain into a temporary work dir """
+        self.cwd = os.getcwd()
+        self.work_dir = tempfile.mkdtemp()
+        os.chdir(self.work_dir)
+        for test_file, request in TEST_FILES.items():
+            os.makedirs(os.path.dirname("testnet/" + test_file), exist_ok=True)
+            json_rpc = {"request": {"jsonrpc": "2.0", "method": request["method"], "params": request["params"], "id": 1},
+                        "response": {"jsonrpc": "2.0", "id": 1, "result": "0x0"}}
+            if "tags" in request:
+                json_rpc["test"] = {"tags": request["tags"]}
+            with open("testnet/" + test_file, 'w', encoding='utf8') as file:
+                json.dump([json_rpc], file)
+
+    def tearDown(self):
+        """ remove the temporary work dir """
+        os.chdir(self.cwd)
+        shutil.rmtree(self.work_dir)
+
+    @staticmethod
+    def get_config(options):
+        """ return the run config of the command line options """
+        return run_tests.Config(["run_tests.py", "-b", "testnet"] + options)
+
+    @staticmethod
+    def select(config, test_file: str, global_test_number: int, test_number: int = 1):
+        """ return the selection outcome of the test """
+        api_name = test_file.split("/")[0]
+        return run_tests.select_test(run_tests.get_selection_rules(config), api_name, test_file, global_test_number, test_number)[0]
+
+    def test_selected_by_default(self):
+        """ all the tests run without selection options """
+        config = self.get_config([])
+        for global_test_number, test_file in enumerate(TEST_FILES, 1):
+            self.assertEqual(self.select(config, test_file, global_test_number), run_tests.SELECTION_RUN)
+
+    def test_requested_apis(self):
+        """ -a selects the APIs matching any of the list """
+        config = self.get_config(["-a", "eth_call,eth_getBal"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_getBalance/test_01.json", 4), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_blockNumber/test_01.json", 3), run_tests.SELECTION_NOT_SELECTED)
+
+    def test_excluded_api(self):
+        """ -x skips the API, the APIs not requested by -a are not selected at all """
+        config = self.get_config(["-x", "eth_call"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_SKIPPED)
+        self.assertEqual(self.select(config, "eth_getBalance/test_01.json", 4), run_tests.SELECTION_RUN)
+        config = self.get_config(["-a", "eth_getBalance", "-x", "eth_call"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_NOT_SELECTED)
+        config = self.get_config(["-a", "eth_call", "-x", "eth_call"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_SKIPPED)
+
+    def test_excluded_test(self):
+        """ -X skips the tests by global test number """
+        config = self.get_config(["-X", "2,4"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2), run_tests.SELECTION_SKIPPED)
+        self.assertEqual(self.select(config, "eth_getBalance/test_01.json", 4), run_tests.SELECTION_SKIPPED)
+
+    def test_start_test(self):
+        """ -s doesn't select the tests before the start test, not even as skipped by -X """
+        config = self.get_config(["-s", "3", "-X", "2,3"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_NOT_SELECTED)
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2), run_tests.SELECTION_NOT_SELECTED)
+        self.assertEqual(self.select(config, "eth_blockNumber/test_01.json", 3), run_tests.SELECTION_SKIPPED)
+        self.assertEqual(self.select(config, "eth_getBalance/test_01.json", 4), run_tests.SELECTION_RUN)
+
+    def test_requested_test(self):
+        """ -t selects the test by global test number or, with -a, by test number within the API """
+        config = self.get_config(["-t", "2"])
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2, 2), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1, 1), run_tests.SELECTION_NOT_SELECTED)
+        config = self.get_config(["-a", "eth_call", "-t", "2"])
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 5, 2), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 2, 1), run_tests.SELECTION_NOT_SELECTED)
+
+    def test_requested_test_excluded(self):
+        """ the requested test (-t) is skipped anyway if excluded (-x, -X) """
+        config = self.get_config(["-t", "2", "-X", "2"])
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2, 2), run_tests.SELECTION_SKIPPED)
+        config = self.get_config(["-t", "2", "-x", "eth_call"])
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2, 2), run_tests.SELECTION_SKIPPED)
+
+    def test_tags(self):
+        """ --tags selects the tests having any of the tags in their metadata """
+        config = self.get_config(["--tags", "fast,slow"])
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2), run_tests.SELECTION_NOT_SELECTED)
+
+    def test_resumed(self):
+        """ the tests passed in the checkpointed run are resumed, the failed ones run again """
+        config = self.get_config([])
+        config.checkpoint = run_tests.Checkpoint("checkpoint.json", run_tests.DEFAULT_CHECKPOINT_EVERY,
+                                                 {"testnet/eth_call/test_01.json": "pass", "testnet/eth_call/test_02.json": "fail"})
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_RESUMED)
+        self.assertEqual(self.select(config, "eth_call/test_02.json", 2), run_tests.SELECTION_RUN)
+
+    def test_resumed_excluded(self):
+        """ the exclusions prevail on the resume """
+        config = self.get_config(["-X", "1"])
+        config.checkpoint = run_tests.Checkpoint("checkpoint.json", run_tests.DEFAULT_CHECKPOINT_EVERY,
+                                                 {"testnet/eth_call/test_01.json": "pass"})
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_SKIPPED)
+
+    def test_head_sensitive(self):
+        """ with fixtures recorded at another head the methods on head are skipped, the block tags re-pinned by default """
+        config = self.get_config([])
+        config.fixtures = run_tests.Fixtures("fixtures.json", 100, {})
+        config.fixtures.head_matches = False
+        self.assertEqual(self.select(config, "eth_blockNumber/test_01.json", 3), run_tests.SELECTION_HEAD_SENSITIVE)
+        self.assertEqual(self.select(config, "eth_getBalance/test_01.json", 4), run_tests.SELECTION_RUN)
+        self.assertEqual(self.select(config, "eth_call/test_01.json", 1), run_tests.SELECTION_RUN)
+        config.fixture_pinning = run_tests.FIXTURE_PINNING_SKIP
+        self.assertEqual(self.select(config, "eth_getBalance/test_01.json", 4), run_tests.SELECTION_HEAD_SENSITIVE)
+        config.fixtures.head_matches = True
+        self.assertEqual(self.select(config, "eth_blockNumber/test_01.json", 3), run_tests.SELECTION_RUN)
+
+    def test_head_sensitive_not_selected(self):
+        """ the tests not selected (e.g. -a) are not reported as head sensitive """
+        config = self.get_config(["-a", "eth_call"])
+        config.fixtures = run_tests.Fixtures("fixtures.json", 100, {})
+        config.fixtures.head_matches = False
+        self.assertEqual(self.select(config, "eth_blockNumber/test_01.json", 3), run_tests.SELECTION_NOT_SELECTED)
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,174 @@
+#!/usr/bin/python3
+""" Cross-validate trace_transaction against debug_traceTransaction (callTracer) on sampled transactions """
+
+import getopt
+import sys
+
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, print_range_usage, print_target_usage, \
+    sample_transactions
+
+DEFAULT_COUNT = 16
+DEFAULT_SAMPLE = 2
+CALL_TRACER = {"tracer": "callTracer"}
+
+
+def get_trace_frames(traces):
+    """ return the frames of the trace_transaction traces by trace address, in the callTracer terms i.e. type (e.g. CALL,
+        CREATE2, SELFDESTRUCT), from, to, value, gas, gasUsed and error
+    """
+    frames = {}
+    for trace in traces:
+        action = trace.get("action") or {}
+        result = trace.get("result") or {}
+        if trace.get("type") == "call":
+            frame = {"type": str(action.get("callType", "call")).upper(), "from": action.get("from"), "to": action.get("to"),
+                     "value": action.get("value"), "gas": action.get("gas"), "gasUsed": result.get("gasUsed")}
+        elif trace.get("type") == "create":
+            frame = {"type": str(action.get("creationMethod", "create")).upper(), "from": action.get("from"),
+                     "to": result.get("address"), "value": action.get("value"), "gas": action.get("gas"),
+                     "gasUsed": result.get("gasUsed")}
+        elif trace.get("type") == "suicide":
+            frame = {"type": "SELFDESTRUCT", "from": action.get("address"), "to": action.get("refundAddress"),
+                     "value": action.get("balance")}
+        else:
+            frame = {"type": str(trace.get("type")).upper()}
+        frame["error"] = trace.get("error")
+        frames[tuple(trace.get("traceAddress", []))] = frame
+    return frames
+
+
+def get_call_frames(call, trace_address=(), frames=None):
+    """ return the frames of the callTracer call tree by trace address (index path of the nested calls)
+    """
+    if frames is None:
+        frames = {}
+    frames[trace_address] = {"type": call.get("type"), "from": call.get("from"), "to": call.get("to"), "value": call.get("value"),
+                             "gas": call.get("gas"), "gasUsed": call.get("gasUsed"), "error": call.get("error")}
+    for index, subcall in enumerate(call.get("calls") or []):
+        get_call_frames(subcall, trace_address + (index,), frames)
+    return frames
+
+
+def to_quantity(value):
+    """ return the hex quantity as int, None if missing
+    """
+    return int(value, 16) if isinstance(value, str) else value
+
+
+def compare_frames(trace_frames, call_frames):
+    """ compare the frames of the two tracing stacks, return the first structural or value mismatch or empty string
+        (gas and gasUsed of the top level frame not compared: trace_ excludes the intrinsic gas, callTracer doesn't)
+    """
+    if set(trace_frames) != set(call_frames):
+        only_trace = sorted(set(trace_frames) - set(call_frames))
+        only_call = sorted(set(call_frames) - set(trace_frames))
+        return f"call tree shape: {len(trace_frames)} trace frames vs {len(call_frames)} callTracer frames " \
+               f"(first only in trace {list(only_trace[0]) if only_trace else None}, " \
+               f"first only in callTracer {list(only_call[0]) if only_call else None})"
+    for trace_address in sorted(trace_frames):
+        trace_frame = trace_frames[trace_address]
+        call_frame = call_frames[trace_address]
+        path = list(trace_address)
+        if trace_frame["type"] != call_frame["type"]:
+            return f"frame {path} type {trace_frame['type']} vs {call_frame['type']}"
+        for field in ("from", "to"):
+            if str(trace_frame.get(field)).lower() != str(call_frame.get(field)).lower():
+                return f"frame {path} {field} {trace_frame.get(field)} vs {call_frame.get(field)}"
+        fields = ["value"] if len(trace_address) == 0 else ["value", "gas", "gasUsed"]
+        for field in fields:
+            trace_value = to_quantity(trace_frame.get(field))
+            call_value = to_quantity(call_frame.get(field))
+            # fields omitted by either stack (e.g. value of STATICCALL, gasUsed of a failed frame) not compared
+            if trace_value is not None and call_value is not None and trace_value != call_value:
+                return f"frame {path} {field} {trace_value} vs {call_value}"
+        if (trace_frame.get("error") is None) != (call_frame.get("error") is None):
+            return f"frame {path} error {trace_frame.get('error')} vs {call_frame.get('error')}"
+    return ""
+
+
+def check_transaction(target: str, tx_hash: str):
+    """ fetch the transaction traces of both stacks and compare them, return the mismatch or empty string
+    """
+    traces = call_daemon(target, "trace_transaction", [tx_hash])
+    call = call_daemon(target, "debug_traceTransaction", [tx_hash, CALL_TRACER])
+    if not isinstance(traces, list):
+        return "trace_transaction failed"
+    if not isinstance(call, dict):
+        return "debug_traceTransaction failed"
+    return compare_frames(get_trace_frames(traces), get_call_frames(call))
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Cross-validate the trace_ and debug_ tracing stacks: for the transactions sampled in a block range, compare")
+    print("trace_transaction with debug_traceTransaction (callTracer) on call tree shape, types, addresses, values and gas")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-S <count> transactions sampled per block [default: " + str(DEFAULT_SAMPLE) + "]")
+    print("-v print the outcome of each transaction")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, sample the transactions of the range and compare their traces
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    sample = DEFAULT_SAMPLE
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "S:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-S":
+                sample = int(optarg)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range()
+    checked = 0
+    failed = 0
+    for block_number in range(start_block, start_block + count):
+        block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+        if not isinstance(block, dict):
+            print(f"block {block_number}: Failed (block not available)")
+            failed = failed + 1
+            continue
+        for tx_hash in sample_transactions(block.get("transactions", []), sample):
+            mismatch = check_transaction(target, tx_hash)
+            checked = checked + 1
+            if mismatch != "":
+                print(f"block {block_number} tx {tx_hash}: Failed ({mismatch})")
+                failed = failed + 1
+            elif verbose:
+                print(f"block {block_number} tx {tx_hash}: OK")
+    print(f"Number of checked transactions: {checked}")
+    print(f"Number of failed checks:        {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
@@ -0,0 +1,177 @@
+#!/usr/bin/python3
+""" Live test of the txpool namespace on a devnet: submits signed transactions and checks their pending/queued lifecycle """
+
+import getopt
+import sys
+import time
+
+from eth_account import Account
+
+from rpc_helpers import EIP1559, LEGACY, TARGET_OPTIONS, TX_TYPES, ScriptOptions, call_daemon, check, print_target_usage, \
+    send_transaction, to_int
+
+
+def find_pool_transaction(content, pool: str, address: str, nonce: int):
+    """ return the transaction of the account at nonce in the pending or queued pool of txpool_content, None if missing
+    """
+    if not isinstance(content, dict):
+        return None
+    for account, transactions in content.get(pool, {}).items():
+        if account.lower() == address.lower():
+            return transactions.get(str(nonce))
+    return None
+
+
+def check_pool(target: str, address: str, submitted, pool: str):
+    """ check the submitted transactions (nonce -> (type, hash)) are in the pool with consistent txpool_content, txpool_status
+        and eth_getTransactionByHash, return the number of failed checks
+    """
+    failed = 0
+    content = call_daemon(target, "txpool_content", [])
+    status = call_daemon(target, "txpool_status", [])
+    count = to_int(status.get(pool)) if isinstance(status, dict) else 0
+    failed += check(f"txpool_status {pool} >= {len(submitted)}", count >= len(submitted), f"({count})")
+    for nonce, (tx_type, tx_hash) in sorted(submitted.items()):
+        transaction = find_pool_transaction(content, pool, address, nonce)
+        failed += check(f"txpool_content {pool} nonce {nonce} ({tx_type})",
+                        isinstance(transaction, dict) and transaction.get("hash") == tx_hash and
+                        transaction.get("type") == TX_TYPES[tx_type])
+        by_hash = call_daemon(target, "eth_getTransactionByHash", [tx_hash])
+        failed += check(f"eth_getTransactionByHash nonce {nonce} not mined",
+                        isinstance(by_hash, dict) and by_hash.get("blockNumber") is None and
+                        isinstance(transaction, dict) and by_hash.get("nonce") == transaction.get("nonce"))
+    return failed
+
+
+def check_mined(target: str, address: str, submitted, timeout: int):
+    """ wait up to timeout secs the submitted transactions are mined, then check they left the pool
+        return the number of failed checks
+    """
+    failed = 0
+    deadline = time.time() + timeout
+    for _, tx_hash in sorted(submitted.values()):
+        while call_daemon(target, "eth_getTransactionReceipt", [tx_hash]) is None and time.time() < deadline:
+            time.sleep(1)
+    content = call_daemon(target, "txpool_content", [])
+    for nonce, (tx_type, tx_hash) in sorted(submitted.items()):
+        by_hash = call_daemon(target, "eth_getTransactionByHash", [tx_hash])
+        failed += check(f"eth_getTransactionByHash nonce {nonce} mined ({tx_type})",
+                        isinstance(by_hash, dict) and by_hash.get("blockNumber") is not None)
+        failed += check(f"txpool_content nonce {nonce} removed",
+                        find_pool_transaction(content, "pending", address, nonce) is None and
+                        find_pool_transaction(content, "queued", address, nonce) is None)
+    return failed
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Submit signed transactions to a devnet node and check txpool_content, txpool_status and eth_getTransactionByHash")
+    print("consistency across the pending/queued lifecycle (one transaction queued by a nonce gap, then promoted)")
+    print("")
+    print("-h print this help")
+    print_target_usage("node")
+    print("-K <private key> hex private key of the funded devnet account")
+    print("-k <key file> encrypted key file of the funded devnet account (alternative to -K)")
+    print("-P <password> password of the encrypted key file")
+    print("-t <types> transaction types among legacy,1559,blob [default: legacy,1559]")
+    print("-m <secs> wait up to secs the transactions are mined and check they leave the pool [default: 0 i.e. don't wait]")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line, submit the transactions and check the txpool lifecycle
+    """
+    options = ScriptOptions()
+    private_key = ""
+    key_file = ""
+    password = ""
+    tx_types = [LEGACY, EIP1559]
+    mined_timeout = 0
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + "K:k:P:t:m:")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg):
+                continue
+            elif option == "-K":
+                private_key = optarg
+            elif option == "-k":
+                key_file = optarg
+            elif option == "-P":
+                password = optarg
+            elif option == "-t":
+                tx_types = optarg.split(",")
+                for tx_type in tx_types:
+                    if tx_type not in TX_TYPES:
+                        print("unsupported transaction type: " + tx_type)
+                        sys.exit(-1)
+            elif option == "-m":
+                mined_timeout = int(optarg)
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    if key_file != "":
+        with open(key_file, encoding="utf8") as key_file_ptr:
+            private_key = Account.decrypt(key_file_ptr.read(), password)
+    if private_key == "":
+        print("private key (-K) or key file (-k) required")
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    address = Account.from_key(private_key).address
+    chain_id = to_int(call_daemon(target, "eth_chainId", []))
+    nonce = to_int(call_daemon(target, "eth_getTransactionCount", [address, "pending"]))
+    print(f"account {address} chain {chain_id} next nonce {nonce}")
+
+    failed = 0
+    pending = {}
+    for tx_type in tx_types:
+        tx_hash, error = send_transaction(target, private_key, tx_type, chain_id, nonce + len(pending), address)
+        failed += check(f"eth_sendRawTransaction nonce {nonce + len(pending)} ({tx_type})", tx_hash is not None, error)
+        if tx_hash is None:
+            break
+        pending[nonce + len(pending)] = (tx_type, tx_hash)
+
+    # nonce gap: queued until the missing nonce is submitted
+    gap_nonce = nonce + len(pending)
+    tx_hash, error = send_transaction(target, private_key, tx_types[0], chain_id, gap_nonce + 1, address)
+    failed += check(f"eth_sendRawTransaction nonce {gap_nonce + 1} ({tx_types[0]}, nonce gap)", tx_hash is not None, error)
+    queued = {gap_nonce + 1: (tx_types[0], tx_hash)} if tx_hash is not None else {}
+
+    failed += check_pool(target, address, pending, "pending")
+    failed += check_pool(target, address, queued, "queued")
+
+    tx_hash, error = send_transaction(target, private_key, tx_types[0], chain_id, gap_nonce, address)
+    failed += check(f"eth_sendRawTransaction nonce {gap_nonce} ({tx_types[0]}, gap filled)", tx_hash is not None, error)
+    if tx_hash is not None:
+        pending[gap_nonce] = (tx_types[0], tx_hash)
+    pending.update(queued)
+    failed += check_pool(target, address, pending, "pending")
+
+    if mined_timeout > 0:
+        failed += check_mined(target, address, pending, mined_timeout)
+
+    print(f"Number of failed checks: {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
@@ -0,0 +1,165 @@
+#!/usr/bin/python3
+""" Check the uncle endpoints against the block headers and the ommers and withdrawals fields across the merge boundary """
+
+import getopt
+import sys
+
+from rpc_helpers import RANGE_OPTIONS, TARGET_OPTIONS, ScriptOptions, call_daemon, print_range_usage, print_target_usage
+
+DEFAULT_COUNT = 16
+EMPTY_UNCLES_HASH = "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"
+EMPTY_ROOT_HASH = "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"
+MAX_UNCLE_DEPTH = 6
+WITHDRAWAL_FIELDS = ["index", "validatorIndex", "address", "amount"]
+
+
+def check_uncles(target: str, block):
+    """ check the uncle count and the uncle headers by number and by hash against the uncles of the block, return the
+        mismatch or empty string
+    """
+    block_number = int(block["number"], 16)
+    uncles = block.get("uncles") or []
+    for method, block_id in (("eth_getUncleCountByBlockNumber", block["number"]), ("eth_getUncleCountByBlockHash", block["hash"])):
+        uncle_count = call_daemon(target, method, [block_id])
+        if not isinstance(uncle_count, str) or int(uncle_count, 16) != len(uncles):
+            return f"{method} {uncle_count} instead of {len(uncles)}"
+    for index, uncle_hash in enumerate(uncles):
+        for method, block_id in (("eth_getUncleByBlockNumberAndIndex", block["number"]), ("eth_getUncleByBlockHashAndIndex", block["hash"])):
+            uncle = call_daemon(target, method, [block_id, hex(index)])
+            if not isinstance(uncle, dict):
+                return f"{method} index {index} not found"
+            if str(uncle.get("hash")).lower() != uncle_hash.lower():
+                return f"{method} index {index} hash {uncle.get('hash')} instead of {uncle_hash}"
+            if not 1 <= block_number - int(uncle["number"], 16) <= MAX_UNCLE_DEPTH:
+                return f"{method} index {index} number {int(uncle['number'], 16)} not within {MAX_UNCLE_DEPTH} generations"
+    uncle = call_daemon(target, "eth_getUncleByBlockNumberAndIndex", [block["number"], hex(len(uncles))])
+    if uncle is not None:
+        return f"eth_getUncleByBlockNumberAndIndex index {len(uncles)} beyond the uncles not null"
+    if len(uncles) == 0 and str(block.get("sha3Uncles")).lower() != EMPTY_UNCLES_HASH:
+        return f"sha3Uncles {block.get('sha3Uncles')} of block without uncles"
+    return ""
+
+
+def check_post_merge(block):
+    """ check that the post-merge block has no ommers, return the mismatch or empty string
+    """
+    if int(block.get("difficulty", "0x0"), 16) != 0:
+        return f"difficulty {block.get('difficulty')} after the merge"
+    if len(block.get("uncles") or []) != 0:
+        return f"{len(block['uncles'])} uncles after the merge"
+    if str(block.get("sha3Uncles")).lower() != EMPTY_UNCLES_HASH:
+        return f"sha3Uncles {block.get('sha3Uncles')} after the merge"
+    return ""
+
+
+def check_withdrawals(block, shanghai: bool, next_index: int):
+    """ check the withdrawals fields (absent before Shanghai) and that withdrawal indices follow the ones of the previous
+        block if known (next_index >= 0), return the mismatch or empty string and the next expected withdrawal index
+    """
+    if not shanghai:
+        if "withdrawals" in block or "withdrawalsRoot" in block:
+            return "withdrawals fields before Shanghai", -1
+        return "", -1
+    withdrawals = block.get("withdrawals")
+    if not isinstance(withdrawals, list) or not isinstance(block.get("withdrawalsRoot"), str):
+        return "withdrawals fields missing after Shanghai", -1
+    if len(withdrawals) == 0:
+        if block["withdrawalsRoot"].lower() != EMPTY_ROOT_HASH:
+            return f"withdrawalsRoot {block['withdrawalsRoot']} of block without withdrawals", next_index
+        return "", next_index
+    for position, withdrawal in enumerate(withdrawals):
+        missing = [field for field in WITHDRAWAL_FIELDS if field not in withdrawal]
+        if len(missing) > 0:
+            return f"withdrawal {position} missing {','.join(missing)}", -1
+        index = int(withdrawal["index"], 16)
+        if next_index >= 0 and index != next_index:
+            return f"withdrawal {position} index {index} instead of {next_index}", -1
+        next_index = index + 1
+    return "", next_index
+
+
+def usage(argv):
+    """ Print script usage
+    """
+    print("Usage: " + argv[0] + ":")
+    print("")
+    print("Check over a block range the uncle endpoints against the block headers (pre-merge), that post-merge blocks have no")
+    print("ommers and that withdrawals fields are absent before Shanghai and consistent after (indices, empty withdrawals root)")
+    print("")
+    print("-h print this help")
+    print_target_usage()
+    print_range_usage(DEFAULT_COUNT)
+    print("-M <block> first post-merge block (e.g. 15537394 on mainnet) [default: detected by zero difficulty]")
+    print("-W <block> first Shanghai block (e.g. 17034870 on mainnet) [default: detected by withdrawalsRoot field]")
+    print("-v print the outcome of each block")
+
+
+#
+# main
+#
+def main(argv):
+    """ parse command line and check the blocks of the range
+    """
+    options = ScriptOptions(DEFAULT_COUNT)
+    merge_block = -1
+    shanghai_block = -1
+    verbose = False
+
+    try:
+        opts, _ = getopt.getopt(argv[1:], "h" + TARGET_OPTIONS + RANGE_OPTIONS + "M:W:v")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+                sys.exit(-1)
+            elif options.parse_target(option, optarg) or options.parse_range(option, optarg):
+                continue
+            elif option == "-M":
+                merge_block = int(optarg, 0)
+            elif option == "-W":
+                shanghai_block = int(optarg, 0)
+            elif option == "-v":
+                verbose = True
+            else:
+                usage(argv)
+                sys.exit(-1)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+        sys.exit(-1)
+
+    target = options.get_target()
+    start_block, count = options.get_block_range()
+    checked = 0
+    failed = 0
+    next_withdrawal_index = -1
+    for block_number in range(start_block, start_block + count):
+        block = call_daemon(target, "eth_getBlockByNumber", [hex(block_number), False])
+        checked = checked + 1
+        if not isinstance(block, dict):
+            print(f"block {block_number}: Failed (block not available)")
+            failed = failed + 1
+            continue
+        post_merge = block_number >= merge_block if merge_block >= 0 else int(block.get("difficulty", "0x0"), 16) == 0
+        shanghai = block_number >= shanghai_block if shanghai_block >= 0 else "withdrawalsRoot" in block
+        mismatch = check_uncles(target, block)
+        if mismatch == "" and post_merge:
+            mismatch = check_post_merge(block)
+        if mismatch == "":
+            mismatch, next_withdrawal_index = check_withdrawals(block, shanghai, next_withdrawal_index)
+        if mismatch != "":
+            print(f"block {block_number}: Failed ({mismatch})")
+            failed = failed + 1
+        elif verbose:
+            print(f"block {block_number}: OK ({'post' if post_merge else 'pre'}-merge, {len(block.get('uncles') or [])} uncles, "
+                  f"{len(block['withdrawals']) if shanghai else 'no'} withdrawals)")
+    print(f"Number of checked blocks: {checked}")
+    print(f"Number of failed checks:  {failed}")
+    sys.exit(1 if failed > 0 else 0)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
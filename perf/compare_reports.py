@@ -0,0 +1,179 @@
+#!/usr/bin/env python3
+""" This script compares two performance test reports (CSV reports of run_perf_tests.py or JSON max qps reports of its
+    --find-max mode) and writes a markdown comparison with percentage deltas, e.g. for the description of a pull request
+"""
+
+import csv
+import getopt
+import json
+import sys
+
+from run_perf_tests import parse_vegeta_duration
+
+DEFAULT_THRESHOLD = 10.0
+LATENCY_COLUMNS = ["Min", "Mean", "50", "90", "95", "99", "Max"]
+VERSION_KEYS = ["CPU", "Kernel", "VegetaFile", "Go version", "Silkrpc version", "Erigon version"]
+
+
+def usage(argv):
+    """ Print script usage """
+    print("Usage: " + argv[0] + " [options] <baseline report> <candidate report>")
+    print("")
+    print("Compare two perf reports (CSV reports or JSON max qps reports) and write the markdown comparison")
+    print("")
+    print("-h                      print this help")
+    print("-o <markdown file>      write the comparison into the file [default: print on output]")
+    print("-T <percent>            delta highlighted as regression or improvement beyond this threshold     [default: " + str(DEFAULT_THRESHOLD) + "]")
+    sys.exit(-1)
+
+
+def load_csv_report(file_name: str):
+    """ Return the header info (e.g. CPU, versions) and the latency (ms) and success ratio (%) of each test step averaged on
+        its repetitions, by (daemon, qps, time) in test sequence order """
+    info = {}
+    steps = {}
+    with open(file_name, encoding='utf8') as csv_file:
+        columns = None
+        for row in csv.reader(csv_file):
+            if columns is None and len(row) >= 14 and row[0] == "":
+                info[row[12]] = row[13].split('\n')[0].strip()
+            elif columns is None and len(row) > 0 and row[0] == "Daemon":
+                columns = row
+            elif columns is not None and len(row) >= len(LATENCY_COLUMNS) + 5:
+                values = dict(zip(columns, row))
+                step = steps.setdefault((values["Daemon"], values["Qps"].strip(), values["Time"].strip()), [])
+                measure = {column: parse_vegeta_duration(values[column]) for column in LATENCY_COLUMNS}
+                measure["Ratio"] = float(values["Ratio"].strip().rstrip('%'))
+                step.append(measure)
+    averages = {}
+    for key, measures in steps.items():
+        averages[key] = {column: sum(measure[column] for measure in measures) / len(measures) for column in measures[0]}
+    return info, averages
+
+
+def get_delta(baseline: float, candidate: float):
+    """ Return the percentage delta of candidate from baseline, None if baseline is zero """
+    return (candidate - baseline) * 100 / baseline if baseline != 0 else None
+
+
+def format_delta(delta, threshold: float, higher_is_better: bool):
+    """ Return the delta as markdown, bold if regression and italic if improvement beyond the threshold """
+    if delta is None:
+        return "n/a"
+    text = f"{delta:+.1f}%"
+    if abs(delta) <= threshold:
+        return text
+    return "_" + text + "_ :white_check_mark:" if (delta > 0) == higher_is_better else "**" + text + "** :warning:"
+
+
+def format_latency(value: float):
+    """ Return the latency in ms as text with unit """
+    return f"{value:.3f}ms" if value < 1000 else f"{value / 1000:.3f}s"
+
+
+def compare_csv_reports(baseline_file: str, candidate_file: str, threshold: float):
+    """ Return the markdown lines comparing the latencies and success ratio of the common test steps of the CSV reports """
+    baseline_info, baseline_steps = load_csv_report(baseline_file)
+    candidate_info, candidate_steps = load_csv_report(candidate_file)
+    lines = ["## Perf comparison", "", f"Baseline: `{baseline_file}`  ", f"Candidate: `{candidate_file}`", ""]
+    lines += ["| | Baseline | Candidate |", "|---|---|---|"]
+    for key in VERSION_KEYS:
+        if key in baseline_info or key in candidate_info:
+            lines.append(f"| {key} | {baseline_info.get(key, '')} | {candidate_info.get(key, '')} |")
+    lines += ["", f"Latency deltas beyond {threshold}% highlighted (positive is slower), values averaged on the repetitions.", ""]
+    for daemon in dict.fromkeys(key[0] for key in baseline_steps):
+        lines += [f"### {daemon}", ""]
+        lines.append("| Qps | Time | " + " | ".join(LATENCY_COLUMNS) + " | Ratio |")
+        lines.append("|---:|---:|" + "---:|" * (len(LATENCY_COLUMNS) + 1))
+        for key, baseline in baseline_steps.items():
+            if key[0] != daemon:
+                continue
+            candidate = candidate_steps.get(key)
+            if candidate is None:
+                lines.append(f"| {key[1]} | {key[2]}s | " + " | ".join(["missing in candidate"] * (len(LATENCY_COLUMNS) + 1)) + " |")
+                continue
+            cells = []
+            for column in LATENCY_COLUMNS:
+                delta = format_delta(get_delta(baseline[column], candidate[column]), threshold, False)
+                cells.append(f"{format_latency(baseline[column])} → {format_latency(candidate[column])} ({delta})")
+            # success ratio already in %, delta in points
+            ratio_delta = candidate["Ratio"] - baseline["Ratio"]
+            ratio_text = f"{baseline['Ratio']:.2f}% → {candidate['Ratio']:.2f}%"
+            cells.append(ratio_text + (f" (**{ratio_delta:+.2f}** :warning:)" if ratio_delta < 0 else ""))
+            lines.append(f"| {key[1]} | {key[2]}s | " + " | ".join(cells) + " |")
+        lines.append("")
+    missing = [key for key in candidate_steps if key not in baseline_steps]
+    if len(missing) > 0:
+        lines += ["Test steps missing in baseline: " + ", ".join(f"{key[0]} {key[1]}qps {key[2]}s" for key in missing), ""]
+    return lines
+
+
+def compare_json_reports(baseline_file: str, candidate_file: str, threshold: float):
+    """ Return the markdown lines comparing the max sustainable qps of the JSON reports """
+    with open(baseline_file, encoding='utf8') as json_file:
+        baseline = json.load(json_file)
+    with open(candidate_file, encoding='utf8') as json_file:
+        candidate = json.load(json_file)
+    lines = ["## Max sustainable qps comparison", "", f"Baseline: `{baseline_file}`  ", f"Candidate: `{candidate_file}`", ""]
+    lines += [f"Limits: `{baseline.get('findMax')}` (baseline), `{candidate.get('findMax')}` (candidate), "
+              f"deltas beyond {threshold}% highlighted (positive is faster).", ""]
+    lines += ["| Daemon | Test type | Baseline | Candidate | Delta |", "|---|---|---:|---:|---:|"]
+    for daemon, test_types in baseline.get("maxQps", {}).items():
+        for test_type, baseline_qps in test_types.items():
+            candidate_qps = candidate.get("maxQps", {}).get(daemon, {}).get(test_type)
+            if candidate_qps is None:
+                lines.append(f"| {daemon} | {test_type} | {baseline_qps} | missing | n/a |")
+                continue
+            delta = format_delta(get_delta(baseline_qps, candidate_qps), threshold, True)
+            lines.append(f"| {daemon} | {test_type} | {baseline_qps} | {candidate_qps} | {delta} |")
+    lines.append("")
+    return lines
+
+
+#
+# main
+#
+def main(argv):
+    """ Compare the reports and write the markdown comparison """
+    output_file = ""
+    threshold = DEFAULT_THRESHOLD
+    try:
+        opts, args = getopt.getopt(argv[1:], "ho:T:")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+            elif option == "-o":
+                output_file = optarg
+            elif option == "-T":
+                threshold = float(optarg)
+            else:
+                usage(argv)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+    if len(args) != 2:
+        usage(argv)
+
+    if args[0].endswith(".json") and args[1].endswith(".json"):
+        lines = compare_json_reports(args[0], args[1], threshold)
+    elif args[0].endswith(".csv") and args[1].endswith(".csv"):
+        lines = compare_csv_reports(args[0], args[1], threshold)
+    else:
+        print("ERROR: reports must be both CSV or both JSON")
+        sys.exit(-1)
+
+    if output_file != "":
+        with open(output_file, 'w', encoding='utf8') as markdown_file:
+            markdown_file.write("\n".join(lines) + "\n")
+        print("Comparison report file: " + output_file)
+    else:
+        print("\n".join(lines))
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
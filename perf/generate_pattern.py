@@ -0,0 +1,257 @@
+#!/usr/bin/env python3
+""" This script extracts the method mix and parameter distribution of JSON RPC requests from an access log or Vegeta
+    target file and generates a Vegeta pattern tar file reproducing such distribution, or generates the pattern from
+    request templates with randomized parameters
+"""
+
+import base64
+import getopt
+import io
+import json
+import random
+import re
+import sys
+import tarfile
+import time
+
+DEFAULT_TEST_TYPE = "mixed"
+DEFAULT_REQUEST_COUNT = 10000
+DEFAULT_TOP_PARAMS = 3
+
+VEGETA_PATTERN_DIRNAME = "erigon_stress_test"
+SILKRPC_URL = "http://localhost:51515"
+RPCDAEMON_URL = "http://localhost:8545"
+PLACEHOLDER_PATTERN = re.compile(r"\$\{(\w+)\}")
+
+
+def usage(argv):
+    """ Print script usage """
+    print("Usage: " + argv[0] + " [options] <access log or Vegeta target file>...")
+    print("       " + argv[0] + " [options] -T <template file> -V <name>=<sampler>...")
+    print("")
+    print("Extract the JSON RPC method mix from production traffic and generate a matching Vegeta pattern, or generate the")
+    print("pattern from request templates whose ${name} placeholders are replaced by randomized parameters")
+    print("")
+    print("-h                      print this help")
+    print("-o <pattern tar file>   generate the Vegeta pattern tar file [default: just print the distribution]")
+    print("-y testType             test type used in pattern file names (i.e. -y of run_perf_tests.py)          [default: " + DEFAULT_TEST_TYPE + "]")
+    print("-n <requests>           number of requests sampled into the pattern                               [default: " + str(DEFAULT_REQUEST_COUNT) + "]")
+    print("-S <seed>               seed of the random sampling                                               [default: current time]")
+    print("-P <number>             most frequent parameters printed for each method                          [default: " + str(DEFAULT_TOP_PARAMS) + "]")
+    print("-T <template file>      generate the requests from the templates (one JSON RPC request or batch per line, picked at random)")
+    print("-V <name>=<sampler>     sampler of the ${name} placeholder, repeatable: range:<from>-<to> (random hex quantity, e.g.")
+    print("                        block=range:14000000-15000000) or file:<path> (random line of the file, e.g. address=file:addresses.txt)")
+    sys.exit(-1)
+
+
+def parse_request(line: str):
+    """ Return the JSON RPC request (or batch) contained in one line of access log or Vegeta target file, None if any """
+    line = line.strip()
+    start = min((pos for pos in (line.find('{'), line.find('[')) if pos >= 0), default=-1)
+    if start < 0:
+        return None
+    try:
+        data = json.loads(line[start:])
+    except json.decoder.JSONDecodeError:
+        return None
+    if isinstance(data, dict) and "body" in data and "method" in data and "url" in data:
+        # Vegeta JSON target: body is base64-encoded
+        try:
+            data = json.loads(base64.b64decode(data["body"]))
+        except (ValueError, json.decoder.JSONDecodeError):
+            return None
+    elif isinstance(data, dict) and "jsonrpc" not in data and isinstance(data.get("body"), (str, dict, list)):
+        # access log record having the request as body field
+        data = data["body"] if not isinstance(data["body"], str) else parse_request(data["body"])
+    if isinstance(data, dict) and "method" in data:
+        return data
+    if isinstance(data, list) and len(data) > 0 and all(isinstance(req, dict) and "method" in req for req in data):
+        return data
+    return None
+
+
+def load_requests(file_names):
+    """ Return the list of JSON RPC requests found in the input files """
+    requests = []
+    for file_name in file_names:
+        with open(file_name, encoding='utf8', errors='replace') as input_file:
+            for line in input_file:
+                request = parse_request(line)
+                if request is not None:
+                    requests.append(request)
+    return requests
+
+
+def get_distribution(requests):
+    """ Return the method -> {params -> count} distribution of requests """
+    distribution = {}
+    for request in requests:
+        for single_request in (request if isinstance(request, list) else [request]):
+            params = json.dumps(single_request.get("params", []), sort_keys=True)
+            method_params = distribution.setdefault(single_request["method"], {})
+            method_params[params] = method_params.get(params, 0) + 1
+    return distribution
+
+
+def print_distribution(distribution, top_params: int):
+    """ Print the method mix and the most frequent parameters of each method """
+    total = sum(sum(method_params.values()) for method_params in distribution.values())
+    print(f"Requests: {total}")
+    for method, method_params in sorted(distribution.items(), key=lambda item: -sum(item[1].values())):
+        count = sum(method_params.values())
+        print(f"{method.ljust(45)} {count:8d} {100 * count / total:6.2f}%   distinct params: {len(method_params)}")
+        for params, params_count in sorted(method_params.items(), key=lambda item: -item[1])[:top_params]:
+            print(f"    {params_count:8d} {params[:100]}")
+
+
+def parse_sampler(sampler: str):
+    """ Return the function sampling the parameter as described by sampler e.g. range:14000000-15000000 (random hex quantity
+        within the range) or file:addresses.txt (random line of the file), raise ValueError if invalid """
+    kind, _, spec = sampler.partition(':')
+    if kind == "range":
+        low, _, high = spec.partition('-')
+        low, high = int(low, 0), int(high, 0)
+        if low > high:
+            raise ValueError(spec)
+        return lambda: hex(random.randint(low, high))
+    if kind == "file":
+        try:
+            with open(spec, encoding='utf8') as values_file:
+                values = [line.strip() for line in values_file if line.strip() != ""]
+        except OSError as err:
+            raise ValueError(spec) from err
+        if len(values) == 0:
+            raise ValueError(spec)
+        return lambda: random.choice(values)
+    raise ValueError(sampler)
+
+
+def load_templates(file_name: str):
+    """ Return the JSON RPC request (or batch) templates of the file, one per line """
+    templates = []
+    with open(file_name, encoding='utf8') as template_file:
+        for line in template_file:
+            if line.strip() != "":
+                templates.append(json.loads(line))
+    return templates
+
+
+def substitute_params(template, params):
+    """ Return the template with the ${name} placeholders replaced by the parameters, as JSON value if the placeholder is
+        the whole string otherwise as text """
+    if isinstance(template, dict):
+        return {key: substitute_params(value, params) for key, value in template.items()}
+    if isinstance(template, list):
+        return [substitute_params(item, params) for item in template]
+    if isinstance(template, str):
+        if template.startswith("${") and template.endswith("}") and template[2:-1] in params:
+            return params[template[2:-1]]
+        for name, value in params.items():
+            template = template.replace("${" + name + "}", value)
+    return template
+
+
+def generate_requests(templates, samplers, request_count: int):
+    """ Return the requests generated from the templates picked at random, each placeholder sampled once per request """
+    return [substitute_params(random.choice(templates), {name: sampler() for name, sampler in samplers.items()})
+            for _ in range(request_count)]
+
+
+def to_vegeta_target(request, url: str):
+    """ Return the Vegeta JSON target line of request """
+    body = base64.b64encode(json.dumps(request).encode('utf8')).decode('utf8')
+    return json.dumps({"method": "POST", "url": url, "body": body, "header": {"Content-Type": ["application/json"]}})
+
+
+def write_pattern(requests, pattern_file: str, test_type: str):
+    """ Write the Vegeta pattern tar file targeting both Silkrpc and RPCDaemon """
+    with tarfile.open(pattern_file, 'w') as tar:
+        for name, url in (("geth", SILKRPC_URL), ("erigon", RPCDAEMON_URL)):
+            buff = ("\n".join(to_vegeta_target(request, url) for request in requests) + "\n").encode('utf8')
+            info = tarfile.TarInfo(VEGETA_PATTERN_DIRNAME + "/vegeta_" + name + "_" + test_type + ".txt")
+            info.size = len(buff)
+            info.mtime = int(time.time())
+            tar.addfile(info, io.BytesIO(buff))
+    print(f"Pattern file: {pattern_file} ({len(requests)} requests, test type: {test_type})")
+
+
+#
+# main
+#
+def main(argv):
+    """ Analyse the input traffic and generate the pattern """
+    pattern_file = ""
+    test_type = DEFAULT_TEST_TYPE
+    request_count = DEFAULT_REQUEST_COUNT
+    seed = None
+    top_params = DEFAULT_TOP_PARAMS
+    template_file = ""
+    samplers = {}
+    try:
+        opts, args = getopt.getopt(argv[1:], "ho:y:n:S:P:T:V:")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+            elif option == "-o":
+                pattern_file = optarg
+            elif option == "-y":
+                test_type = optarg
+            elif option == "-n":
+                request_count = int(optarg)
+            elif option == "-S":
+                seed = int(optarg)
+            elif option == "-P":
+                top_params = int(optarg)
+            elif option == "-T":
+                template_file = optarg
+            elif option == "-V":
+                name, _, sampler = optarg.partition('=')
+                try:
+                    samplers[name] = parse_sampler(sampler)
+                except ValueError:
+                    print("ERROR: invalid sampler: ", optarg)
+                    usage(argv)
+            else:
+                usage(argv)
+    except getopt.GetoptError as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+    if (len(args) == 0) == (template_file == ""):
+        usage(argv)
+
+    random.seed(seed)
+    if template_file != "":
+        try:
+            templates = load_templates(template_file)
+        except (OSError, json.decoder.JSONDecodeError) as err:
+            print("ERROR: invalid template file: ", err)
+            sys.exit(-1)
+        placeholders = {name for template in templates for name in PLACEHOLDER_PATTERN.findall(json.dumps(template))}
+        if len(templates) == 0 or any(name not in samplers for name in placeholders):
+            print("ERROR: no template or placeholder without sampler (-V): ", ",".join(sorted(placeholders - set(samplers))))
+            sys.exit(-1)
+        # fresh parameters for each request, so that the daemon caches don't serve repeated requests
+        requests = generate_requests(templates, samplers, request_count)
+        print_distribution(get_distribution(requests), top_params)
+        if pattern_file != "":
+            write_pattern(requests, pattern_file, test_type)
+        return
+
+    requests = load_requests(args)
+    if len(requests) == 0:
+        print("ERROR: no JSON RPC request found in input files")
+        sys.exit(-1)
+    print_distribution(get_distribution(requests), top_params)
+
+    if pattern_file != "":
+        # uniform sampling of recorded requests preserves both method mix and parameter distribution
+        write_pattern(random.choices(requests, k=request_count), pattern_file, test_type)
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
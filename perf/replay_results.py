@@ -0,0 +1,170 @@
+#!/usr/bin/env python3
+""" This script replays the Vegeta result binaries saved by run_perf_tests.py (--save-results) to regenerate the reports
+    without rerunning the attack: results can be downsampled and the repetitions merged, metrics are recomputed with any
+    percentile set and written as JSON, CSV and HDR histogram
+"""
+
+import csv
+import getopt
+import json
+import math
+import os
+import random
+import subprocess
+import sys
+
+DEFAULT_PERCENTILES = "50,90,95,99"
+DEFAULT_SAMPLE_RATE = 1.0
+
+
+def usage(argv):
+    """ Print script usage """
+    print("Usage: " + argv[0] + " [options] <Vegeta result binary>...")
+    print("")
+    print("Recompute the perf metrics from the saved Vegeta result binaries and regenerate the reports")
+    print("")
+    print("-h                      print this help")
+    print("-o <prefix>             write the reports as <prefix>.json, <prefix>.csv and <prefix>_<name>.hdr [default: print on output]")
+    print("-p <percentiles>        latency percentiles computed (e.g. 50,99,99.9)                             [default: " + DEFAULT_PERCENTILES + "]")
+    print("-d <rate>               downsample keeping this fraction of the results (e.g. 0.1)                 [default: " + str(DEFAULT_SAMPLE_RATE) + "]")
+    print("-S <seed>               seed of the random downsampling                                           [default: current time]")
+    print("-M                      merge the results of all the binaries (e.g. repetitions) into one measure")
+    sys.exit(-1)
+
+
+def load_results(file_name: str):
+    """ Return the results of the Vegeta binary as (timestamp ns, status code, latency ns, bytes in, error, url) decoded by vegeta """
+    process = subprocess.run(["vegeta", "encode", "--to", "csv", file_name], stdout=subprocess.PIPE, universal_newlines=True,
+                             check=False)
+    if process.returncode != 0:
+        print("ERROR: vegeta cannot decode " + file_name)
+        sys.exit(-1)
+    results = []
+    # columns: timestamp, code, latency, bytes out, bytes in, error, body, attack, seq, method, url, headers
+    for row in csv.reader(process.stdout.splitlines()):
+        results.append((int(row[0]), int(row[1]), int(row[2]), int(row[4]), row[5], row[10]))
+    return results
+
+
+def get_percentile(sorted_latencies, percentile: float):
+    """ Return the latency at percentile of the sorted latencies (nearest rank) """
+    rank = math.ceil(percentile / 100 * len(sorted_latencies))
+    return sorted_latencies[max(rank, 1) - 1]
+
+
+def get_metrics(name: str, segments, percentiles):
+    """ Return the metrics of the results of the segments (i.e. binaries, the pauses between them excluded from rate and
+        throughput): requests, rate, throughput, success ratio, latencies in ms, errors """
+    results = [result for segment in segments for result in segment]
+    latencies = sorted(result[2] for result in results)
+    successes = sum(1 for result in results if 200 <= result[1] < 400)
+    attack_time = sum(max(result[0] for result in segment) - min(result[0] for result in segment) for segment in segments)
+    total_time = sum(max(result[0] + result[2] for result in segment) - min(result[0] for result in segment) for segment in segments)
+    errors = {}
+    for result in results:
+        if result[4] != "":
+            errors[result[4]] = errors.get(result[4], 0) + 1
+    return {
+        "name": name,
+        "requests": len(results),
+        "rate": (len(results) - len(segments)) * 1e9 / attack_time if attack_time > 0 else 0.0,
+        "throughput": successes * 1e9 / total_time if total_time > 0 else 0.0,
+        "successRatio": successes * 100 / len(results),
+        "bytesIn": sum(result[3] for result in results),
+        "latencies": {
+            "min": latencies[0] / 1e6,
+            "mean": sum(latencies) / len(latencies) / 1e6,
+            **{f"p{percentile:g}": get_percentile(latencies, percentile) / 1e6 for percentile in percentiles},
+            "max": latencies[-1] / 1e6,
+        },
+        "errors": errors,
+    }
+
+
+def write_hdr_histogram(file_name: str, segments):
+    """ Write the HDR histogram of the latencies in the format of vegeta report -type=hdrplot """
+    latencies = sorted(result[2] for segment in segments for result in segment)
+    with open(file_name, 'w', encoding='utf8') as hdr_file:
+        hdr_file.write(f"{'Value(ms)':>12} {'Percentile':>12} {'TotalCount':>12} {'1/(1-Percentile)':>18}\n")
+        # logarithmic percentile steps as in HdrHistogram percentile distribution
+        percentile = 0.0
+        while percentile < 100.0:
+            count = max(math.ceil(percentile / 100 * len(latencies)), 1)
+            hdr_file.write(f"{latencies[count - 1] / 1e6:12.6f} {percentile / 100:12.6f} {count:12d} {1 / (1 - percentile / 100):18.2f}\n")
+            percentile = percentile + (100.0 - percentile) / 4 if percentile < 99.9999 else 100.0
+        hdr_file.write(f"{latencies[-1] / 1e6:12.6f} {1.0:12.6f} {len(latencies):12d} {'inf':>18}\n")
+
+
+#
+# main
+#
+def main(argv):
+    """ Load the result binaries, recompute the metrics and write the reports """
+    output_prefix = ""
+    percentiles = [float(percentile) for percentile in DEFAULT_PERCENTILES.split(',')]
+    sample_rate = DEFAULT_SAMPLE_RATE
+    seed = None
+    merge = False
+    try:
+        opts, args = getopt.getopt(argv[1:], "ho:p:d:S:M")
+        for option, optarg in opts:
+            if option in ("-h", "--help"):
+                usage(argv)
+            elif option == "-o":
+                output_prefix = optarg
+            elif option == "-p":
+                percentiles = [float(percentile) for percentile in optarg.split(',')]
+            elif option == "-d":
+                sample_rate = float(optarg)
+            elif option == "-S":
+                seed = int(optarg)
+            elif option == "-M":
+                merge = True
+            else:
+                usage(argv)
+    except (getopt.GetoptError, ValueError) as err:
+        # print help information and exit:
+        print(err)
+        usage(argv)
+    if len(args) == 0 or not 0 < sample_rate <= 1:
+        usage(argv)
+
+    random.seed(seed)
+    measures = []
+    for file_name in args:
+        results = [result for result in load_results(file_name) if sample_rate == 1 or random.random() < sample_rate]
+        if len(results) == 0:
+            print("ERROR: no result in " + file_name)
+            sys.exit(-1)
+        name = os.path.basename(file_name).rsplit('.', 1)[0]
+        if merge and len(measures) > 0:
+            measures[0][1].append(results)
+        else:
+            measures.append(("merged" if merge else name, [results]))
+    metrics = [get_metrics(name, segments, percentiles) for name, segments in measures]
+
+    if output_prefix == "":
+        print(json.dumps(metrics, indent=4))
+        return
+    with open(output_prefix + ".json", 'w', encoding='utf8') as json_file:
+        json.dump(metrics, json_file, indent=4)
+    with open(output_prefix + ".csv", 'w', newline='', encoding='utf8') as csv_file:
+        writer = csv.writer(csv_file)
+        latency_columns = list(metrics[0]["latencies"])
+        writer.writerow(["Name", "Requests", "Rate", "Throughput", "Ratio", "BytesIn"] + latency_columns + ["Errors"])
+        for metric in metrics:
+            writer.writerow([metric["name"], metric["requests"], f"{metric['rate']:.2f}", f"{metric['throughput']:.2f}",
+                             f"{metric['successRatio']:.2f}%", metric["bytesIn"]] +
+                            [f"{metric['latencies'][column]:.3f}ms" for column in latency_columns] +
+                            [" ".join(f"{error}:{count}" for error, count in metric["errors"].items())])
+    for name, segments in measures:
+        write_hdr_histogram(output_prefix + "_" + name + ".hdr", segments)
+    print("Replay report files: " + output_prefix + ".json, " + output_prefix + ".csv, " + output_prefix + "_<name>.hdr")
+
+
+#
+# module as main
+#
+if __name__ == "__main__":
+    main(sys.argv)
+    sys.exit(0)
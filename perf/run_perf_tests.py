@@ -6,15 +6,20 @@
 
 import os
 import csv
+import json
+import math
 import pathlib
 import sys
 import time
 import getopt
 import getpass
 from datetime import datetime
+from urllib.parse import urlparse
 
 import psutil
 
+from replay_results import get_metrics, load_results
+
 DEFAULT_TEST_SEQUENCE = "50:30,1000:30,2500:20,10000:20"
 DEFAULT_REPETITIONS = 10
 DEFAULT_VEGETA_PATTERN_TAR_FILE = ""
@@ -29,6 +34,10 @@ DEFAULT_MAX_CONN = "9000"
 DEFAULT_TEST_TYPE = "eth_getLogs"
 DEFAULT_VEGETA_RESPONSE_TIMEOUT = "300"
 DEFAULT_MAX_BODY_RSP = "1500"
+DEFAULT_PACER = "constant"
+SINE_PACER_STEPS = 20
+FIND_MAX_QPS_LIMIT = 1000000
+FIND_MAX_RESOLUTION = 0.05
 
 SILKRPC="silk"
 RPCDAEMON="rpcdaemon"
@@ -36,6 +45,8 @@ SILKRPC_SERVER_NAME="rpcdaemon"
 RPCDAEMON_SERVER_NAME="rpcdaemon"
 VEGETA_PATTERN_DIRNAME = "erigon_stress_test"
 VEGETA_REPORT = "vegeta_report.hrd"
+VEGETA_RESULTS = "vegeta_results.bin"
+ENDPOINT_PERCENTILES = [50, 90, 95, 99]
 VEGETA_TAR_FILE_NAME = "vegeta_TAR_File"
 VEGETA_PATTERN_SILKRPC_BASE = "/tmp/" + VEGETA_PATTERN_DIRNAME + "/vegeta_geth_"
 VEGETA_PATTERN_RPCDAEMON_BASE = "/tmp/" + VEGETA_PATTERN_DIRNAME + "/vegeta_erigon_"
@@ -64,13 +75,109 @@ def usage(argv):
     print("-w testWaitInterval     time interval between successive test iterations in sec                                [default: " + str(DEFAULT_WAITING_TIME) + "]")
 
     print("-d rpcDaemonAddress     address of RPCDaemon/Silkrpc (e.g. 10.1.1.20)                                          [default: " + DEFAULT_RPCDAEMON_ADDRESS +"]")
+    print("--rpc-daemon-address <addresses> comma-separated addresses of RPCDaemon/Silkrpc replicas (e.g. 10.1.1.20,10.1.1.21): the")
+    print("                        requests are spread across them round-robin and latency and errors are reported also per endpoint")
     print("-g erigonBuildDir       Erigon: path to erigon folder (e.g. /home/erigon)                                      [default: " + DEFAULT_ERIGON_BUILD_DIR + "]")
     print("-s silkrpcBuildDir      Silkrpc: path to silk folder (e.g. /home/silkworm)                                     [default: " + DEFAULT_SILKRPC_BUILD_DIR + "]")
     print("-c daemonVegetaOnCore   cpu list in taskset format for daemon & vegeta (e.g. 0-1:2-3 or 0-2:3-4 or 0,2:3,4...) [default: " + DEFAULT_DAEMON_VEGETA_ON_CORE +"]")
     print("-T <timeout>            vegeta response timeout                                                                [default: " + DEFAULT_VEGETA_RESPONSE_TIMEOUT + "]")
     print("-M <maximum body size>  Maximum number of bytes to read from response bodies                                   [default: " + DEFAULT_MAX_BODY_RSP + "]")
+    print("--pacer <pacer>         attack pacing: constant (qps of the test sequence), sine:mean=<qps>,amp=<qps>,period=<secs>,")
+    print("                        burst:base=<qps>,peak=<qps>,every=<secs>,length=<secs> (mean/base default: qps of the test sequence)")
+    print("                        e.g. sine:mean=500,amp=300,period=60s                                                  [default: " + DEFAULT_PACER + "]")
+    print("--closed-loop           load as concurrent closed-loop workers instead of qps: each worker sends the next request as")
+    print("                        soon as the previous completes, test sequence as <workers1>:<t1>,... (e.g. 16:30,64:30)")
+    print("--save-results <dir>    save the Vegeta result binary of each test into dir (<daemon>_<testType>_<qps>_<time>_<testNo>.bin)")
+    print("                        to regenerate the reports without rerunning the attack (see replay_results.py)")
+    print("--find-max <limits>     find the max sustainable qps instead of running the test sequence: qps doubled from the first")
+    print("                        test of the sequence then binary searched until p99 latency or error rate exceed the limits")
+    print("                        (e.g. p99=500ms,errors=1%), max qps written also in JSON report with -R or -u")
     sys.exit(-1)
 
+def parse_pacer(pacer: str):
+    """ Parse the pacer e.g. sine:mean=500,amp=300,period=60s into its name and params, raise ValueError if invalid """
+    name, _, spec = pacer.partition(':')
+    params = {}
+    if spec != "":
+        for param in spec.split(','):
+            key, _, value = param.partition('=')
+            params[key] = float(value[:-1] if value.endswith('s') else value)
+    if name == "constant":
+        allowed, required = [], []
+    elif name == "sine":
+        allowed, required = ["mean", "amp", "period"], ["amp", "period"]
+    elif name == "burst":
+        allowed, required = ["base", "peak", "every", "length"], ["peak", "every", "length"]
+    else:
+        raise ValueError(name)
+    if any(key not in allowed for key in params) or any(key not in params for key in required):
+        raise ValueError(spec)
+    if params.get("period", 1) <= 0 or params.get("every", 1) <= 0 or params.get("length", 0) > params.get("every", 0):
+        raise ValueError(spec)
+    return name, params
+
+def get_pacer_steps(pacer: str, qps_value: str, duration: str):
+    """ Return the attack steps as list of (qps, secs) pacing the test duration, the constant rate being a single step
+        (Vegeta command line supports only the constant rate: the sine is approximated by SINE_PACER_STEPS steps per period) """
+    name, params = parse_pacer(pacer)
+    total_secs = int(duration)
+    if name == "sine":
+        step_secs = max(int(params["period"]) // SINE_PACER_STEPS, 1)
+    elif name == "burst":
+        step_secs = 1
+    else:
+        return [(int(qps_value), total_secs)]
+    steps = []
+    for start in range(0, total_secs, step_secs):
+        secs = min(step_secs, total_secs - start)
+        if name == "sine":
+            middle = start + secs / 2
+            qps = params.get("mean", float(qps_value)) + params["amp"] * math.sin(2 * math.pi * middle / params["period"])
+        else:
+            qps = params["peak"] if start % params["every"] < params["length"] else params.get("base", float(qps_value))
+        # rate 0 is an unlimited rate for Vegeta
+        qps = max(int(round(qps)), 1)
+        if len(steps) > 0 and steps[-1][0] == qps:
+            steps[-1] = (qps, steps[-1][1] + secs)
+        else:
+            steps.append((qps, secs))
+    return steps
+
+def parse_find_max(limits: str):
+    """ Parse the find max limits e.g. p99=500ms,errors=1% into p99 latency in ms and error rate in %, raise ValueError if invalid """
+    p99_limit = None
+    error_limit = 0.0
+    for limit in limits.split(','):
+        key, _, value = limit.partition('=')
+        if key == "p99":
+            p99_limit = float(value[:-2] if value.endswith("ms") else value)
+        elif key == "errors":
+            error_limit = float(value[:-1] if value.endswith("%") else value)
+        else:
+            raise ValueError(limit)
+    if p99_limit is None:
+        raise ValueError(limits)
+    return p99_limit, error_limit
+
+def parse_vegeta_duration(duration: str):
+    """ Parse the Vegeta (Go) duration e.g. 1m2.5s, 12.3ms, 512.1µs into ms """
+    units = {"h": 3600000, "m": 60000, "s": 1000, "ms": 1, "µs": 0.001, "us": 0.001, "ns": 0.000001}
+    milliseconds = 0.0
+    value = ""
+    unit = ""
+    for char in duration.strip() + " ":
+        if char.isdigit() or char == '.':
+            if unit != "":
+                milliseconds = milliseconds + float(value) * units[unit]
+                value = ""
+                unit = ""
+            value = value + char
+        elif char != " ":
+            unit = unit + char
+        elif value != "":
+            milliseconds = milliseconds + float(value) * units[unit]
+    return milliseconds
+
 def get_process(process_name: str):
     """ Return the running process having specified name or None if not exists """
     for proc in psutil.process_iter():
@@ -78,6 +185,28 @@ def get_process(process_name: str):
             return proc
     return None
 
+def fan_out_pattern(pattern_file: str, addresses):
+    """ Spread the JSON targets of the vegeta file across the addresses in turn (round-robin), the host of the url of each
+        target replaced by the next address (its port kept unless the address has one): vegeta sending the targets in order,
+        the load is spread evenly """
+    if os.path.exists(pattern_file) == 0:
+        return
+    with open(pattern_file, encoding='utf8') as file:
+        lines = file.readlines()
+    with open(pattern_file, 'w', encoding='utf8') as file:
+        target_number = 0
+        for line in lines:
+            if line.strip() == "":
+                file.write(line)
+                continue
+            target = json.loads(line)
+            url = urlparse(target["url"])
+            address = addresses[target_number % len(addresses)]
+            netloc = address if ':' in address or url.port is None else address + ":" + str(url.port)
+            target["url"] = url._replace(netloc=netloc).geturl()
+            file.write(json.dumps(target) + "\n")
+            target_number = target_number + 1
+
 class Config:
     # pylint: disable=too-many-instance-attributes
     """ This class manage configuration params """
@@ -105,6 +234,10 @@ class Config:
         self.max_connection = DEFAULT_MAX_CONN
         self.vegeta_response_timeout = DEFAULT_VEGETA_RESPONSE_TIMEOUT
         self.max_body_rsp = DEFAULT_MAX_BODY_RSP
+        self.pacer = DEFAULT_PACER
+        self.find_max = ""
+        self.closed_loop = False
+        self.results_dir = ""
 
         self.__parse_args(argv)
 
@@ -112,14 +245,15 @@ class Config:
         try:
             local_config = 0
             specified_chain = 0
-            opts, _ = getopt.getopt(argv[1:], "hm:d:p:c:a:g:s:r:t:y:zw:uvxZRb:A:C:eT:M:")
+            opts, _ = getopt.getopt(argv[1:], "hm:d:p:c:a:g:s:r:t:y:zw:uvxZRb:A:C:eT:M:", ["pacer=", "find-max=", "closed-loop", "save-results=",
+                                                                                         "rpc-daemon-address="])
 
             for option, optarg in opts:
                 if option in ("-h", "--help"):
                     usage(argv)
                 elif option == "-m":
                     self.test_mode = optarg
-                elif option == "-d":
+                elif option in ("-d", "--rpc-daemon-address"):
                     if local_config == 1:
                         print("ERROR: incompatible option -d with -g -s")
                         usage(argv)
@@ -195,8 +329,30 @@ class Config:
                     self.vegeta_response_timeout = optarg
                 elif option == "-M":
                     self.max_body_rsp = optarg
+                elif option == "--pacer":
+                    try:
+                        parse_pacer(optarg)
+                    except ValueError:
+                        print("ERROR: invalid pacer: ", optarg)
+                        usage(argv)
+                    self.pacer = optarg
+                elif option == "--find-max":
+                    try:
+                        parse_find_max(optarg)
+                    except ValueError:
+                        print("ERROR: invalid find max limits: ", optarg)
+                        usage(argv)
+                    self.find_max = optarg
+                elif option == "--closed-loop":
+                    self.closed_loop = True
+                elif option == "--save-results":
+                    pathlib.Path(optarg).mkdir(parents=True, exist_ok=True)
+                    self.results_dir = optarg
                 else:
                     usage(argv)
+            if self.closed_loop and (self.pacer != DEFAULT_PACER or self.find_max != ""):
+                print("ERROR: incompatible option --closed-loop with --pacer --find-max")
+                usage(argv)
         except getopt.GetoptError as err:
             # print help information and exit:
             print(err)
@@ -211,6 +367,8 @@ class PerfTest:
         """ The initialization routine stop any previos server """
         self.test_report = test_report
         self.config = config
+        self.last_result = None
+        self.results_file = ""
         self.cleanup()
         self.copy_and_extract_pattern_file()
 
@@ -246,8 +404,12 @@ class PerfTest:
             print("Vegeta pattern untar failed. Test Aborted!")
             sys.exit(-1)
 
+        # If more addresses are provided spread the targets of the vegeta file across them (round-robin targeter)
+        if len(self.config.rpc_daemon_address.split(',')) > 1:
+            fan_out_pattern(VEGETA_PATTERN_SILKRPC_BASE + self.config.test_type + ".txt", self.config.rpc_daemon_address.split(','))
+            fan_out_pattern(VEGETA_PATTERN_RPCDAEMON_BASE + self.config.test_type + ".txt", self.config.rpc_daemon_address.split(','))
         # If address is provided substitute the address and port of daemon in the vegeta file
-        if self.config.rpc_daemon_address != "localhost":
+        elif self.config.rpc_daemon_address != "localhost":
             cmd = "sed -i 's/localhost/" + self.config.rpc_daemon_address + "/g' " + VEGETA_PATTERN_SILKRPC_BASE + self.config.test_type + ".txt"
             os.system(cmd)
             cmd = "sed -i 's/localhost/" + self.config.rpc_daemon_address + "/g' " + VEGETA_PATTERN_RPCDAEMON_BASE + self.config.test_type + ".txt"
@@ -265,20 +427,49 @@ class PerfTest:
         else:
             pattern = VEGETA_PATTERN_RPCDAEMON_BASE + self.config.test_type + ".txt"
         on_core = self.config.daemon_vegeta_on_core.split(':')
-        if self.config.max_connection == "0":
-            vegeta_cmd = " vegeta attack -keepalive -rate=" + qps_value + " -format=json -duration=" + duration + "s -timeout=" + \
-                           self.config.vegeta_response_timeout + "s -max-body=" + self.config.max_body_rsp
-        else:
-            vegeta_cmd = " vegeta attack -keepalive -rate=" + qps_value + " -format=json -duration=" + duration + "s -timeout=" + \
-                          self.config.vegeta_response_timeout + "s -max-connections=" + self.config.max_connection + " -max-body=" + \
-                          self.config.max_body_rsp
+        attack_cmds = []
+        # the results of the attack steps are streamed into a single report: as the gob streams of several attacks cannot be
+        # concatenated, the results of each step are encoded as JSON (decoded as well by vegeta report and encode)
+        steps = get_pacer_steps(self.config.pacer, qps_value, duration)
+        for step_qps, step_secs in steps:
+            if self.config.closed_loop:
+                # unlimited rate with a fixed number of workers i.e. each worker waits the response before the next request
+                rate = "0 -workers=" + str(step_qps) + " -max-workers=" + str(step_qps)
+            else:
+                rate = str(step_qps)
+            if self.config.max_connection == "0":
+                vegeta_cmd = " vegeta attack -keepalive -rate=" + rate + " -format=json -duration=" + str(step_secs) + "s -timeout=" + \
+                               self.config.vegeta_response_timeout + "s -max-body=" + self.config.max_body_rsp
+            else:
+                vegeta_cmd = " vegeta attack -keepalive -rate=" + rate + " -format=json -duration=" + str(step_secs) + "s -timeout=" + \
+                              self.config.vegeta_response_timeout + "s -max-connections=" + self.config.max_connection + " -max-body=" + \
+                              self.config.max_body_rsp
+            if on_core[1] == "-":
+                attack_cmd = "cat " + pattern + " | " + vegeta_cmd
+                encode_cmd = " | vegeta encode -to=json"
+            else:
+                attack_cmd = "taskset -c " + on_core[1] + " cat " + pattern + " | " \
+                             "taskset -c " + on_core[1] + vegeta_cmd
+                encode_cmd = " | taskset -c " + on_core[1] + " vegeta encode -to=json"
+            attack_cmds.append(attack_cmd if len(steps) == 1 else attack_cmd + encode_cmd)
+        attack_cmd = attack_cmds[0] if len(attack_cmds) == 1 else "( " + "; ".join(attack_cmds) + "; )"
+        self.results_file = ""
+        if self.config.results_dir != "":
+            test_id = test_number.strip().strip('[]').replace(' ', '')
+            self.results_file = f"{self.config.results_dir}/{name}_{self.config.test_type}_{qps_value}_{duration}_{test_id}.bin"
+        elif len(self.config.rpc_daemon_address.split(',')) > 1:
+            # the results kept for the breakdown per endpoint
+            self.results_file = VEGETA_RESULTS
+        if self.results_file != "":
+            attack_cmd = attack_cmd + " | tee " + self.results_file
         if on_core[1] == "-":
-            cmd = "cat " + pattern + " | " + vegeta_cmd + " | vegeta report -type=text > " + VEGETA_REPORT + " &"
+            cmd = attack_cmd + " | vegeta report -type=text > " + VEGETA_REPORT + " &"
         else:
-            cmd = "taskset -c " + on_core[1] + " cat " + pattern + " | " \
-                  "taskset -c " + on_core[1] + vegeta_cmd + " | " \
+            cmd = attack_cmd + " | " \
                   "taskset -c " + on_core[1] + " vegeta report -type=text > " + VEGETA_REPORT + " &"
-        print(f"{test_number} daemon: executes test qps: {qps_value} time: {duration} -> ", end="")
+        pacing = "" if self.config.pacer == DEFAULT_PACER else " pacer: " + self.config.pacer
+        load = "workers" if self.config.closed_loop else "qps"
+        print(f"{test_number} daemon: executes test {load}: {qps_value} time: {duration}{pacing} -> ", end="")
         sys.stdout.flush()
         status = os.system(cmd)
         if int(status) != 0:
@@ -322,6 +513,35 @@ class PerfTest:
             print("")
         return 1
 
+    def find_max_qps(self, tag):
+        """ Find the max sustainable qps of the daemon within the p99 latency and error rate limits: qps doubled from the first test
+            of the sequence until the limits are exceeded then binary searched, return the max qps (0 if none) or None if server dead """
+        p99_limit, error_limit = parse_find_max(self.config.find_max)
+        first_test = self.config.test_sequence.split(',')[0]
+        qps = int(first_test.split(':')[0])
+        duration = first_test.split(':')[1]
+        max_qps = 0
+        exceeding_qps = 0
+        test_number = 1
+        while qps <= FIND_MAX_QPS_LIMIT:
+            if self.execute("[" + str(test_number) + "] ", tag, str(qps), duration) == 0:
+                return None
+            test_number = test_number + 1
+            p99_latency, error_rate = self.last_result
+            if p99_latency > p99_limit or error_rate > error_limit:
+                exceeding_qps = qps
+            else:
+                max_qps = qps
+            time.sleep(self.config.waiting_time)
+            if exceeding_qps == 0:
+                qps = qps * 2
+            elif exceeding_qps - max_qps > max(int(exceeding_qps * FIND_MAX_RESOLUTION), 1):
+                qps = (max_qps + exceeding_qps) // 2
+            else:
+                break
+        print(f"Max sustainable qps: {max_qps} (p99 <= {p99_limit}ms, errors <= {error_limit}%)\n")
+        return max_qps
+
     def get_result(self, test_number, daemon_name, qps_value, duration):
         """ Processes the report file generated by vegeta and reads latency data """
         test_report_filename = VEGETA_REPORT
@@ -334,20 +554,53 @@ class PerfTest:
             max_latency = latency_values[12]
             newline = file_raws[5].replace('\n', ' ')
             ratio = newline.split(' ')[34]
+            throughput = file_raws[0].replace('\n', '').split(',')[-1].strip()
+            achieved = ", Throughput=" + throughput + ", Mean=" + latency_values[7].strip() + ", P99=" + latency_values[11].strip() \
+                       if self.config.closed_loop else ""
             if len(file_raws) > 8:
                 error = file_raws[8]
-                print(" [ Ratio="+ratio+", MaxLatency="+max_latency+ " Error: " + error +"]")
+                print(" [ Ratio="+ratio+achieved+", MaxLatency="+max_latency+ " Error: " + error +"]")
             else:
                 error = ""
-                print(" [ Ratio="+ratio+", MaxLatency="+max_latency+"]")
+                print(" [ Ratio="+ratio+achieved+", MaxLatency="+max_latency+"]")
             threads = os.popen("ps -efL | grep erigon | grep bin | wc -l").read().replace('\n', ' ')
+            # p99 latency in ms and error rate in % i.e. complement of the success ratio
+            self.last_result = (parse_vegeta_duration(latency_values[11]), 100.0 - float(ratio.strip().rstrip('%')))
         finally:
             file.close()
 
-        if self.config.create_test_report:
+        if self.config.create_test_report and self.config.closed_loop:
+            # achieved throughput as qps, concurrency level as workers
+            self.test_report.write_test_report(daemon_name, test_number, threads, throughput, duration, min_latency, latency_values[7], latency_values[8], \
+                                               latency_values[9], latency_values[10], latency_values[11], max_latency, ratio, error, qps_value)
+        elif self.config.create_test_report:
             self.test_report.write_test_report(daemon_name, test_number, threads, qps_value, duration, min_latency, latency_values[7], latency_values[8], \
                                                latency_values[9], latency_values[10], latency_values[11], max_latency, ratio, error)
         os.system("/bin/rm " + test_report_filename)
+        if len(self.config.rpc_daemon_address.split(',')) > 1:
+            self.get_endpoint_results(test_number, daemon_name, threads, qps_value, duration)
+
+    def get_endpoint_results(self, test_number, daemon_name, threads, qps_value, duration):
+        """ Processes the results saved by vegeta and reports latency and errors of each endpoint of the fan-out attack """
+        endpoint_results = {}
+        for result in load_results(self.results_file):
+            endpoint_results.setdefault(urlparse(result[5]).netloc, []).append(result)
+        for endpoint, results in sorted(endpoint_results.items()):
+            metrics = get_metrics(endpoint, [results], ENDPOINT_PERCENTILES)
+            latencies = {name: f"{latency:.3f}ms" for name, latency in metrics["latencies"].items()}
+            ratio = f"{metrics['successRatio']:.2f}%"
+            error = " ".join(f"{error}:{count}" for error, count in metrics["errors"].items())
+            print(f"    endpoint {endpoint} [ Requests={metrics['requests']}, Ratio={ratio}, Mean={latencies['mean']}, "
+                  f"P99={latencies['p99']}, MaxLatency={latencies['max']}" + (" Error: " + error if error != "" else "") + "]")
+            if self.config.create_test_report:
+                # rows of the endpoints as daemon@endpoint, achieved throughput as qps in closed-loop mode
+                self.test_report.write_test_report(daemon_name + "@" + endpoint, test_number, threads,
+                                                   f"{metrics['throughput']:.2f}" if self.config.closed_loop else qps_value, duration,
+                                                   latencies["min"], latencies["mean"], latencies["p50"], latencies["p90"],
+                                                   latencies["p95"], latencies["p99"], latencies["max"], ratio, error,
+                                                   qps_value if self.config.closed_loop else None)
+        if self.results_file == VEGETA_RESULTS:
+            os.remove(self.results_file)
 
 
 class Hardware:
@@ -392,6 +645,7 @@ class TestReport:
     def __init__(self, config):
         """ Create a new TestReport """
         self.csv_file = ''
+        self.csv_filepath = ''
         self.writer = ''
         self.config = config
 
@@ -414,6 +668,7 @@ class TestReport:
             csv_filename = self.config.test_type + "_" + datetime.today().strftime('%Y-%m-%d-%H:%M:%S') + "_perf.csv"
         csv_filepath = csv_folder_path + '/' + csv_filename
         self.csv_file = open(csv_filepath, 'w', newline='', encoding='utf8')
+        self.csv_filepath = csv_filepath
         self.writer = csv.writer(self.csv_file)
 
         print("Perf report file: " + csv_filepath + "\n")
@@ -464,6 +719,8 @@ class TestReport:
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "Bogomips", bogomips])
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "Kernel", kern_vers])
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "DaemonVegetaRunOnCore", self.config.daemon_vegeta_on_core])
+        if len(self.config.rpc_daemon_address.split(',')) > 1:
+            self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "Endpoints", self.config.rpc_daemon_address])
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "VegetaFile", self.config.vegeta_pattern_tar_file])
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "VegetaChecksum", checksum[0]])
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "GCC version", gcc_vers[0]])
@@ -472,14 +729,28 @@ class TestReport:
         self.writer.writerow(["", "", "", "", "", "", "", "", "", "", "", "", "Erigon version", erigon_branch + " " + erigon_commit])
         self.writer.writerow([])
         self.writer.writerow([])
-        self.writer.writerow(["Daemon", "TestNo", "TG-Threads", "Qps", "Time", "Min", "Mean", "50", "90", "95", "99", "Max", "Ratio", "Error"])
+        header = ["Daemon", "TestNo", "TG-Threads", "Qps", "Time", "Min", "Mean", "50", "90", "95", "99", "Max", "Ratio", "Error"]
+        self.writer.writerow(header + ["Workers"] if self.config.closed_loop else header)
         self.csv_file.flush()
 
-    def write_test_report(self, daemon, test_number, threads, qps_value, duration, min_latency, mean, fifty, ninty, nintyfive, nintynine, max_latency, ratio, error):
-        """ Writes on CSV the latency data for one completed test """
-        self.writer.writerow([daemon, str(test_number), threads, qps_value, duration, min_latency, mean, fifty, ninty, nintyfive, nintynine, max_latency, ratio, error])
+    def write_test_report(self, daemon, test_number, threads, qps_value, duration, min_latency, mean, fifty, ninty, nintyfive, nintynine, max_latency, ratio, error, workers=None):
+        """ Writes on CSV the latency data for one completed test, the number of workers in closed-loop mode """
+        row = [daemon, str(test_number), threads, qps_value, duration, min_latency, mean, fifty, ninty, nintyfive, nintynine, max_latency, ratio, error]
+        self.writer.writerow(row + [workers] if workers is not None else row)
         self.csv_file.flush()
 
+    def write_max_qps(self, max_qps):
+        """ Writes on JSON file, beside the CSV file, the max sustainable qps found for each daemon """
+        json_filepath = self.csv_filepath[:-len(".csv")] + ".json"
+        report = {
+            "testType": self.config.test_type,
+            "findMax": self.config.find_max,
+            "maxQps": max_qps,
+        }
+        with open(json_filepath, 'w', encoding='utf8') as json_file:
+            json.dump(report, json_file, indent=4)
+        print("Max qps report file: " + json_filepath)
+
     def close(self):
         """ Close the report """
         self.csv_file.flush()
@@ -502,6 +773,22 @@ def main(argv):
 
     current_sequence = str(config.test_sequence).split(',')
 
+    if config.find_max != "":
+        max_qps = {}
+        for tag in ([SILKRPC] if config.test_mode in ("1", "3") else []) + ([RPCDAEMON] if config.test_mode in ("2", "3") else []):
+            result = perf_test.find_max_qps(tag)
+            if result is None:
+                print("Server dead test Aborted!")
+                if config.create_test_report:
+                    test_report.close()
+                sys.exit(-1)
+            max_qps[tag] = {config.test_type: result}
+        if config.create_test_report:
+            test_report.write_max_qps(max_qps)
+            test_report.close()
+        print("Performance Test completed successfully.")
+        return
+
     if config.test_mode in ("1", "3"):
         result = perf_test.execute_sequence(current_sequence, SILKRPC)
         if result == 0: